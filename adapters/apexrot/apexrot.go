@@ -0,0 +1,48 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package apexrot provides github.com/apex/log handlers that write
+// to logrot writers.
+//
+//	w, err := logrot.OpenWithOptions("app.log", 0600, 10<<20, 5, nil)
+//	if err != nil {
+//		panic(err)
+//	}
+//	log.SetHandler(apexrot.JSON(w))
+package apexrot // import "xi2.org/x/logrot/adapters/apexrot"
+
+import (
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/json"
+	"github.com/apex/log/handlers/logfmt"
+	"xi2.org/x/logrot"
+)
+
+// JSON returns a handler writing each entry to w as a line of JSON.
+func JSON(w *logrot.Writer) log.Handler {
+	return json.New(w)
+}
+
+// Logfmt returns a handler writing each entry to w as a line in
+// logfmt format.
+func Logfmt(w *logrot.Writer) log.Handler {
+	return logfmt.New(w)
+}
@@ -0,0 +1,65 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package hclogrot connects github.com/hashicorp/go-hclog loggers to
+// logrot writers.
+//
+// Use New to create a logger writing straight to a Writer, or
+// NewSink to attach a Writer to an existing hclog.InterceptLogger:
+//
+//	w, err := logrot.OpenWithOptions("app.log", 0600, 10<<20, 5, nil)
+//	if err != nil {
+//		panic(err)
+//	}
+//	logger.RegisterSink(hclogrot.NewSink(w, &hclog.LoggerOptions{
+//		Level:      hclog.Info,
+//		JSONFormat: true,
+//	}))
+package hclogrot // import "xi2.org/x/logrot/adapters/hclogrot"
+
+import (
+	"github.com/hashicorp/go-hclog"
+	"xi2.org/x/logrot"
+)
+
+// options returns a copy of opts, or of a zero LoggerOptions if opts
+// is nil, with Output set to w.
+func options(w *logrot.Writer, opts *hclog.LoggerOptions) *hclog.LoggerOptions {
+	var o hclog.LoggerOptions
+	if opts != nil {
+		o = *opts
+	}
+	o.Output = w
+	return &o
+}
+
+// New returns an hclog.InterceptLogger configured by opts that writes
+// its output to w. Any Output set in opts is ignored.
+func New(w *logrot.Writer, opts *hclog.LoggerOptions) hclog.InterceptLogger {
+	return hclog.NewInterceptLogger(options(w, opts))
+}
+
+// NewSink returns an hclog.SinkAdapter that formats the messages it
+// accepts according to opts, including its Level, and writes them to
+// w. Any Output set in opts is ignored.
+func NewSink(w *logrot.Writer, opts *hclog.LoggerOptions) hclog.SinkAdapter {
+	return hclog.NewSinkAdapter(options(w, opts))
+}
@@ -0,0 +1,91 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package klogrot redirects the output of k8s.io/klog/v2 into logrot
+// writers.
+//
+// The original github.com/golang/glog package offers no way to
+// replace its output files, so only klog is supported.
+//
+//	ws, err := klogrot.RedirectBySeverity("/var/log/controller", 0600, 50<<20, 5, nil)
+//	if err != nil {
+//		panic(err)
+//	}
+//	defer ws.Close()
+//	defer klog.Flush()
+package klogrot // import "xi2.org/x/logrot/adapters/klogrot"
+
+import (
+	"os"
+
+	"k8s.io/klog/v2"
+	"xi2.org/x/logrot"
+)
+
+// Severities lists the klog severity names in increasing order of
+// severity. As with klog's own log files, the file for a severity
+// receives the messages of that severity and of all higher ones.
+var Severities = []string{"INFO", "WARNING", "ERROR", "FATAL"}
+
+// Writers holds the writers opened by RedirectBySeverity keyed by
+// severity name.
+type Writers map[string]*logrot.Writer
+
+// Close closes all the writers in ws, returning the first error
+// encountered.
+func (ws Writers) Close() error {
+	var err error
+	for _, w := range ws {
+		if e := w.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Redirect sends the output of all klog severities to w and stops
+// klog logging to standard error.
+func Redirect(w *logrot.Writer) {
+	klog.LogToStderr(false)
+	klog.SetOutput(w)
+}
+
+// RedirectBySeverity opens a writer for each severity in Severities
+// at <prefix>.<severity>, for example /var/log/controller.ERROR, and
+// redirects klog's output for that severity to it. The remaining
+// arguments are passed on to logrot.OpenWithOptions. klog stops
+// logging to standard error.
+func RedirectBySeverity(prefix string, perm os.FileMode, maxSize int64, maxFiles int, opts *logrot.Options) (Writers, error) {
+	ws := Writers{}
+	for _, s := range Severities {
+		w, err := logrot.OpenWithOptions(prefix+"."+s, perm, maxSize, maxFiles, opts)
+		if err != nil {
+			_ = ws.Close()
+			return nil, err
+		}
+		ws[s] = w
+	}
+	klog.LogToStderr(false)
+	for s, w := range ws {
+		klog.SetOutputBySeverity(s, w)
+	}
+	return ws, nil
+}
@@ -0,0 +1,47 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package log15rot provides github.com/inconshreveable/log15 handlers
+// that write to logrot writers.
+//
+//	w, err := logrot.OpenWithOptions("app.log", 0600, 10<<20, 5, nil)
+//	if err != nil {
+//		panic(err)
+//	}
+//	log15.Root().SetHandler(log15rot.Handler(w, log15.LogfmtFormat()))
+package log15rot // import "xi2.org/x/logrot/adapters/log15rot"
+
+import (
+	"github.com/inconshreveable/log15"
+	"xi2.org/x/logrot"
+)
+
+// Handler returns a handler that formats each record with fmtr and
+// writes it to w.
+func Handler(w *logrot.Writer, fmtr log15.Format) log15.Handler {
+	return log15.StreamHandler(w, fmtr)
+}
+
+// LvlFilterHandler is like Handler but discards records less severe
+// than maxLvl.
+func LvlFilterHandler(maxLvl log15.Lvl, w *logrot.Writer, fmtr log15.Format) log15.Handler {
+	return log15.LvlFilterHandler(maxLvl, Handler(w, fmtr))
+}
@@ -0,0 +1,116 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"errors"
+	"path/filepath"
+)
+
+// CheckRotated reopens the log file if path no longer refers to it,
+// as Write does at most once per ReopenInterval, so that another
+// program known to have rotated the file, such as by a watcher of its
+// directory, is caught up with at once. If AdoptRotated is set, a
+// file renamed within the directory is first taken as the newest
+// archive. Unlike Write it does not fail the Writer from then on if
+// it fails.
+func (wc *Writer) CheckRotated() error {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	if wc.closed {
+		return errors.New("logrot: Writer is closed")
+	}
+	if wc.file == nil || wc.gz != nil || wc.fallback != nil {
+		return nil
+	}
+	if wc.opts.Shared {
+		err := wc.lockShared()
+		if err != nil {
+			return err
+		}
+		defer unlockFile(wc.lockFile)
+	}
+	return wc.checkMoved()
+}
+
+// adoptRotated archives the open log file, which another program has
+// renamed, if it is still in the directory of path: it is moved to
+// the staging file and compressed to <path>.1.gz as in a rotation.
+func (wc *Writer) adoptRotated() error {
+	if wc.maxFiles == 1 {
+		return nil
+	}
+	name, err := wc.renamedTo()
+	if err != nil || name == "" {
+		return err
+	}
+	r := Rotation{
+		Start:   wc.clock.Now(),
+		Bytes:   wc.size,
+		Archive: wc.archiveName(1),
+	}
+	err = wc.lockRotation()
+	if err == nil {
+		wc.stagedAt = r.Start
+		err = wc.rename(name, wc.stagingName())
+	}
+	if err == nil {
+		err = wc.archiveStaged()
+	}
+	wc.unlockRotation()
+	if err == nil {
+		wc.stats.Rotations++
+		wc.replicateRotation(r)
+	}
+	wc.notifyRotate(r, err)
+	return err
+}
+
+// renamedTo returns the name in the directory of path of the open log
+// file, or "" if it is not there or is an archive.
+func (wc *Writer) renamedTo() (string, error) {
+	cur, err := wc.file.Stat()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Dir(wc.path)
+	entries, err := wc.fs.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		name := filepath.Join(dir, e.Name())
+		if _, ok := wc.archiveNumber(name); ok || name == wc.path ||
+			name == wc.stagingName() {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil || !sameFile(fi, cur) {
+			continue
+		}
+		return name, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,101 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package agerot encrypts the archives made by logrot writers with
+// age (https://age-encryption.org), so that rotated logs are never
+// stored unencrypted. Archives are named <path>.<n>.gz.age and can
+// be read with
+//
+//	age -d -i key.txt app.log.1.gz.age | gunzip
+//
+// For example:
+//
+//	e, err := agerot.New("age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p")
+//	if err != nil {
+//		panic(err)
+//	}
+//	w, err := logrot.OpenWithOptions("app.log", 0600, 10<<20, 5,
+//		&logrot.Options{Encrypter: e})
+package agerot // import "xi2.org/x/logrot/agerot"
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"xi2.org/x/logrot"
+)
+
+// Encrypter encrypts archives to a set of age recipients.
+type Encrypter struct {
+	recipients []age.Recipient
+}
+
+var _ logrot.Encrypter = (*Encrypter)(nil)
+
+// New returns an Encrypter encrypting to the X25519 recipients given,
+// in the "age1..." format.
+func New(recipients ...string) (*Encrypter, error) {
+	var rs []age.Recipient
+	for _, s := range recipients {
+		r, err := age.ParseX25519Recipient(s)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	return NewRecipients(rs...)
+}
+
+// NewFromFile returns an Encrypter encrypting to the recipients listed
+// in the file name, in the format of age's -R option.
+func NewFromFile(name string) (*Encrypter, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rs, err := age.ParseRecipients(f)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecipients(rs...)
+}
+
+// NewRecipients returns an Encrypter encrypting to the recipients
+// given, which may be of any type supported by age.
+func NewRecipients(recipients ...age.Recipient) (*Encrypter, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("agerot: no recipients")
+	}
+	return &Encrypter{recipients: recipients}, nil
+}
+
+// Encrypt implements logrot.Encrypter.
+func (e *Encrypter) Encrypt(w io.Writer) (io.WriteCloser, error) {
+	return age.Encrypt(w, e.recipients...)
+}
+
+// Ext returns ".age".
+func (e *Encrypter) Ext() string {
+	return ".age"
+}
@@ -0,0 +1,287 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Archiver sends archives to a destination such as object storage or
+// a remote host. The packages under xi2.org/x/logrot/archivers
+// provide Archivers for common destinations.
+type Archiver interface {
+	// Archive sends the archive at localPath, which is removed
+	// once Archive returns, unless it fails and is kept to be
+	// retried. It is called from a goroutine of its own. ctx is
+	// cancelled if Close gives up waiting for the archive, see
+	// Options.ArchiveTimeout.
+	Archive(ctx context.Context, localPath string, meta ArchiveMeta) error
+}
+
+// ArchiveMeta describes an archive passed to an Archiver.
+type ArchiveMeta struct {
+	// Archive is the name the archive was given when it was
+	// written, <path>.1.gz, which later rotations change.
+	Archive string
+
+	// Name is a unique name for the archive, <base>-<time>.gz,
+	// where base is the base name of Archive less ".1.gz" and time
+	// is To in UTC. Any Encrypter extension follows ".gz" in both.
+	Name string
+
+	// Bytes is the size of the data in the archive.
+	Bytes int64
+
+	// From and To bound the time over which the data in the archive
+	// was written: To is the start of the rotation which made it and
+	// From is the start of the previous rotation by the Writer, or
+	// the time it was opened. Data already in the log file when the
+	// Writer was opened may be older.
+	From, To time.Time
+}
+
+// sentArchive is an archive passed to the Archiver, for
+// RemoveArchived.
+type sentArchive struct {
+	fi   os.FileInfo
+	done bool // sent without error
+}
+
+const (
+	// defaultArchiveConcurrency is used when
+	// Options.ArchiveConcurrency is zero.
+	defaultArchiveConcurrency = 1
+	// defaultArchiveTimeout is used when Options.ArchiveTimeout is
+	// zero.
+	defaultArchiveTimeout = time.Minute
+)
+
+// sendArchive passes a private link to the new archive <path>.1.gz,
+// made from bytes of data staged at wc.stagedAt, to the Archiver. It
+// is called during the rotation, before the archive can be renamed.
+func (wc *Writer) sendArchive(bytes int64) {
+	name := wc.archiveName(1)
+	meta := ArchiveMeta{
+		Archive: name,
+		Name: strings.TrimSuffix(filepath.Base(name), ".1"+wc.archiveExt) + "-" +
+			wc.stagedAt.UTC().Format("20060102T150405.000000000Z") + wc.archiveExt,
+		Bytes: bytes,
+		From:  wc.archivedAt,
+		To:    wc.stagedAt,
+	}
+	wc.archivedAt = wc.stagedAt
+	if wc.opts.RemoveArchived {
+		err := wc.pruneArchived()
+		if err != nil {
+			wc.archiveError(name, err)
+		}
+	}
+	fi, err := wc.fs.Stat(name)
+	if err != nil {
+		wc.archiveError(name, err)
+		return
+	}
+	local, err := wc.holdFile(name)
+	if err != nil {
+		wc.archiveError(name, err)
+		return
+	}
+	var sa *sentArchive
+	if wc.opts.RemoveArchived {
+		sa = &sentArchive{fi: fi}
+		wc.sentMu.Lock()
+		wc.sent = append(wc.sent, sa)
+		wc.sentMu.Unlock()
+	}
+	wc.archiveWG.Add(1)
+	go func() {
+		defer wc.archiveWG.Done()
+		wc.archiveSem <- struct{}{}
+		defer func() { <-wc.archiveSem }()
+		err := wc.opts.Archiver.Archive(wc.archiveCtx, local, meta)
+		if err != nil && wc.opts.RetryArchives {
+			wc.archiveError(name, err)
+			err = wc.queueArchive(local, meta)
+			if err == nil {
+				// sa stays unsent until a retry succeeds
+				return
+			}
+		}
+		if e := wc.fs.Remove(local); err == nil {
+			err = e
+		}
+		if sa != nil {
+			wc.sentMu.Lock()
+			if err == nil {
+				sa.done = true
+			} else if i := wc.findSent(sa.fi); i != -1 {
+				wc.dropSent(i)
+			}
+			wc.sentMu.Unlock()
+		}
+		if err != nil {
+			wc.archiveError(name, err)
+		}
+	}()
+}
+
+// pruneArchived removes the oldest archives while they have been sent
+// and more than KeepLocal remain. It must be called with the
+// rotation locked.
+func (wc *Writer) pruneArchived() error {
+	wc.sentMu.Lock()
+	defer wc.sentMu.Unlock()
+	if len(wc.sent) == 0 {
+		return nil
+	}
+	n, err := wc.lastArchive()
+	if err != nil {
+		return err
+	}
+	for ; n > wc.opts.KeepLocal; n-- {
+		fi, err := wc.fs.Stat(wc.archiveName(n))
+		if err != nil {
+			return err
+		}
+		i := wc.findSent(fi)
+		if i == -1 || !wc.sent[i].done {
+			break
+		}
+		err = wc.removeArchive(wc.archiveName(n))
+		if err != nil {
+			return err
+		}
+		wc.dropSent(i)
+		wc.archives = n - 1
+	}
+	return nil
+}
+
+// findSent returns the index in wc.sent of the archive fi, or -1. The
+// modification time is compared too in case an inode was reused.
+func (wc *Writer) findSent(fi os.FileInfo) int {
+	for i, sa := range wc.sent {
+		if sameFile(fi, sa.fi) && fi.ModTime().Equal(sa.fi.ModTime()) {
+			return i
+		}
+	}
+	return -1
+}
+
+// forgetSent removes the archive name, which is about to be deleted,
+// from wc.sent.
+func (wc *Writer) forgetSent(name string) {
+	fi, err := wc.fs.Stat(name)
+	if err != nil {
+		return
+	}
+	wc.sentMu.Lock()
+	defer wc.sentMu.Unlock()
+	if i := wc.findSent(fi); i != -1 {
+		wc.dropSent(i)
+	}
+}
+
+// dropSent removes wc.sent[i].
+func (wc *Writer) dropSent(i int) {
+	wc.sent = append(wc.sent[:i], wc.sent[i+1:]...)
+}
+
+// archiveError passes an error sending the archive name to the
+// OnArchiveError function, if any.
+func (wc *Writer) archiveError(name string, err error) {
+	if wc.opts.OnArchiveError != nil {
+		wc.opts.OnArchiveError(fmt.Errorf("logrot: archiving %s: %w", name, err))
+	}
+}
+
+// holdFile returns the name of a new hidden file in the directory of
+// the archive name which is a hard link to it or, if links are not
+// supported, a copy of it. On Windows it is always a copy, since the
+// Archiver having the file open through a link would stop the archive
+// being renamed by the next rotation. The link or copy is made under
+// another name and renamed over the file created to reserve the name,
+// so the name never refers to a missing or partial file.
+func (wc *Writer) holdFile(name string) (string, error) {
+	f, err := createTemp(wc.fs, filepath.Dir(name), "."+filepath.Base(name)+".")
+	if err != nil {
+		return "", err
+	}
+	hold := f.Name()
+	_ = f.Close()
+	tmp := hold + ".tmp"
+	if runtime.GOOS == "windows" || link(wc.fs, name, tmp) != nil {
+		err = copyFile(wc.fs, name, tmp, wc.archivePerm())
+	}
+	if err == nil {
+		err = wc.rename(tmp, hold)
+	}
+	if err != nil {
+		_ = wc.fs.Remove(tmp)
+		_ = wc.fs.Remove(hold)
+		return "", err
+	}
+	return hold, nil
+}
+
+// closeArchived removes the archives sent since the last rotation, as
+// for pruneArchived, when the Writer is closed.
+func (wc *Writer) closeArchived() error {
+	if wc.lockFile != nil {
+		err := lockFile(wc.lockFile)
+		if err != nil {
+			return err
+		}
+		defer unlockFile(wc.lockFile)
+	}
+	return wc.pruneArchived()
+}
+
+// stopArchiving stops retrying archives and waits for those being
+// sent, cancelling them once ArchiveTimeout has passed. It is called
+// by Close.
+func (wc *Writer) stopArchiving() {
+	timeout := wc.opts.ArchiveTimeout
+	if timeout == 0 {
+		timeout = defaultArchiveTimeout
+	}
+	var t Timer
+	if timeout > 0 {
+		t = wc.clock.AfterFunc(timeout, wc.archiveEnd)
+	} else {
+		wc.archiveEnd()
+	}
+	if wc.retry != nil {
+		wc.stopRetry()
+	}
+	wc.archiveWG.Wait()
+	if t != nil {
+		t.Stop()
+	}
+	wc.archiveEnd()
+}
@@ -0,0 +1,100 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// noLinkFS is the operating system's FS without Link.
+type noLinkFS struct{ FS }
+
+// readingArchiver is an Archiver which records the uncompressed
+// contents of each archive sent.
+type readingArchiver struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (a *readingArchiver) Archive(ctx context.Context, localPath string, meta ArchiveMeta) error {
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	text, err := io.ReadAll(zr)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.sent = append(a.sent, string(text))
+	a.mu.Unlock()
+	return nil
+}
+
+// TestArchiverHold checks that the Archiver is given a complete copy
+// of each archive, whether held by a link or a copy, and that no hold
+// is left behind.
+func TestArchiverHold(t *testing.T) {
+	for _, fsys := range []FS{osFS{}, noLinkFS{osFS{}}} {
+		dir := t.TempDir()
+		a := &readingArchiver{}
+		wc, err := OpenWithOptions(filepath.Join(dir, "log"), 0644, 10, 3,
+			&Options{FS: fsys, Archiver: a})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := wc.Write([]byte("0123456789\nabcdefghij\nAB\n")); err != nil {
+			t.Fatal(err)
+		}
+		if err := wc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// archives may be sent concurrently
+		sort.Strings(a.sent)
+		want := []string{"0123456789\n", "abcdefghij\n"}
+		if strings.Join(a.sent, "|") != strings.Join(want, "|") {
+			t.Errorf("%T: Archiver got %q, want %q", fsys, a.sent, want)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), ".") {
+				t.Errorf("%T: %s left behind", fsys, e.Name())
+			}
+		}
+	}
+}
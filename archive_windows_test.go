@@ -0,0 +1,81 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// holdingArchiver is an Archiver which keeps each archive open until
+// released, as a slow upload would.
+type holdingArchiver struct {
+	release chan struct{}
+}
+
+func (a *holdingArchiver) Archive(ctx context.Context, localPath string, meta ArchiveMeta) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	select {
+	case <-a.release:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// TestRotateWhileArchiving checks that archives can be shifted by
+// later rotations while the Archiver still has them open.
+func TestRotateWhileArchiving(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	a := &holdingArchiver{release: make(chan struct{})}
+	wc, err := OpenWithOptions(path, 0644, 1000, 3, &Options{Archiver: a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := []string{"0123456789\n", "abcdefghij\n", "ABCDEFGHIJ\n", "klmnopqrst\n"}
+	for i, l := range lines {
+		if _, err := wc.Write([]byte(l)); err != nil {
+			t.Fatal(err)
+		}
+		if i < len(lines)-1 {
+			// each rotation renames the archive the Archiver holds
+			if err := wc.Rotate(); err != nil {
+				t.Fatalf("rotation %d: %v", i+1, err)
+			}
+		}
+	}
+	close(a.release)
+	if err := wc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readGzip(t, path+".2.gz"); got != lines[1] {
+		t.Errorf("archive 2 holds %q", got)
+	}
+	if got := readGzip(t, path+".1.gz"); got != lines[2] {
+		t.Errorf("archive 1 holds %q", got)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package azblobrot provides a logrot.Archiver which uploads archives
+// to Azure Blob Storage, each as a blob named <prefix><name>, where
+// name is the Name of the archive's logrot.ArchiveMeta.
+//
+//	a, err := azblobrot.New(&azblobrot.Config{
+//		ServiceURL: "https://myaccount.blob.core.windows.net/",
+//		Container:  "logs",
+//		Tier:       blob.AccessTierCool,
+//	})
+//	if err != nil {
+//		panic(err)
+//	}
+//	w, err := logrot.OpenWithOptions("app.log", 0600, 10<<20, 5,
+//		&logrot.Options{Archiver: a})
+package azblobrot // import "xi2.org/x/logrot/archivers/azblobrot"
+
+import (
+	"context"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"xi2.org/x/logrot"
+)
+
+// Config describes where and how archives are uploaded.
+type Config struct {
+	Container string // container to upload to
+	Prefix    string // prefix of the blob names, such as "web-1/"
+
+	// Client is the client used. If it is nil, a client is made from
+	// ConnectionString if it is set and otherwise for ServiceURL
+	// using Credential.
+	Client *azblob.Client
+
+	// ConnectionString is the connection string of a storage
+	// account.
+	ConnectionString string
+
+	// ServiceURL is the URL of the blob service of a storage
+	// account, such as "https://myaccount.blob.core.windows.net/".
+	ServiceURL string
+
+	// Credential is the credential used with ServiceURL. If it is
+	// nil, the DefaultAzureCredential is used.
+	Credential azcore.TokenCredential
+
+	// Tier is the access tier of the blobs, blob.AccessTierHot,
+	// blob.AccessTierCool, blob.AccessTierArchive and so on, or ""
+	// for the account's default.
+	Tier blob.AccessTier
+}
+
+// Archiver uploads archives to Blob Storage.
+type Archiver struct {
+	client    *azblob.Client
+	container string
+	prefix    string
+	opts      azblob.UploadFileOptions
+}
+
+var _ logrot.Archiver = (*Archiver)(nil)
+
+// New returns an Archiver uploading archives as described by cfg.
+func New(cfg *Config) (*Archiver, error) {
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	contentType := "application/gzip"
+	a := &Archiver{
+		client:    client,
+		container: cfg.Container,
+		prefix:    cfg.Prefix,
+		opts: azblob.UploadFileOptions{
+			HTTPHeaders: &blob.HTTPHeaders{BlobContentType: &contentType},
+		},
+	}
+	if cfg.Tier != "" {
+		tier := cfg.Tier
+		a.opts.AccessTier = &tier
+	}
+	return a, nil
+}
+
+// Archive uploads the archive at localPath.
+func (a *Archiver) Archive(ctx context.Context, localPath string, meta logrot.ArchiveMeta) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	opts := a.opts
+	_, err = a.client.UploadFile(ctx, a.container, a.prefix+meta.Name, f, &opts)
+	return err
+}
+
+// newClient returns the client described by cfg.
+func newClient(cfg *Config) (*azblob.Client, error) {
+	switch {
+	case cfg.Client != nil:
+		return cfg.Client, nil
+	case cfg.ConnectionString != "":
+		return azblob.NewClientFromConnectionString(cfg.ConnectionString, nil)
+	}
+	cred := cfg.Credential
+	if cred == nil {
+		dc, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, err
+		}
+		cred = dc
+	}
+	return azblob.NewClient(cfg.ServiceURL, cred, nil)
+}
@@ -0,0 +1,150 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package execrot provides a logrot.Archiver which runs a command for
+// each archive, like the postrotate scripts of logrotate.
+//
+// The command is given the path of a private link to the archive as
+// its last argument or, if Config.Stdin is set, the archive on its
+// standard input. The link is removed once the command exits, so a
+// command wanting to keep the archive must copy it. The environment
+// also holds the fields of the archive's logrot.ArchiveMeta:
+// LOGROT_ARCHIVE, LOGROT_NAME, LOGROT_BYTES, LOGROT_FROM and
+// LOGROT_TO, the times in RFC 3339 format.
+//
+//	a := execrot.New(&execrot.Config{
+//		Command: []string{"/usr/local/bin/ship-log"},
+//		Timeout: time.Minute,
+//	})
+//	w, err := logrot.OpenWithOptions("app.log", 0600, 10<<20, 5,
+//		&logrot.Options{Archiver: a, OnArchiveError: func(err error) {
+//			log.Print(err)
+//		}})
+package execrot // import "xi2.org/x/logrot/archivers/execrot"
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"xi2.org/x/logrot"
+)
+
+// maxStderr is the number of bytes of the command's standard error
+// included in an error.
+const maxStderr = 1024
+
+// waitDelay bounds the wait for the output of a command which has
+// been killed.
+const waitDelay = time.Second
+
+// Config describes the command run.
+type Config struct {
+	// Command is the name of the program and its arguments.
+	Command []string
+
+	// Stdin selects passing the archive on standard input instead of
+	// as an argument.
+	Stdin bool
+
+	// Dir is the working directory of the command, or "" for the
+	// current directory.
+	Dir string
+
+	// Env holds extra environment variables, of the form
+	// "key=value".
+	Env []string
+
+	// Timeout, if greater than zero, bounds the time the command may
+	// run before it is killed.
+	Timeout time.Duration
+}
+
+// Archiver runs a command for each archive. A command which exits
+// with a non-zero status or is killed is an error, which includes
+// the end of its standard error.
+type Archiver struct {
+	cfg Config
+}
+
+var _ logrot.Archiver = (*Archiver)(nil)
+
+// New returns an Archiver running the command described by cfg.
+func New(cfg *Config) *Archiver {
+	return &Archiver{cfg: *cfg}
+}
+
+// Archive runs the command for the archive at localPath.
+func (a *Archiver) Archive(ctx context.Context, localPath string, meta logrot.ArchiveMeta) error {
+	if len(a.cfg.Command) == 0 {
+		return errors.New("execrot: no command")
+	}
+	if a.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.cfg.Timeout)
+		defer cancel()
+	}
+	args := a.cfg.Command[1:]
+	if !a.cfg.Stdin {
+		args = append(args[:len(args):len(args)], localPath)
+	}
+	cmd := exec.CommandContext(ctx, a.cfg.Command[0], args...)
+	cmd.Dir = a.cfg.Dir
+	cmd.Env = append(os.Environ(), a.cfg.Env...)
+	cmd.Env = append(cmd.Env,
+		"LOGROT_ARCHIVE="+meta.Archive,
+		"LOGROT_NAME="+meta.Name,
+		"LOGROT_BYTES="+strconv.FormatInt(meta.Bytes, 10),
+		"LOGROT_FROM="+meta.From.Format(time.RFC3339Nano),
+		"LOGROT_TO="+meta.To.Format(time.RFC3339Nano))
+	if a.cfg.Stdin {
+		f, err := os.Open(localPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		cmd.Stdin = f
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// children of a killed command may hold stderr open
+	cmd.WaitDelay = waitDelay
+	err := cmd.Run()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %v: %w", a.cfg.Timeout, err)
+		}
+		msg := bytes.TrimSpace(stderr.Bytes())
+		if len(msg) > maxStderr {
+			msg = msg[len(msg)-maxStderr:]
+		}
+		if len(msg) > 0 {
+			return fmt.Errorf("%s: %w: %s", a.cfg.Command[0], err, msg)
+		}
+		return fmt.Errorf("%s: %w", a.cfg.Command[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package gcsrot provides a logrot.Archiver which uploads archives to
+// Google Cloud Storage, each under the name <prefix><name>, where
+// name is the Name of the archive's logrot.ArchiveMeta.
+//
+//	a, err := gcsrot.New(&gcsrot.Config{
+//		Bucket: "logs",
+//		Prefix: os.Getenv("NODE_NAME") + "/",
+//	})
+//	if err != nil {
+//		panic(err)
+//	}
+//	defer a.Close()
+//	w, err := logrot.OpenWithOptions("app.log", 0600, 10<<20, 5,
+//		&logrot.Options{Archiver: a})
+package gcsrot // import "xi2.org/x/logrot/archivers/gcsrot"
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+	"xi2.org/x/logrot"
+)
+
+// Config describes where and how archives are uploaded.
+type Config struct {
+	Bucket string // bucket to upload to
+	Prefix string // prefix of the object names, such as "node-1/"
+
+	// Client is the storage client used. If it is nil, a client is
+	// made using Application Default Credentials, or the service
+	// account key in CredentialsFile if it is set, and closed by
+	// Close.
+	Client *storage.Client
+
+	// CredentialsFile is the path of a service account key file.
+	CredentialsFile string
+
+	// StorageClass is the storage class of the objects, such as
+	// "NEARLINE", or "" for the bucket's default.
+	StorageClass string
+}
+
+// Archiver uploads archives to Cloud Storage.
+type Archiver struct {
+	cfg    Config
+	bucket *storage.BucketHandle
+	client *storage.Client // client to close, if made by New
+}
+
+var _ logrot.Archiver = (*Archiver)(nil)
+
+// New returns an Archiver uploading archives as described by cfg.
+func New(cfg *Config) (*Archiver, error) {
+	a := &Archiver{cfg: *cfg}
+	client := cfg.Client
+	if client == nil {
+		var opts []option.ClientOption
+		if cfg.CredentialsFile != "" {
+			opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+		}
+		var err error
+		client, err = storage.NewClient(context.Background(), opts...)
+		if err != nil {
+			return nil, err
+		}
+		a.client = client
+	}
+	a.bucket = client.Bucket(cfg.Bucket)
+	return a, nil
+}
+
+// Archive uploads the archive at localPath.
+func (a *Archiver) Archive(ctx context.Context, localPath string, meta logrot.ArchiveMeta) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// cancelling the context abandons a failed upload
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := a.bucket.Object(a.cfg.Prefix + meta.Name).NewWriter(ctx)
+	w.ContentType = "application/gzip"
+	w.StorageClass = a.cfg.StorageClass
+	_, err = io.Copy(w, f)
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// Close closes the storage client if it was made by New. It should be
+// called once the writers using a have been closed.
+func (a *Archiver) Close() error {
+	if a.client != nil {
+		return a.client.Close()
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package s3rot
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"xi2.org/x/logrot"
+	"xi2.org/x/logrot/logrotconfig"
+)
+
+// init registers the archiver type "s3" with logrotconfig.
+func init() {
+	logrotconfig.RegisterArchiver("s3", func(a *logrotconfig.Archiver) (logrot.Archiver, error) {
+		return New(&Config{
+			Bucket:       a.Bucket,
+			Prefix:       a.Prefix,
+			Region:       a.Region,
+			StorageClass: types.StorageClass(a.StorageClass),
+		})
+	})
+}
@@ -0,0 +1,112 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package s3rot provides a logrot.Archiver which uploads archives to
+// Amazon S3, each under the name <prefix><name>, where name is the
+// Name of the archive's logrot.ArchiveMeta.
+//
+//	a, err := s3rot.New(&s3rot.Config{Bucket: "logs", Prefix: "web-1/"})
+//	if err != nil {
+//		panic(err)
+//	}
+//	w, err := logrot.OpenWithOptions("app.log", 0600, 10<<20, 5,
+//		&logrot.Options{Archiver: a})
+package s3rot // import "xi2.org/x/logrot/archivers/s3rot"
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"xi2.org/x/logrot"
+)
+
+// Config describes where and how archives are uploaded.
+type Config struct {
+	Bucket string // bucket to upload to
+	Prefix string // prefix of the object names, such as "web-1/"
+
+	// Client is the S3 client used. If it is nil, a client is made
+	// from the default AWS configuration, modified by Region and
+	// Credentials.
+	Client *s3.Client
+
+	// Region, if not empty, overrides the region of the default
+	// configuration.
+	Region string
+
+	// Credentials, if non-nil, overrides the credentials of the
+	// default configuration.
+	Credentials aws.CredentialsProvider
+
+	// StorageClass is the storage class of the objects, or "" for
+	// the bucket's default.
+	StorageClass types.StorageClass
+}
+
+// Archiver uploads archives to S3.
+type Archiver struct {
+	cfg      Config
+	uploader *manager.Uploader
+}
+
+var _ logrot.Archiver = (*Archiver)(nil)
+
+// New returns an Archiver uploading archives as described by cfg.
+func New(cfg *Config) (*Archiver, error) {
+	client := cfg.Client
+	if client == nil {
+		var fns []func(*config.LoadOptions) error
+		if cfg.Region != "" {
+			fns = append(fns, config.WithRegion(cfg.Region))
+		}
+		if cfg.Credentials != nil {
+			fns = append(fns, config.WithCredentialsProvider(cfg.Credentials))
+		}
+		ac, err := config.LoadDefaultConfig(context.Background(), fns...)
+		if err != nil {
+			return nil, err
+		}
+		client = s3.NewFromConfig(ac)
+	}
+	return &Archiver{cfg: *cfg, uploader: manager.NewUploader(client)}, nil
+}
+
+// Archive uploads the archive at localPath.
+func (a *Archiver) Archive(ctx context.Context, localPath string, meta logrot.ArchiveMeta) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = a.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(a.cfg.Bucket),
+		Key:          aws.String(a.cfg.Prefix + meta.Name),
+		Body:         f,
+		ContentType:  aws.String("application/gzip"),
+		StorageClass: a.cfg.StorageClass,
+	})
+	return err
+}
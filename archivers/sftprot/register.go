@@ -0,0 +1,45 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package sftprot
+
+import (
+	"xi2.org/x/logrot"
+	"xi2.org/x/logrot/logrotconfig"
+)
+
+// init registers the archiver type "sftp" with logrotconfig.
+func init() {
+	logrotconfig.RegisterArchiver("sftp", func(a *logrotconfig.Archiver) (logrot.Archiver, error) {
+		timeout, err := a.ParseTimeout()
+		if err != nil {
+			return nil, err
+		}
+		return New(&Config{
+			Addr:           a.Addr,
+			User:           a.User,
+			Dir:            a.Dir,
+			KeyFile:        a.KeyFile,
+			KnownHostsFile: a.KnownHostsFile,
+			Timeout:        timeout,
+		})
+	})
+}
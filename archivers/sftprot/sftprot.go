@@ -0,0 +1,200 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package sftprot provides a logrot.Archiver which copies archives to
+// a remote host over SFTP, each to <dir>/<name>, where name is the
+// Name of the archive's logrot.ArchiveMeta. The copy is written under
+// a temporary name and renamed once complete, so that programs on the
+// remote host never see a partial archive.
+//
+//	a, err := sftprot.New(&sftprot.Config{
+//		Addr:    "loghost:22",
+//		User:    "logs",
+//		KeyFile: "/etc/app/id_ed25519",
+//		Dir:     "/srv/logs/web-1",
+//	})
+//	if err != nil {
+//		panic(err)
+//	}
+//	w, err := logrot.OpenWithOptions("app.log", 0600, 10<<20, 5,
+//		&logrot.Options{Archiver: a})
+package sftprot // import "xi2.org/x/logrot/archivers/sftprot"
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"xi2.org/x/logrot"
+)
+
+// defaultTimeout is used when Config.Timeout is zero.
+const defaultTimeout = 30 * time.Second
+
+// Config describes where and how archives are copied.
+type Config struct {
+	Addr string // address of the remote host, such as "loghost:22"
+	User string // user to log in as
+	Dir  string // directory on the remote host to copy to
+
+	// Signer is the private key used to log in. If it is nil, the
+	// key is read from KeyFile.
+	Signer  ssh.Signer
+	KeyFile string
+
+	// HostKeyCallback checks the remote host's key. If it is nil,
+	// the key is checked against KnownHostsFile, which defaults to
+	// ~/.ssh/known_hosts.
+	HostKeyCallback ssh.HostKeyCallback
+	KnownHostsFile  string
+
+	// Timeout bounds the time taken to connect. Zero means 30
+	// seconds. Each archive is copied over a new connection, which
+	// is closed if the context passed to Archive is cancelled.
+	Timeout time.Duration
+}
+
+// Archiver copies archives to a remote host.
+type Archiver struct {
+	addr string
+	dir  string
+	sc   *ssh.ClientConfig
+}
+
+var _ logrot.Archiver = (*Archiver)(nil)
+
+// New returns an Archiver copying archives as described by cfg.
+func New(cfg *Config) (*Archiver, error) {
+	sc, err := clientConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Archiver{addr: cfg.Addr, dir: cfg.Dir, sc: sc}, nil
+}
+
+// clientConfig returns the SSH client configuration described by
+// cfg.
+func clientConfig(cfg *Config) (*ssh.ClientConfig, error) {
+	signer := cfg.Signer
+	if signer == nil {
+		if cfg.KeyFile == "" {
+			return nil, errors.New("sftprot: no Signer or KeyFile")
+		}
+		pem, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer, err = ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return nil, err
+		}
+	}
+	hostKey := cfg.HostKeyCallback
+	if hostKey == nil {
+		known := cfg.KnownHostsFile
+		if known == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			known = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		var err error
+		hostKey, err = knownhosts.New(known)
+		if err != nil {
+			return nil, err
+		}
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	return &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKey,
+		Timeout:         timeout,
+	}, nil
+}
+
+// Archive copies the archive at localPath to the remote host. If ctx
+// is cancelled the connection is closed, abandoning the copy, and
+// ctx.Err() is returned.
+func (a *Archiver) Archive(ctx context.Context, localPath string, meta logrot.ArchiveMeta) error {
+	err := a.copy(ctx, localPath, meta)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// copy does the work of Archive.
+func (a *Archiver) copy(ctx context.Context, localPath string, meta logrot.ArchiveMeta) error {
+	d := net.Dialer{Timeout: a.sc.Timeout}
+	nc, err := d.DialContext(ctx, "tcp", a.addr)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+	// closing the connection makes whatever is in progress fail
+	stop := context.AfterFunc(ctx, func() { _ = nc.Close() })
+	defer stop()
+	c, chans, reqs, err := ssh.NewClientConn(nc, a.addr, a.sc)
+	if err != nil {
+		return err
+	}
+	conn := ssh.NewClient(c, chans, reqs)
+	defer conn.Close()
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dst := path.Join(a.dir, meta.Name)
+	tmp := path.Join(a.dir, "."+meta.Name+".tmp")
+	rf, err := client.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = rf.ReadFrom(f)
+	if e := rf.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = client.Rename(tmp, dst)
+	}
+	if err != nil {
+		_ = client.Remove(tmp)
+	}
+	return err
+}
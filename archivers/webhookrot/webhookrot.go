@@ -0,0 +1,188 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package webhookrot provides a logrot.Archiver which notifies an
+// HTTP endpoint of each archive.
+//
+// For each archive a POST request is sent to a configured URL. By
+// default its body is a JSON object describing the archive:
+//
+//	{
+//	    "path": "/var/log/app.log.1.gz",
+//	    "name": "app.log-20240102T150405.000000000Z.gz",
+//	    "size": 10432,
+//	    "bytes": 1048576,
+//	    "from": "2024-01-02T14:01:02.123456789Z",
+//	    "to": "2024-01-02T15:04:05Z",
+//	    "sha256": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+//	}
+//
+// where size is the size of the archive, sha256 is its SHA-256
+// checksum and path, name, bytes, from and to are the Archive, Name,
+// Bytes, From and To fields of its logrot.ArchiveMeta.
+//
+// If Config.SendBody is set, the body is instead the archive itself,
+// with Content-Type application/gzip, or application/octet-stream if
+// the archive is encrypted, and the fields are sent as the headers
+// X-Logrot-Path, X-Logrot-Name and so on.
+//
+//	a := webhookrot.New(&webhookrot.Config{URL: "https://example.com/rotated"})
+//	w, err := logrot.OpenWithOptions("app.log", 0600, 10<<20, 5,
+//		&logrot.Options{Archiver: a})
+package webhookrot // import "xi2.org/x/logrot/archivers/webhookrot"
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"xi2.org/x/logrot"
+)
+
+// Notification is the JSON body sent for each archive.
+type Notification struct {
+	Path   string    `json:"path"`
+	Name   string    `json:"name"`
+	Size   int64     `json:"size"`
+	Bytes  int64     `json:"bytes"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	SHA256 string    `json:"sha256"`
+}
+
+// Config describes where and how notifications are sent.
+type Config struct {
+	URL string // URL to POST to
+
+	// Header holds extra headers for each request, such as
+	// Authorization.
+	Header http.Header
+
+	// Client is the client used. If it is nil, http.DefaultClient is
+	// used.
+	Client *http.Client
+
+	// SendBody selects sending the archive as the request body.
+	SendBody bool
+}
+
+// Archiver sends a request for each archive. A response with a
+// status other than 2xx is an error.
+type Archiver struct {
+	cfg Config
+}
+
+var _ logrot.Archiver = (*Archiver)(nil)
+
+// New returns an Archiver sending requests as described by cfg.
+func New(cfg *Config) *Archiver {
+	a := &Archiver{cfg: *cfg}
+	if a.cfg.Client == nil {
+		a.cfg.Client = http.DefaultClient
+	}
+	return a
+}
+
+// Archive sends the request for the archive at localPath.
+func (a *Archiver) Archive(ctx context.Context, localPath string, meta logrot.ArchiveMeta) error {
+	c := &a.cfg
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	n := Notification{
+		Path:   meta.Archive,
+		Name:   meta.Name,
+		Size:   size,
+		Bytes:  meta.Bytes,
+		From:   meta.From.UTC(),
+		To:     meta.To.UTC(),
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	}
+	var req *http.Request
+	if c.SendBody {
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		req, err = http.NewRequestWithContext(ctx, "POST", c.URL, f)
+		if err != nil {
+			return err
+		}
+		req.ContentLength = size
+		req.Header.Set("Content-Type", contentType(meta.Name))
+		req.Header.Set("X-Logrot-Path", n.Path)
+		req.Header.Set("X-Logrot-Name", n.Name)
+		req.Header.Set("X-Logrot-Size", strconv.FormatInt(n.Size, 10))
+		req.Header.Set("X-Logrot-Bytes", strconv.FormatInt(n.Bytes, 10))
+		req.Header.Set("X-Logrot-From", n.From.Format(time.RFC3339Nano))
+		req.Header.Set("X-Logrot-To", n.To.Format(time.RFC3339Nano))
+		req.Header.Set("X-Logrot-Sha256", n.SHA256)
+	} else {
+		body, err := json.Marshal(n)
+		if err != nil {
+			return err
+		}
+		req, err = http.NewRequestWithContext(ctx, "POST", c.URL,
+			bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", c.URL, resp.Status)
+	}
+	return nil
+}
+
+// contentType returns the Content-Type of the archive name, which
+// is gzip data unless an Encrypter has added its extension.
+func contentType(name string) string {
+	if strings.HasSuffix(name, ".gz") {
+		return "application/gzip"
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,103 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package webhookrot
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"xi2.org/x/logrot"
+)
+
+// request is what the test server received.
+type request struct {
+	contentType string
+	name        string
+	body        []byte
+}
+
+func serve(t *testing.T) (*httptest.Server, <-chan request) {
+	reqs := make(chan request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		reqs <- request{r.Header.Get("Content-Type"), r.Header.Get("X-Logrot-Name"), body}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, reqs
+}
+
+func TestSendBody(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "archive")
+	if err := os.WriteFile(local, []byte("archive data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ name, contentType string }{
+		{"app.log-20240102T150405.000000000Z.gz", "application/gzip"},
+		{"app.log-20240102T150405.000000000Z.gz.age", "application/octet-stream"},
+		{"app.log-20240102T150405.000000000Z.gz.gpg", "application/octet-stream"},
+	} {
+		srv, reqs := serve(t)
+		a := New(&Config{URL: srv.URL, SendBody: true})
+		meta := logrot.ArchiveMeta{Archive: "app.log.1.gz", Name: tc.name, To: time.Now()}
+		if err := a.Archive(context.Background(), local, meta); err != nil {
+			t.Fatal(err)
+		}
+		r := <-reqs
+		if r.contentType != tc.contentType {
+			t.Errorf("%s: Content-Type %q, want %q", tc.name, r.contentType, tc.contentType)
+		}
+		if r.name != tc.name || string(r.body) != "archive data" {
+			t.Errorf("%s: got name %q and body %q", tc.name, r.name, r.body)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "archive")
+	if err := os.WriteFile(local, []byte("archive data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv, reqs := serve(t)
+	a := New(&Config{URL: srv.URL})
+	meta := logrot.ArchiveMeta{Archive: "app.log.1.gz", Name: "app.log-x.gz", Bytes: 100}
+	if err := a.Archive(context.Background(), local, meta); err != nil {
+		t.Fatal(err)
+	}
+	r := <-reqs
+	if r.contentType != "application/json" {
+		t.Errorf("Content-Type %q", r.contentType)
+	}
+	var n Notification
+	if err := json.Unmarshal(r.body, &n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Path != meta.Archive || n.Name != meta.Name || n.Size != 12 || n.Bytes != 100 {
+		t.Errorf("got %+v", n)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// asyncBatchSize is the amount of queued data the background
+// goroutine gathers into a single write.
+const asyncBatchSize = 64 << 10
+
+func (wc *Writer) startQueue() {
+	wc.queue = make(chan *[]byte, wc.opts.AsyncQueue)
+	wc.drained = make(chan struct{})
+	go wc.drain()
+}
+
+// enqueue performs Write in asynchronous mode.
+func (wc *Writer) enqueue(p []byte) (int, error) {
+	wc.errMu.Lock()
+	err := wc.qerr
+	wc.errMu.Unlock()
+	if err != nil {
+		return 0, fmt.Errorf(
+			"logrot: Write cannot complete due to previous error: %v", err)
+	}
+	wc.qmu.RLock()
+	defer wc.qmu.RUnlock()
+	if wc.qclosed {
+		return 0, errors.New("logrot: Writer is closed")
+	}
+	b := queueBufs.Get().(*[]byte)
+	*b = append(*b, p...)
+	switch wc.opts.AsyncOverflow {
+	case DropNewest:
+		select {
+		case wc.queue <- b:
+		default:
+			putQueueBuf(b)
+			atomic.AddInt64(&wc.dropped, 1)
+		}
+	case DropOldest:
+		for {
+			select {
+			case wc.queue <- b:
+				return len(p), nil
+			default:
+			}
+			// make room, unless the background goroutine has
+			// already done so
+			select {
+			case old := <-wc.queue:
+				putQueueBuf(old)
+				atomic.AddInt64(&wc.dropped, 1)
+			default:
+			}
+		}
+	default:
+		wc.queue <- b
+	}
+	return len(p), nil
+}
+
+// drain runs in its own goroutine, writing queued data to the file
+// until the queue is closed.
+func (wc *Writer) drain() {
+	defer close(wc.drained)
+	var buf []byte
+	for b := range wc.queue {
+		buf = append(buf[:0], *b...)
+		putQueueBuf(b)
+	batch:
+		for len(buf) < asyncBatchSize {
+			select {
+			case b, ok := <-wc.queue:
+				if !ok {
+					break batch
+				}
+				buf = append(buf, *b...)
+				putQueueBuf(b)
+			default:
+				break batch
+			}
+		}
+		wc.checkHighWater()
+		_, err := wc.lockedWrite(context.Background(), buf)
+		if err != nil {
+			wc.errMu.Lock()
+			if wc.qerr == nil {
+				wc.qerr = err
+			}
+			wc.errMu.Unlock()
+		}
+	}
+}
+
+// closeQueue stops further writes being queued and waits for the
+// queue to drain.
+func (wc *Writer) closeQueue() {
+	wc.qmu.Lock()
+	if !wc.qclosed {
+		wc.qclosed = true
+		close(wc.queue)
+	}
+	wc.qmu.Unlock()
+	<-wc.drained
+}
+
+// QueueDepth returns the number of writes waiting in the asynchronous
+// queue, or zero if wc is not in asynchronous mode. Unlike Stats it
+// never waits for a write in progress.
+func (wc *Writer) QueueDepth() int {
+	return len(wc.queue)
+}
+
+// checkHighWater calls OnHighWater if the queue has risen to
+// HighWater or drained to half of it since it was last called.
+func (wc *Writer) checkHighWater() {
+	hw := wc.opts.HighWater
+	if hw <= 0 || wc.opts.OnHighWater == nil {
+		return
+	}
+	high := atomic.LoadInt32(&wc.high) == 1
+	if n := len(wc.queue); !high && n < hw || high && n > hw/2 {
+		return
+	}
+	wc.highMu.Lock()
+	defer wc.highMu.Unlock()
+	n := len(wc.queue)
+	switch {
+	case atomic.LoadInt32(&wc.high) == 0 && n >= hw:
+		atomic.StoreInt32(&wc.high, 1)
+		wc.opts.OnHighWater(true)
+	case atomic.LoadInt32(&wc.high) == 1 && n <= hw/2:
+		atomic.StoreInt32(&wc.high, 0)
+		wc.opts.OnHighWater(false)
+	}
+}
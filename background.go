@@ -0,0 +1,256 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var errLockUnsupported = errors.New(
+	"logrot: LockFile is not supported on this platform")
+
+// stagingName returns the name of the file holding data waiting to
+// be compressed.
+func (wc *Writer) stagingName() string {
+	return wc.path + ".rotating"
+}
+
+// stage copies the file contents up to the last newline to the
+// staging file.
+func (wc *Writer) stage() error {
+	f, err := wc.fs.OpenFile(wc.stagingName(),
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, wc.perm)
+	if err != nil {
+		return err
+	}
+	err = wc.setAttrs(wc.stagingName(), wc.perm)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	_, err = copyBuffer(f, io.NewSectionReader(wc.file, 0, wc.lastNewline+1))
+	if footer := wc.footer(wc.archiveName(1)); err == nil && len(footer) > 0 {
+		_, err = f.Write(footer)
+	}
+	if err == nil && wc.opts.SyncOnRotate {
+		// the data is about to be removed from the log file
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// renameAside renames the log file to the staging file and replaces
+// it with a new empty log file.
+func (wc *Writer) renameAside() error {
+	err := wc.rename(wc.path, wc.stagingName())
+	if err != nil {
+		return err
+	}
+	file, err := openLog(wc.fs, wc.path, wc.perm, wc.opts.Append)
+	if err == nil {
+		err = wc.setAttrs(wc.path, wc.perm)
+		if err != nil {
+			_ = file.Close()
+		}
+	}
+	if err != nil {
+		// put the log file back
+		_ = wc.rename(wc.stagingName(), wc.path)
+		return err
+	}
+	if footer := wc.footer(wc.archiveName(1)); len(footer) > 0 {
+		// the old log file is now the staging file
+		if wc.opts.Append {
+			_, err = wc.file.Write(footer)
+		} else {
+			_, err = wc.file.WriteAt(footer, wc.size)
+		}
+	}
+	if err == nil && wc.opts.SyncOnRotate {
+		err = wc.file.Sync()
+	}
+	if e := wc.file.Close(); err == nil {
+		err = e
+	}
+	wc.file = file
+	return err
+}
+
+// lockRotation takes wc.rotMu and, if LockFile is set, the lock on
+// <path>.lock, waiting for any earlier rotation to finish with the
+// staging file. It returns any error from that rotation's
+// compression. The locks must be released with unlockRotation even
+// if there is an error.
+func (wc *Writer) lockRotation() error {
+	if wc.handoff {
+		// an earlier rotation in this write left the staging file for
+		// the caller, who already holds wc.rotMu
+		wc.handoff = false
+		err := wc.archiveStaged()
+		wc.notifyRotate(wc.pending, err)
+		return err
+	}
+	wc.rotMu.Lock()
+	// in shared mode the lock file is already held by write
+	if wc.lockFile != nil && !wc.opts.Shared {
+		err := lockFile(wc.lockFile)
+		if err != nil {
+			return err
+		}
+	}
+	err := wc.bgErr
+	wc.bgErr = nil
+	if err == nil && (wc.opts.LockFile || wc.opts.Append) && !wc.opts.Shared && wc.file != nil {
+		// another process may have written to or rotated the log
+		// file while the lock was not held
+		err = wc.syncShared()
+	}
+	return err
+}
+
+// unlockRotation releases the locks taken by lockRotation.
+func (wc *Writer) unlockRotation() {
+	if wc.lockFile != nil && !wc.opts.Shared {
+		_ = unlockFile(wc.lockFile)
+	}
+	wc.rotMu.Unlock()
+}
+
+// compressInBackground starts a goroutine which compresses the
+// staging file and then releases the locks taken by lockRotation,
+// which must be held.
+func (wc *Writer) compressInBackground() {
+	go func() {
+		defer wc.unlockRotation()
+		wc.bgErr = wc.archiveStaged()
+	}()
+}
+
+// finishRotation compresses the staging file left by write for its
+// caller, reporting the rotation r, and releases the locks taken by
+// lockRotation. If it fails, the error is also kept for the next
+// rotation so that the staging file is not overwritten.
+func (wc *Writer) finishRotation(r Rotation) error {
+	err := wc.archiveStaged()
+	wc.bgErr = err
+	wc.unlockRotation()
+	wc.notifyRotate(r, err)
+	return err
+}
+
+// recoverStaging repairs the archives and finishes any rotation
+// which was interrupted before its staging file was compressed.
+func (wc *Writer) recoverStaging() error {
+	if wc.opts.Shared {
+		// another process may be rotating so check within the lock
+		err := lockFile(wc.lockFile)
+		if err != nil {
+			return err
+		}
+		defer unlockFile(wc.lockFile)
+	}
+	err := wc.lockRotation()
+	if err != nil {
+		wc.unlockRotation()
+		return err
+	}
+	err = wc.repairArchives()
+	if err == nil && wc.opts.Checksums {
+		err = wc.checkSidecars()
+	}
+	if err != nil {
+		wc.unlockRotation()
+		return err
+	}
+	fi, err := wc.fs.Lstat(wc.stagingName())
+	if err != nil {
+		wc.unlockRotation()
+		return nil
+	}
+	wc.stagedAt = fi.ModTime()
+	if wc.opts.Shared {
+		err = wc.archiveStaged()
+		wc.unlockRotation()
+		return err
+	}
+	wc.compressInBackground()
+	return nil
+}
+
+// archiveStaged shifts the archives and compresses the staging file
+// to <path>.1.gz, removing the staging file on success.
+func (wc *Writer) archiveStaged() error {
+	err := wc.shiftArchives()
+	if err != nil {
+		return err
+	}
+	f, err := open(wc.fs, wc.stagingName())
+	if err != nil {
+		return err
+	}
+	var size int64
+	if wc.opts.Archiver != nil || wc.opts.Manifest {
+		fi, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+		size = fi.Size()
+	}
+	sum, err := wc.compress(f)
+	for err != nil && wc.purge(err) {
+		_, err = f.Seek(0, io.SeekStart)
+		if err == nil {
+			sum, err = wc.compress(f)
+		}
+	}
+	if err == nil && wc.opts.SyncDir {
+		// the renamed and new archives must survive a crash before
+		// the staging file is removed
+		err = syncDir(wc.fs, filepath.Dir(wc.archiveBase))
+	}
+	var merr error
+	if err == nil && wc.opts.Manifest {
+		// the archive is kept even if the manifest cannot be updated
+		merr = wc.updateManifest(f, size, sum)
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	if wc.opts.Archiver != nil {
+		wc.sendArchive(size)
+	}
+	err = wc.fs.Remove(wc.stagingName())
+	if err == nil {
+		err = merr
+	}
+	return err
+}
@@ -0,0 +1,174 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"os"
+)
+
+// sidecarName returns the name of the checksum file of the archive
+// name.
+func sidecarName(name string) string {
+	return name + ".sha256"
+}
+
+// writeSidecar writes the checksum file of the archive name holding
+// sum.
+func (wc *Writer) writeSidecar(name string, sum []byte) error {
+	side := sidecarName(name)
+	f, err := wc.fs.OpenFile(side+".tmp",
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, wc.archivePerm())
+	if err != nil {
+		return err
+	}
+	_, err = f.Write([]byte(hex.EncodeToString(sum) + "\n"))
+	if err == nil && wc.opts.SyncOnRotate {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = wc.setAttrs(side+".tmp", wc.archivePerm())
+	}
+	if err == nil {
+		err = wc.rename(side+".tmp", side)
+	}
+	if err != nil {
+		_ = wc.fs.Remove(side + ".tmp")
+	}
+	return err
+}
+
+// renameArchive renames the archive from to to, along with its
+// checksum file if Checksums is set.
+func (wc *Writer) renameArchive(from, to string) error {
+	err := wc.rename(from, to)
+	if err != nil || !wc.opts.Checksums {
+		return err
+	}
+	err = wc.rename(sidecarName(from), sidecarName(to))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// removeArchive removes the archive name, along with its checksum
+// file if Checksums is set.
+func (wc *Writer) removeArchive(name string) error {
+	err := wc.fs.Remove(name)
+	if err != nil {
+		return err
+	}
+	wc.diag(slog.LevelInfo, "logrot: deleted archive", "archive", name)
+	wc.emit(ArchiveDeleted, name, Rotation{}, nil)
+	if !wc.opts.Checksums {
+		return nil
+	}
+	err = wc.fs.Remove(sidecarName(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// quarantine renames the damaged archive name with a ".corrupt"
+// suffix and removes any checksum file.
+func (wc *Writer) quarantine(name string) error {
+	err := wc.rename(name, name+".corrupt")
+	if err != nil {
+		return err
+	}
+	wc.diag(slog.LevelWarn, "logrot: quarantined damaged archive",
+		"archive", name+".corrupt")
+	err = wc.fs.Remove(sidecarName(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// checkSidecars checks each archive against its checksum file,
+// quarantining those which do not match and renumbering the rest. A
+// missing checksum file for archive 1, which a crash may leave, is
+// written. The rotation lock must be held.
+func (wc *Writer) checkSidecars() error {
+	n, err := wc.lastArchive()
+	if err != nil {
+		return err
+	}
+	damaged := false
+	for i := 1; i <= n; i++ {
+		name := wc.archiveName(i)
+		want, err := readFile(wc.fs, sidecarName(name))
+		missing := os.IsNotExist(err)
+		if err != nil && (!missing || i > 1) {
+			if missing {
+				continue
+			}
+			return err
+		}
+		got, err := fileSHA256(wc.fs, name)
+		if err != nil {
+			return err
+		}
+		if missing {
+			err = wc.writeSidecar(name, got)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		fields := bytes.Fields(want)
+		if len(fields) == 0 || string(fields[0]) != hex.EncodeToString(got) {
+			err = wc.quarantine(name)
+			if err != nil {
+				return err
+			}
+			damaged = true
+		}
+	}
+	if damaged {
+		return wc.renumberArchives()
+	}
+	return nil
+}
+
+// fileSHA256 returns the SHA-256 checksum of the file name on fsys.
+func fileSHA256(fsys FS, name string) ([]byte, error) {
+	f, err := open(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = copyBuffer(h, f)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,74 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import "time"
+
+// Clock is a source of time. All of a Writer's reading of the time
+// and timers go through its Clock, so that tests can control time
+// with an implementation such as logrottest.Clock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// AfterFunc calls f in its own goroutine once d has elapsed,
+	// as time.AfterFunc does.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer started by Clock.AfterFunc.
+type Timer interface {
+	// Stop prevents the timer from firing, reporting whether it
+	// did so, as time.Timer's Stop method does.
+	Stop() bool
+}
+
+// systemClock is the Clock used if Options.Clock is nil.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// sleep waits for d to elapse on the clock, returning false early if
+// stop is closed.
+func (wc *Writer) sleep(d time.Duration, stop <-chan struct{}) bool {
+	return sleep(wc.clock, d, stop)
+}
+
+// sleep waits for d to elapse on clock, returning false early if stop
+// is closed.
+func sleep(clock Clock, d time.Duration, stop <-chan struct{}) bool {
+	done := make(chan struct{})
+	t := clock.AfterFunc(d, func() { close(done) })
+	select {
+	case <-stop:
+		t.Stop()
+		return false
+	case <-done:
+		return true
+	}
+}
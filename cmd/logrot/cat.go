@@ -0,0 +1,173 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"xi2.org/x/logrot"
+)
+
+// rotationSet names the files of a log file and its archives.
+type rotationSet struct {
+	path string // the log file
+	base string // archive names less ".<n>.gz"
+}
+
+// newRotationSet returns the rotationSet of the log file path whose
+// archives are in archiveDir, or beside it if archiveDir is empty.
+func newRotationSet(path, archiveDir string) *rotationSet {
+	base := path
+	if archiveDir != "" {
+		base = filepath.Join(archiveDir, filepath.Base(path))
+	}
+	return &rotationSet{path: path, base: base}
+}
+
+// archive returns the name of archive n.
+func (s *rotationSet) archive(n int) string {
+	return fmt.Sprintf("%s.%d.gz", s.base, n)
+}
+
+// count returns the highest number of an archive, or zero if there
+// are none.
+func (s *rotationSet) count() (int, error) {
+	nums, err := s.numbers()
+	if err != nil || len(nums) == 0 {
+		return 0, err
+	}
+	return nums[len(nums)-1], nil
+}
+
+// numbers returns the numbers of the archives in increasing order.
+func (s *rotationSet) numbers() ([]int, error) {
+	entries, err := os.ReadDir(filepath.Dir(s.base))
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(s.base) + "."
+	var nums []int
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".gz") {
+			continue
+		}
+		num := name[len(prefix) : len(name)-len(".gz")]
+		n, err := strconv.Atoi(num)
+		if err == nil && n > 0 && strconv.Itoa(n) == num {
+			nums = append(nums, n)
+		}
+	}
+	sort.Ints(nums)
+	return nums, nil
+}
+
+// cat implements "logrot cat".
+func cat(args []string) {
+	fs := flag.NewFlagSet("cat", flag.ExitOnError)
+	conf := fs.String("c", "", "a YAML or TOML file of settings")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: logrot cat [-c file] path\n")
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+	}
+	cfg := loadConfig(*conf)
+	r, err := logrot.OpenReaderWithOptions(fs.Arg(0),
+		&logrot.Options{ArchiveDir: cfg.ArchiveDir})
+	if err != nil {
+		fatalf("%v", err)
+	}
+	_, err = io.Copy(os.Stdout, r)
+	if e := r.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// tail implements "logrot tail". With -f a Follower is created
+// before the last lines are written, which are taken from the log file
+// only up to where it starts, so that nothing is written twice.
+func tail(args []string) {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	conf := fs.String("c", "", "a YAML or TOML file of settings")
+	follow := fs.Bool("f", false, "follow the log file as it is written and rotated")
+	lines := fs.Int("n", 10, "the number of lines to print first, or -1 for all")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: logrot tail [-c file] [-f] [-n lines] path\n")
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+	}
+	cfg := loadConfig(*conf)
+	opts := &logrot.Options{ArchiveDir: cfg.ArchiveDir}
+	var f *logrot.Follower
+	if *follow {
+		var err error
+		f, err = logrot.FollowWithOptions(fs.Arg(0), opts)
+		if err != nil {
+			fatalf("%v", err)
+		}
+	}
+	r, err := logrot.OpenReaderWithOptions(fs.Arg(0), opts)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if f != nil {
+		r.LimitLog(f.Offset())
+	}
+	if *lines < 0 {
+		_, err = io.Copy(os.Stdout, r)
+	} else {
+		var last []byte
+		last, err = r.Tail(*lines)
+		if err == nil {
+			_, err = os.Stdout.Write(last)
+		}
+	}
+	if e := r.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if f == nil {
+		return
+	}
+	_, err = io.Copy(os.Stdout, f)
+	fatalf("%v", err)
+}
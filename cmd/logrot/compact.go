@@ -0,0 +1,68 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"xi2.org/x/logrot"
+	"xi2.org/x/logrot/logrotconfig"
+)
+
+// compact implements "logrot compact".
+func compact(args []string) {
+	fs := flag.NewFlagSet("compact", flag.ExitOnError)
+	conf := fs.String("c", "", "a YAML or TOML file of settings")
+	size := fs.String("s", "100M", "the largest size of a merged archive, with an optional K, M or G suffix")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: logrot compact [-c file] [-s size] path\n")
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+	}
+	target, err := logrotconfig.ParseSize(*size)
+	if err != nil {
+		fatalf("invalid size %q: %v", *size, err)
+	}
+	cfg := loadConfig(*conf)
+	// the archives are not sent anywhere
+	cfg.Archiver = nil
+	opts, err := cfg.Options()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	path := fs.Arg(0)
+	m, err := logrot.ReadManifest(path, opts)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	opts.Manifest = len(m.Archives) > 0
+	err = logrot.Compact(path, target, opts)
+	if err != nil {
+		fatalf("%v", err)
+	}
+}
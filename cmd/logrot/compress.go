@@ -0,0 +1,99 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// compress implements "logrot compress". The log file is renamed to
+// <path>.compressing and its contents written through a new Writer at
+// path, which archives all but the last part as it goes.
+func compress(args []string) {
+	fs := flag.NewFlagSet("compress", flag.ExitOnError)
+	conf := fs.String("c", "", "a YAML or TOML file of settings")
+	size := fs.String("s", "10M", "the size of each part, with an optional K, M or G suffix")
+	files := fs.Int("n", 0, "the number of files to keep, or 0 for all")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr,
+			"usage: logrot compress [-c file] [-s size] [-n files] path\n")
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+	}
+	cfg := loadConfig(*conf)
+	cfg.Path = fs.Arg(0)
+	cfg.Files = *files
+	if cfg.Files == 0 {
+		cfg.Files = math.MaxInt32
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "s" {
+			cfg.Size = *size
+		}
+	})
+	if cfg.Size == "" {
+		cfg.Size = *size
+	}
+	fi, err := os.Stat(cfg.Path)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if cfg.Perm == "" {
+		cfg.Perm = fmt.Sprintf("%o", fi.Mode().Perm())
+	}
+	old := cfg.Path + ".compressing"
+	if _, err := os.Lstat(old); err == nil {
+		fatalf("%s exists, holding the log file of an interrupted compress", old)
+	}
+	err = os.Rename(cfg.Path, old)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	w, err := cfg.Open()
+	if err != nil {
+		_ = os.Rename(old, cfg.Path)
+		fatalf("%v", err)
+	}
+	f, err := os.Open(old)
+	if err == nil {
+		_, err = io.Copy(w, f)
+		_ = f.Close()
+	}
+	if e := w.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		fatalf("%v (the original log file is %s)", err, old)
+	}
+	err = os.Remove(old)
+	if err != nil {
+		fatalf("%v", err)
+	}
+}
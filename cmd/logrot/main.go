@@ -0,0 +1,195 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Command logrot writes its standard input to a log file, rotating
+// and compressing it with package logrot, so that programs not
+// written in Go can have their logs rotated:
+//
+//	myapp 2>&1 | logrot -p /var/log/myapp.log -s 100M -n 10
+//
+// Usage:
+//
+//	logrot [-c file] [-p path] [-perm mode] [-s size] [-n files]
+//
+// The flags are:
+//
+//	-c file
+//		a YAML or TOML file of settings, as read by package
+//		xi2.org/x/logrot/logrotconfig, which the other flags
+//		override
+//	-p path
+//		the log file to write (required unless set by -c)
+//	-perm mode
+//		the permissions, in octal, of created files (default 0644)
+//	-s size
+//		the size at which the log file is rotated, in bytes or
+//		with a suffix K, M or G for powers of 1024 (default 10M)
+//	-n files
+//		the number of files to keep, the log file and its
+//		archives (default 10)
+//
+// Logrot exits once its input is closed, or with status 1 if the log
+// file cannot be written.
+//
+// Logrot also has subcommands for working with a set of archives,
+// each taking the path of the log file:
+//
+//	logrot compress [-c file] [-s size] [-n files] path
+//		split an existing log file, such as a large log kept
+//		before logrot was adopted, into archives offline, as if
+//		it had been written by logrot, keeping all of it unless
+//		-n is given
+//	logrot cat [-c file] path
+//		write the contents of the archives, decompressed and
+//		oldest first, and then of the log file
+//	logrot tail [-c file] [-f] [-n lines] path
+//		write the last lines of the archives and log file
+//		together, by default 10, or all of them if lines is
+//		-1, and with -f go on to write data as it is added,
+//		following the log file across rotations
+//	logrot verify [-c file] [-fix] path
+//		check the archives for gaps in their numbering,
+//		damaged gzip files or checksum mismatches, temporary
+//		files left by interrupted rotations and permissions
+//		differing from those configured or of the log file,
+//		and with -fix repair them: damaged archives are renamed
+//		with a ".corrupt" suffix, as logrot does, and the rest
+//		renumbered. It exits with status 1 if problems remain.
+//		Use -fix only while no Writer has the log file open.
+//	logrot stats [-c file] [-s size] [-n files] path
+//		print the time range, size and compression ratio of each
+//		file, taking each archive to start when the one before
+//		it was rotated, the totals retained, and the rate of
+//		writing, from which it projects how many days the set
+//		holds once full of the given number of files rotated at
+//		the given size (by default 10 of 10M)
+//	logrot compact [-c file] [-s size] path
+//		merge runs of consecutive archives into archives of at
+//		most the given size (by default 100M), renumbering them
+//		and updating their checksum files and any manifest.
+//		Use it only while no Writer has the log file open.
+package main // import "xi2.org/x/logrot/cmd/logrot"
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"xi2.org/x/logrot/logrotconfig"
+
+	// archiver types for -c
+	_ "xi2.org/x/logrot/archivers/azblobrot"
+	_ "xi2.org/x/logrot/archivers/execrot"
+	_ "xi2.org/x/logrot/archivers/gcsrot"
+	_ "xi2.org/x/logrot/archivers/s3rot"
+	_ "xi2.org/x/logrot/archivers/sftprot"
+	_ "xi2.org/x/logrot/archivers/webhookrot"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr,
+		"usage: logrot [-c file] [-p path] [-perm mode] [-s size] [-n files]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "compress":
+			compress(os.Args[2:])
+			return
+		case "cat":
+			cat(os.Args[2:])
+			return
+		case "tail":
+			tail(os.Args[2:])
+			return
+		case "verify":
+			verify(os.Args[2:])
+			return
+		case "stats":
+			stats(os.Args[2:])
+			return
+		case "compact":
+			compact(os.Args[2:])
+			return
+		}
+	}
+	conf := flag.String("c", "", "a YAML or TOML file of settings")
+	path := flag.String("p", "", "the log file to write")
+	perm := flag.String("perm", "0644", "the permissions of created files, in octal")
+	size := flag.String("s", "10M", "the size at which to rotate, with an optional K, M or G suffix")
+	files := flag.Int("n", 10, "the number of files to keep")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() > 0 {
+		usage()
+	}
+	cfg := loadConfig(*conf)
+	// flags given explicitly override the file
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "p":
+			cfg.Path = *path
+		case "perm":
+			cfg.Perm = *perm
+		case "s":
+			cfg.Size = *size
+		case "n":
+			cfg.Files = *files
+		}
+	})
+	if cfg.Path == "" {
+		usage()
+	}
+	w, err := cfg.Open()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	_, err = io.Copy(w, os.Stdin)
+	if e := w.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// loadConfig loads the settings in the file name, if it is not
+// empty.
+func loadConfig(name string) *logrotconfig.Config {
+	if name == "" {
+		return new(logrotconfig.Config)
+	}
+	cfg, err := logrotconfig.Load(name)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	return cfg
+}
+
+// fatalf prints an error message and exits with status 1.
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "logrot: "+format+"\n", args...)
+	os.Exit(1)
+}
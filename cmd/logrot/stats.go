@@ -0,0 +1,208 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"xi2.org/x/logrot/logrotconfig"
+)
+
+// stats implements "logrot stats". Each archive is taken to hold the
+// data written between the modification times of the next older
+// archive and of itself, when each was rotated.
+func stats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	conf := fs.String("c", "", "a YAML or TOML file of settings")
+	size := fs.String("s", "10M", "the size at which the log file is rotated, with an optional K, M or G suffix")
+	files := fs.Int("n", 10, "the number of files kept")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr,
+			"usage: logrot stats [-c file] [-s size] [-n files] path\n")
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+	}
+	cfg := loadConfig(*conf)
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "s":
+			cfg.Size = *size
+		case "n":
+			cfg.Files = *files
+		}
+	})
+	if cfg.Size == "" {
+		cfg.Size = *size
+	}
+	if cfg.Files == 0 {
+		cfg.Files = *files
+	}
+	maxSize, err := logrotconfig.ParseSize(cfg.Size)
+	if err != nil {
+		fatalf("invalid size %q: %v", cfg.Size, err)
+	}
+	set := newRotationSet(fs.Arg(0), cfg.ArchiveDir)
+	err = printStats(set, maxSize, cfg.Files)
+	if err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// fileStats describes one file of a rotationSet.
+type fileStats struct {
+	name       string
+	from, to   time.Time // zero if unknown
+	compressed int64     // size on disk
+	size       int64     // size of the data
+}
+
+// printStats prints the statistics of set, projecting the retention
+// of maxFiles files rotated at maxSize.
+func printStats(set *rotationSet, maxSize int64, maxFiles int) error {
+	now := time.Now()
+	last, err := set.count()
+	if err != nil {
+		return err
+	}
+	var all []fileStats
+	var prev time.Time // modification time of the next older archive
+	for n := last; n > 0; n-- {
+		st, err := archiveStats(set.archive(n))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		st.from = prev
+		prev = st.to
+		all = append(all, st)
+	}
+	fi, err := os.Stat(set.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		all = append(all, fileStats{
+			name:       set.path,
+			from:       prev,
+			to:         fi.ModTime(),
+			compressed: fi.Size(),
+			size:       fi.Size(),
+		})
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "FROM\tTO\tCOMPRESSED\tSIZE\tRATIO\t\tFILE\n")
+	var total, totalCompressed, written int64
+	for _, st := range all {
+		ratio := "-"
+		if st.size > 0 {
+			ratio = fmt.Sprintf("%.1f%%", 100*float64(st.compressed)/float64(st.size))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\t%s\n",
+			formatTime(st.from), formatTime(st.to),
+			formatSize(st.compressed), formatSize(st.size), ratio, st.name)
+		total += st.size
+		totalCompressed += st.compressed
+		if !st.from.IsZero() {
+			written += st.size
+		}
+	}
+	_ = tw.Flush()
+	fmt.Printf("\nretained: %s in %d files, %s compressed\n",
+		formatSize(total), len(all), formatSize(totalCompressed))
+	// the rate is measured from the end of the oldest archive, as its
+	// start is unknown
+	if len(all) < 2 || written == 0 {
+		fmt.Printf("write rate: unknown\n")
+		return nil
+	}
+	elapsed := now.Sub(all[0].to)
+	if elapsed <= 0 {
+		fmt.Printf("write rate: unknown\n")
+		return nil
+	}
+	perDay := float64(written) / elapsed.Hours() * 24
+	fmt.Printf("write rate: %s per day\n", formatSize(int64(perDay)))
+	fmt.Printf("projected retention: %.1f days of %d files of %s\n",
+		float64(maxSize)*float64(maxFiles)/perDay,
+		maxFiles, formatSize(maxSize))
+	return nil
+}
+
+// archiveStats returns the statistics of the archive name, reading
+// its decompressed size.
+func archiveStats(name string) (fileStats, error) {
+	st := fileStats{name: name}
+	f, err := os.Open(name)
+	if err != nil {
+		return st, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return st, err
+	}
+	st.to = fi.ModTime()
+	st.compressed = fi.Size()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return st, fmt.Errorf("%s: %v", name, err)
+	}
+	st.size, err = io.Copy(io.Discard, zr)
+	if err != nil {
+		return st, fmt.Errorf("%s: %v", name, err)
+	}
+	return st, nil
+}
+
+// formatTime formats t for a table, or returns "-" if t is zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// formatSize formats n bytes with a suffix K, M or G for powers of
+// 1024, as taken by the -s flag.
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fG", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fM", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fK", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d", n)
+}
@@ -0,0 +1,327 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// verify implements "logrot verify".
+func verify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	conf := fs.String("c", "", "a YAML or TOML file of settings")
+	fix := fs.Bool("fix", false, "repair the problems found")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: logrot verify [-c file] [-fix] path\n")
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+	}
+	cfg := loadConfig(*conf)
+	v := &verifier{
+		set: newRotationSet(fs.Arg(0), cfg.ArchiveDir),
+		fix: *fix,
+	}
+	perm := cfg.Compression.Perm
+	if perm == "" {
+		perm = cfg.Perm
+	}
+	if perm != "" {
+		mode, err := strconv.ParseUint(perm, 8, 32)
+		if err != nil {
+			fatalf("invalid permissions %q", perm)
+		}
+		v.perm = os.FileMode(mode)
+	}
+	err := v.run()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if v.problems > v.fixed {
+		os.Exit(1)
+	}
+}
+
+// verifier checks a rotationSet, repairing it if fix is set.
+type verifier struct {
+	set      *rotationSet
+	fix      bool
+	perm     os.FileMode // expected permissions of archives, or zero
+	staged   bool        // whether a rotation was interrupted
+	problems int
+	fixed    int
+}
+
+// report prints a problem with the file name and, if fix is set and
+// repair is non-nil, repairs it.
+func (v *verifier) report(name, problem string, repair func() error) error {
+	v.problems++
+	if !v.fix || repair == nil {
+		fmt.Printf("%s: %s\n", name, problem)
+		return nil
+	}
+	err := repair()
+	if err != nil {
+		return err
+	}
+	v.fixed++
+	fmt.Printf("%s: %s: fixed\n", name, problem)
+	return nil
+}
+
+// run checks the set: leftover files first, then each archive, and
+// then the numbering, as repairing damaged archives may open gaps.
+func (v *verifier) run() error {
+	s := v.set
+	if _, err := os.Lstat(s.path + ".rotating"); err == nil {
+		v.staged = true
+		// the data must not be lost, so leave it to the Writer
+		err = v.report(s.path+".rotating", "interrupted rotation, "+
+			"completed when the log file is next opened by logrot", nil)
+		if err != nil {
+			return err
+		}
+	}
+	err := v.checkLeftovers()
+	if err != nil {
+		return err
+	}
+	if v.perm == 0 {
+		fi, err := os.Stat(s.path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			v.perm = fi.Mode().Perm()
+		}
+	}
+	nums, err := s.numbers()
+	if err != nil {
+		return err
+	}
+	for _, n := range nums {
+		err := v.checkArchive(n)
+		if err != nil {
+			return err
+		}
+	}
+	return v.checkNumbering()
+}
+
+// checkLeftovers reports the temporary files left by interrupted
+// rotations and archivers beside the log file and archives.
+func (v *verifier) checkLeftovers() error {
+	s := v.set
+	dirs := []string{filepath.Dir(s.path)}
+	if d := filepath.Dir(s.base); d != dirs[0] {
+		dirs = append(dirs, d)
+	}
+	base := filepath.Base(s.base)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			name := e.Name()
+			leftover := strings.HasPrefix(name, base+".") &&
+				strings.HasSuffix(name, ".tmp")
+			if strings.HasPrefix(name, "."+base+".") {
+				// a link held for an Archiver
+				_, err := strconv.ParseUint(name[strings.LastIndex(name, ".")+1:], 10, 32)
+				leftover = err == nil
+			}
+			if !leftover {
+				continue
+			}
+			path := filepath.Join(dir, name)
+			err := v.report(path, "leftover temporary file", func() error {
+				return os.Remove(path)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkArchive checks that archive n is a complete gzip file which
+// matches any checksum file and has the expected permissions.
+func (v *verifier) checkArchive(n int) error {
+	name := v.set.archive(n)
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if v.perm != 0 && fi.Mode().Perm() != v.perm {
+		problem := fmt.Sprintf("permissions %04o, want %04o",
+			fi.Mode().Perm(), v.perm)
+		err := v.report(name, problem, func() error {
+			return os.Chmod(name, v.perm)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	problem, err := checkGzip(name)
+	if err != nil {
+		return err
+	}
+	if problem == "" {
+		problem, err = checkSidecar(name)
+		if err != nil {
+			return err
+		}
+	}
+	if problem == "" {
+		return nil
+	}
+	if n == 1 && v.staged {
+		// the interrupted rotation may have been writing it
+		return v.report(name, problem+", rewritten from "+
+			filepath.Base(v.set.path)+".rotating when the log file "+
+			"is next opened by logrot", nil)
+	}
+	return v.report(name, problem, func() error {
+		err := os.Rename(name, name+".corrupt")
+		if err == nil {
+			err = os.Remove(name + ".sha256")
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+		return err
+	})
+}
+
+// checkGzip decompresses the gzip file name, which verifies the
+// checksum of each member, and describes any damage found.
+func checkGzip(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err == nil {
+		_, err = io.Copy(io.Discard, zr)
+	}
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		return "truncated gzip file", nil
+	case err == gzip.ErrChecksum:
+		return "gzip checksum mismatch", nil
+	case err == gzip.ErrHeader:
+		return "not a gzip file", nil
+	case err != nil:
+		if _, ok := err.(*os.PathError); ok {
+			return "", err
+		}
+		return "corrupt gzip file: " + err.Error(), nil
+	}
+	return "", nil
+}
+
+// checkSidecar compares the archive name with its checksum file, if
+// any, describing any mismatch.
+func checkSidecar(name string) (string, error) {
+	want, err := os.ReadFile(name + ".sha256")
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	fields := bytes.Fields(want)
+	if len(fields) == 0 || string(fields[0]) != hex.EncodeToString(h.Sum(nil)) {
+		return "SHA-256 does not match " + filepath.Base(name) + ".sha256", nil
+	}
+	return "", nil
+}
+
+// checkNumbering reports gaps in the numbers of the archives, which
+// are closed by renumbering them in order from 1.
+func (v *verifier) checkNumbering() error {
+	s := v.set
+	nums, err := s.numbers()
+	if err != nil {
+		return err
+	}
+	for i, n := range nums {
+		if n == i+1 {
+			continue
+		}
+		problem := fmt.Sprintf("gap in numbering: archive %d is missing", i+1)
+		return v.report(s.archive(n), problem, func() error {
+			// renaming in ascending order never overwrites an archive
+			for i, n := range nums {
+				if n == i+1 {
+					continue
+				}
+				err := renameArchive(s.archive(n), s.archive(i+1))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return nil
+}
+
+// renameArchive renames the archive from to to, along with any
+// checksum file.
+func renameArchive(from, to string) error {
+	err := os.Rename(from, to)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(from+".sha256", to+".sha256")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,247 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Compact merges runs of consecutive archives of the log file path
+// into archives of up to target bytes each, as Writer.Compact does,
+// with the settings of a Writer of path in opts. It must not be used
+// while a Writer has path open, for which Writer.Compact is used
+// instead.
+func Compact(path string, target int64, opts *Options) error {
+	wc := &Writer{path: path, fs: osFS{}, archives: -1}
+	if opts != nil {
+		wc.opts = *opts
+	}
+	if wc.opts.FS != nil {
+		wc.fs = wc.opts.FS
+	}
+	if wc.opts.Durable {
+		wc.opts.SyncOnRotate = true
+		wc.opts.SyncDir = true
+	}
+	wc.clock = wc.opts.Clock
+	if wc.clock == nil {
+		wc.clock = systemClock{}
+	}
+	wc.archiveBase = archiveBase(path, wc.opts.ArchiveDir)
+	wc.archiveExt = ".gz"
+	if wc.opts.Encrypter != nil {
+		wc.archiveExt += wc.opts.Encrypter.Ext()
+	}
+	// the merged archives keep the permissions of the newest
+	wc.perm = 0644
+	if fi, err := wc.fs.Stat(wc.archiveName(1)); err == nil {
+		wc.perm = fi.Mode().Perm()
+	}
+	return wc.compact(target)
+}
+
+// Compact merges each run of consecutive archives, such as those left
+// by frequent rotations, whose total size is at most target bytes
+// into one archive, and renumbers the archives to close the gaps, so
+// that fewer files hold the same data in the same order. A merged
+// archive is the gzip members of its archives one after another,
+// which readers of gzip files decompress as the concatenation of
+// their data, so nothing is decompressed. Checksum files and the
+// manifest are updated to match. Rotations wait for Compact to
+// complete but writes do not. Archives cannot be compacted if
+// Options.Encrypter is set.
+func (wc *Writer) Compact(target int64) error {
+	wc.mu.Lock()
+	if wc.closed {
+		wc.mu.Unlock()
+		return errors.New("logrot: Writer is closed")
+	}
+	err := wc.lockRotation()
+	wc.mu.Unlock()
+	if err == nil {
+		err = wc.compact(target)
+	}
+	wc.unlockRotation()
+	return err
+}
+
+// compact performs the work of Compact. The rotation lock must be
+// held.
+func (wc *Writer) compact(target int64) error {
+	if wc.opts.Encrypter != nil {
+		return errors.New("logrot: encrypted archives cannot be compacted")
+	}
+	if target < 1 {
+		return errors.New("logrot: target < 1")
+	}
+	n, err := wc.lastArchive()
+	if err != nil {
+		return err
+	}
+	sizes := make([]int64, n+1)
+	for i := 1; i <= n; i++ {
+		fi, err := wc.fs.Stat(wc.archiveName(i))
+		if err != nil {
+			return err
+		}
+		sizes[i] = fi.Size()
+	}
+	var m *Manifest
+	entries := make(map[int]ManifestEntry)
+	if wc.opts.Manifest {
+		m, err = readManifest(wc.fs, manifestName(wc.path, wc.opts.ArchiveDir))
+		if err != nil {
+			m = &Manifest{}
+		}
+		for _, e := range m.Archives {
+			if i, ok := wc.archiveNumber(e.Archive); ok && i <= n && e.Size == sizes[i] {
+				entries[i] = e
+			}
+		}
+		m.Archives = nil
+	}
+	// forget n until the archives are renumbered
+	wc.archives = -1
+	j := 0 // number of the archive being made
+	for a := 1; a <= n; {
+		// archives a to b, newest to oldest, become archive j
+		b, total := a, sizes[a]
+		for b < n && total+sizes[b+1] <= target {
+			b++
+			total += sizes[b]
+		}
+		j++
+		e, ok := entries[a]
+		if b > a {
+			var sum []byte
+			sum, err = wc.mergeArchives(a, b)
+			if err != nil {
+				return err
+			}
+			e, ok = mergeEntries(entries, a, b)
+			e.SHA256 = hex.EncodeToString(sum)
+			e.Size = total
+			e.Created = wc.clock.Now()
+		}
+		if a != j {
+			err = wc.renameArchive(wc.archiveName(a), wc.archiveName(j))
+			if err != nil {
+				return err
+			}
+		}
+		if m != nil && ok {
+			e.Archive = wc.archiveName(j)
+			m.Archives = append(m.Archives, e)
+		}
+		a = b + 1
+	}
+	wc.archives = j
+	if m != nil {
+		err = wc.writeManifest(m)
+		if err != nil {
+			return err
+		}
+	}
+	if wc.opts.SyncDir {
+		return syncDir(wc.fs, filepath.Dir(wc.archiveBase))
+	}
+	return nil
+}
+
+// mergeArchives replaces archive a with the concatenation of archives
+// b to a, oldest first, and removes archives a+1 to b, returning the
+// SHA-256 checksum of the new archive. Should it be interrupted, the
+// data of the archives removed is duplicated, never lost.
+func (wc *Writer) mergeArchives(a, b int) ([]byte, error) {
+	name := wc.archiveName(a)
+	tmp := name + ".tmp"
+	w, err := wc.fs.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, wc.archivePerm())
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	out := io.MultiWriter(w, h)
+	for i := b; i >= a && err == nil; i-- {
+		var f File
+		f, err = open(wc.fs, wc.archiveName(i))
+		if err == nil {
+			_, err = copyBuffer(out, f)
+			_ = f.Close()
+		}
+	}
+	if err == nil && wc.opts.SyncOnRotate {
+		err = w.Sync()
+	}
+	if e := w.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = wc.setAttrs(tmp, wc.archivePerm())
+	}
+	if err == nil {
+		err = wc.rename(tmp, name)
+	}
+	if err != nil {
+		_ = wc.fs.Remove(tmp)
+		return nil, err
+	}
+	sum := h.Sum(nil)
+	if wc.opts.Checksums {
+		err = wc.writeSidecar(name, sum)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := a + 1; i <= b; i++ {
+		err = wc.removeArchive(wc.archiveName(i))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return sum, nil
+}
+
+// mergeEntries returns the manifest entry of the archive merged from
+// archives a to b, reporting whether all of them had an entry.
+func mergeEntries(entries map[int]ManifestEntry, a, b int) (ManifestEntry, bool) {
+	for i := a; i <= b; i++ {
+		if _, ok := entries[i]; !ok {
+			return ManifestEntry{}, false
+		}
+	}
+	e, oldest := entries[a], entries[b]
+	e.Start = oldest.Start
+	e.From = oldest.From
+	e.First = nil
+	for i := b; i >= a && e.First == nil; i-- {
+		e.First = entries[i].First
+	}
+	for i := a; i <= b && e.Last == nil; i++ {
+		e.Last = entries[i].Last
+	}
+	return e, true
+}
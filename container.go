@@ -0,0 +1,183 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxContainerLine is the longest line a ContainerWriter writes as a
+// single record, as for Docker and containerd.
+const maxContainerLine = 16 << 10
+
+// ContainerFormat is the format of the records written by a
+// ContainerWriter.
+type ContainerFormat int
+
+const (
+	// DockerJSON is the format of Docker's json-file logging driver,
+	// a JSON object per line such as
+	//	{"log":"message\n","stream":"stdout","time":"2006-01-02T15:04:05.999999999Z"}
+	// where a line split for length is written without its newline.
+	DockerJSON ContainerFormat = iota
+
+	// CRI is the format of the Kubernetes Container Runtime
+	// Interface, read by the kubelet and node agents, a line such as
+	//	2006-01-02T15:04:05.999999999Z stdout F message
+	// where P in place of F marks part of a line split for length.
+	CRI
+)
+
+// ContainerWriter writes the output streams of a container, such as
+// "stdout" and "stderr", to a Writer as a container runtime writes its
+// log files, so that collectors built for those files can read the
+// Writer's files. Each line of each stream becomes a record stamped
+// with the time it was completed, a line longer than 16KiB being
+// split into several. The Writer should be opened without options
+// which change the data, such as TimestampFormat.
+type ContainerWriter struct {
+	wc     *Writer
+	format ContainerFormat
+
+	mu    sync.Mutex        // guards parts
+	parts map[string][]byte // the unended line of each stream
+}
+
+// NewContainerWriter returns a ContainerWriter writing records in
+// format to wc.
+func NewContainerWriter(wc *Writer, format ContainerFormat) *ContainerWriter {
+	return &ContainerWriter{
+		wc:     wc,
+		format: format,
+		parts:  make(map[string][]byte),
+	}
+}
+
+// Stream returns an io.Writer writing to the stream name of cw, such
+// as to be used as a command's Stdout.
+func (cw *ContainerWriter) Stream(name string) io.Writer {
+	return &containerStream{cw: cw, name: name}
+}
+
+// containerStream is an io.Writer returned by Stream.
+type containerStream struct {
+	cw   *ContainerWriter
+	name string
+}
+
+func (s *containerStream) Write(p []byte) (int, error) {
+	return s.cw.WriteStream(s.name, p)
+}
+
+// WriteStream writes p to the stream named stream. The records of the
+// lines it completes are written to the Writer with a single Write,
+// and the rest of p is kept until the line is ended, reaches 16KiB or
+// Flush is called.
+func (cw *ContainerWriter) WriteStream(stream string, p []byte) (int, error) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	data := p
+	if part := cw.parts[stream]; len(part) > 0 {
+		data = append(part, p...)
+	}
+	now := cw.wc.clock.Now()
+	var out []byte
+	for len(data) > 0 {
+		n, partial := len(data), true
+		if i := bytes.IndexByte(data, '\n'); i != -1 {
+			n, partial = i+1, false
+		}
+		if partial && n < maxContainerLine {
+			break
+		}
+		if n > maxContainerLine {
+			n, partial = maxContainerLine, true
+		}
+		out = cw.appendRecord(out, stream, data[:n], partial, now)
+		data = data[n:]
+	}
+	if len(data) > 0 {
+		cw.parts[stream] = append([]byte(nil), data...)
+	} else {
+		delete(cw.parts, stream)
+	}
+	if len(out) > 0 {
+		_, err := cw.wc.Write(out)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes the part of a line not yet ended of each stream as a
+// record of its own, as when the container exits.
+func (cw *ContainerWriter) Flush() error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	streams := make([]string, 0, len(cw.parts))
+	for s := range cw.parts {
+		streams = append(streams, s)
+	}
+	sort.Strings(streams)
+	now := cw.wc.clock.Now()
+	var out []byte
+	for _, s := range streams {
+		out = cw.appendRecord(out, s, cw.parts[s], true, now)
+		delete(cw.parts, s)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	_, err := cw.wc.Write(out)
+	return err
+}
+
+// appendRecord appends to b the record of line of stream, written at
+// now, which is partial if it does not end the line.
+func (cw *ContainerWriter) appendRecord(b []byte, stream string, line []byte, partial bool, now time.Time) []byte {
+	if cw.format == CRI {
+		b = now.UTC().AppendFormat(b, time.RFC3339Nano)
+		b = append(b, ' ')
+		b = append(b, stream...)
+		if partial {
+			b = append(b, " P "...)
+		} else {
+			b = append(b, " F "...)
+			line = line[:len(line)-1]
+		}
+		b = append(b, line...)
+		return append(b, '\n')
+	}
+	rec, _ := json.Marshal(struct {
+		Log    string `json:"log"`
+		Stream string `json:"stream"`
+		Time   string `json:"time"`
+	}{string(line), stream, now.UTC().Format(time.RFC3339Nano)})
+	b = append(b, rec...)
+	return append(b, '\n')
+}
@@ -0,0 +1,55 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import "log/slog"
+
+// checkTruncated adopts the size of the log file if another program,
+// such as logrotate with copytruncate, has truncated it since the last
+// write, so that writes continue at its new end rather than leaving a
+// hole of zero bytes where the copied data was.
+func (wc *Writer) checkTruncated() error {
+	fi, err := wc.file.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+	if size >= wc.size {
+		return nil
+	}
+	lastNewline, err := wc.findLastSplit(wc.file, size)
+	if err != nil {
+		return err
+	}
+	wc.size = size
+	wc.lastNewline = lastNewline
+	wc.headerEnd = 0
+	wc.midLine = lastNewline != size-1
+	wc.diag(slog.LevelInfo, "logrot: log file truncated by another program",
+		"size", size)
+	wc.emit(Truncated, wc.path, Rotation{}, nil)
+	if wc.mirror != nil {
+		// the mirror holds data no longer in the log file
+		wc.openMirror()
+	}
+	return wc.writeHeader()
+}
@@ -0,0 +1,147 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import "bytes"
+
+// lastDelim returns the index in p of the last byte of the last
+// delimiter ending within p, or -1 if there is none. The delimiter
+// may begin in the log file, whose end p is taken to follow. In raw
+// mode every byte ends a delimiter.
+func (wc *Writer) lastDelim(p []byte) (int, error) {
+	switch len(wc.delim) {
+	case 0:
+		return len(p) - 1, nil
+	case 1:
+		return bytes.LastIndexByte(p, wc.delim[0]), nil
+	}
+	if i := bytes.LastIndex(p, wc.delim); i != -1 {
+		return i + len(wc.delim) - 1, nil
+	}
+	for j := len(wc.delim) - 2; j >= 0; j-- {
+		ok, err := wc.straddles(p, j)
+		if ok || err != nil {
+			return j, err
+		}
+	}
+	return -1, nil
+}
+
+// firstDelim is like lastDelim but returns the first delimiter whose
+// last byte is at index from or later.
+func (wc *Writer) firstDelim(p []byte, from int) (int, error) {
+	switch len(wc.delim) {
+	case 0:
+		if from < len(p) {
+			return from, nil
+		}
+		return -1, nil
+	case 1:
+		if i := bytes.IndexByte(p[from:], wc.delim[0]); i != -1 {
+			return from + i, nil
+		}
+		return -1, nil
+	}
+	k := len(wc.delim) - 1
+	for j := from; j < k; j++ {
+		ok, err := wc.straddles(p, j)
+		if ok || err != nil {
+			return j, err
+		}
+	}
+	start := from - k
+	if start < 0 {
+		start = 0
+	}
+	if i := bytes.Index(p[start:], wc.delim); i != -1 {
+		return start + i + k, nil
+	}
+	return -1, nil
+}
+
+// straddles reports whether a delimiter begins in the log file and
+// ends at p[j]. It reads the end of the log file only if p[:j+1]
+// matches the end of the delimiter.
+func (wc *Writer) straddles(p []byte, j int) (bool, error) {
+	n := len(wc.delim) - 1 - j // bytes of the delimiter in the file
+	if j >= len(p) || int64(n) > wc.size ||
+		!bytes.Equal(p[:j+1], wc.delim[n:]) {
+		return false, nil
+	}
+	head := make([]byte, n)
+	err := readAt(wc.file, head, wc.size-int64(n))
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(head, wc.delim[:n]), nil
+}
+
+// writeLimited is like writeSplit but ends any record longer than
+// MaxLineBytes, not counting its delimiter, by writing LineMarker and
+// the delimiter after MaxLineBytes bytes. It returns the number of
+// bytes of p written.
+func (wc *Writer) writeLimited(p []byte) (int, error) {
+	max := int64(wc.opts.MaxLineBytes)
+	bw := 0
+	for len(p) > 0 {
+		// bytes of the current record already in the file
+		written := wc.size - wc.lastNewline - 1
+		i, err := wc.firstDelim(p, 0)
+		if err != nil {
+			return bw, err
+		}
+		end := len(p) // end of the current record within p
+		content := written + int64(end)
+		if i != -1 {
+			end = i + 1
+			content = written + int64(end-len(wc.delim))
+		}
+		// an existing record which is already too long, as may be
+		// found at Open, is left alone if p merely ends it
+		split := content > max && content > written
+		if split {
+			end = 0
+			if written < max {
+				end = int(max - written)
+			}
+		}
+		n, err := wc.writeSplit(p[:end])
+		bw += n
+		if err != nil {
+			return bw, err
+		}
+		p = p[end:]
+		if split && wc.fallback == nil {
+			mark := append(append([]byte(nil), wc.opts.LineMarker...), wc.delim...)
+			_, err = wc.writeSplit(mark)
+			if err != nil {
+				return bw, err
+			}
+		}
+		if wc.fallback != nil {
+			// writeSplit switched to FallbackPath
+			n, err := wc.writeFallback(p)
+			return bw + n, err
+		}
+	}
+	return bw, nil
+}
@@ -0,0 +1,37 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import "io"
+
+// Encrypter encrypts archives. The packages xi2.org/x/logrot/agerot
+// and xi2.org/x/logrot/pgprot provide Encrypters.
+type Encrypter interface {
+	// Encrypt returns a writer which encrypts the data written to
+	// it and writes the result to w. Close must flush the encrypted
+	// data but not close w.
+	Encrypt(w io.Writer) (io.WriteCloser, error)
+
+	// Ext returns the extension added to the names of encrypted
+	// archives after ".gz", such as ".age".
+	Ext() string
+}
@@ -0,0 +1,40 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+// isCrossDevice reports whether err is from renaming a file to a
+// different file system. Plan 9 has no such error.
+func isCrossDevice(err error) bool {
+	return false
+}
+
+// isNoSpace reports whether err is from a file system being full.
+// Plan 9 errors are strings which are not checked.
+func isNoSpace(err error) bool {
+	return false
+}
+
+// isReadOnly reports whether err is from a file system being
+// read-only. Plan 9 errors are strings which are not checked.
+func isReadOnly(err error) bool {
+	return false
+}
@@ -0,0 +1,53 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows error codes not defined by package syscall.
+const (
+	errorNotSameDevice  syscall.Errno = 17  // ERROR_NOT_SAME_DEVICE
+	errorWriteProtect   syscall.Errno = 19  // ERROR_WRITE_PROTECT
+	errorHandleDiskFull syscall.Errno = 39  // ERROR_HANDLE_DISK_FULL
+	errorDiskFull       syscall.Errno = 112 // ERROR_DISK_FULL
+)
+
+// isCrossDevice reports whether err is from renaming a file to a
+// different file system.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
+
+// isNoSpace reports whether err is from a file system being full.
+func isNoSpace(err error) bool {
+	return errors.Is(err, errorDiskFull) ||
+		errors.Is(err, errorHandleDiskFull)
+}
+
+// isReadOnly reports whether err is from a volume being
+// write-protected.
+func isReadOnly(err error) bool {
+	return errors.Is(err, errorWriteProtect)
+}
@@ -0,0 +1,146 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultEventBuffer is used when Options.EventBuffer is zero or
+// less.
+const defaultEventBuffer = 64
+
+// EventKind is the kind of an Event.
+type EventKind int
+
+const (
+	// Rotated is sent after every rotation attempt, as OnRotate is
+	// called.
+	Rotated EventKind = iota
+	// ArchiveDeleted is sent when an archive is deleted, whether
+	// expired by maxFiles or purged.
+	ArchiveDeleted
+	// WriteError is sent when a write fails, after which the Writer
+	// fails from then on.
+	WriteError
+	// Reopened is sent when the log file is reopened, as when it has
+	// been moved away or closed by IdleClose.
+	Reopened
+	// ShadowError is sent when writing to, rotating or opening the
+	// shadow of the log file fails, after which the Writer carries
+	// on without it, see Options.ShadowPath.
+	ShadowError
+	// Truncated is sent when the log file is found to have been
+	// truncated by another program, see Options.CopyTruncate.
+	Truncated
+)
+
+// String returns the name of k, such as "Rotated".
+func (k EventKind) String() string {
+	switch k {
+	case Rotated:
+		return "Rotated"
+	case ArchiveDeleted:
+		return "ArchiveDeleted"
+	case WriteError:
+		return "WriteError"
+	case Reopened:
+		return "Reopened"
+	case ShadowError:
+		return "ShadowError"
+	case Truncated:
+		return "Truncated"
+	}
+	return "EventKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Event is something which happened to a Writer, as received from
+// Writer.Events.
+type Event struct {
+	Kind     EventKind
+	Time     time.Time // when it happened
+	Path     string    // the archive deleted, the shadow or the log file
+	Rotation Rotation  // the rotation, for Rotated
+	Err      error     // the error, for WriteError, ShadowError and a failed rotation
+}
+
+// eventState is the channel returned by Events.
+type eventState struct {
+	mu      sync.Mutex // guards the fields below and sending on c
+	c       chan Event // nil until Events is called
+	closed  bool
+	dropped int64 // events discarded, accessed atomically
+}
+
+// Events returns a channel receiving the Events of wc, as an
+// alternative to OnRotate for an application which would rather
+// select on a channel. Only events after the first call are sent. The
+// channel has a buffer of Options.EventBuffer events, 64 by default,
+// and an event is discarded, counting it in Stats.EventsDropped,
+// rather than block the Writer when it is full. The channel is closed
+// by Close, and every call returns the same channel.
+func (wc *Writer) Events() <-chan Event {
+	e := &wc.events
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.c == nil {
+		n := wc.opts.EventBuffer
+		if n <= 0 {
+			n = defaultEventBuffer
+		}
+		e.c = make(chan Event, n)
+		if e.closed {
+			close(e.c)
+		}
+	}
+	return e.c
+}
+
+// emit sends the event of kind k concerning path to the channel
+// returned by Events, if it has been called and wc is not closed.
+func (wc *Writer) emit(k EventKind, path string, r Rotation, err error) {
+	e := &wc.events
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.c == nil || e.closed {
+		return
+	}
+	select {
+	case e.c <- Event{Kind: k, Time: wc.clock.Now(), Path: path, Rotation: r, Err: err}:
+	default:
+		atomic.AddInt64(&e.dropped, 1)
+	}
+}
+
+// closeEvents closes the channel returned by Events, for Close.
+func (wc *Writer) closeEvents() {
+	e := &wc.events
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.closed && e.c != nil {
+		close(e.c)
+	}
+	e.closed = true
+}
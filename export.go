@@ -0,0 +1,109 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+// ExportOptions are the settings of Writer.ExportTo.
+type ExportOptions struct {
+	// Range limits the history exported. Data written before
+	// Range.From is skipped as by Reader.SeekToTime. If
+	// Options.Timestamp is set, the export also stops at the first
+	// line with a time after Range.To, which is otherwise ignored.
+	Range TimeRange
+
+	// Compress, if true, gzips the exported stream.
+	Compress bool
+}
+
+// ExportTo writes the whole history of the log file to w, as read by
+// OpenReader, for including in a support bundle and the like. No
+// rotation takes place while it runs, so the history is exported
+// exactly, but a write which fills the log file waits until it
+// completes. It fails if Encrypter is set.
+func (wc *Writer) ExportTo(w io.Writer, opts *ExportOptions) error {
+	var o ExportOptions
+	if opts != nil {
+		o = *opts
+	}
+	wc.rotMu.Lock()
+	defer wc.rotMu.Unlock()
+	r, err := OpenReaderWithOptions(wc.path, &wc.opts)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if !o.Range.From.IsZero() {
+		err = r.SeekToTime(o.Range.From)
+		if err != nil {
+			return err
+		}
+	}
+	out := w
+	var gw *gzip.Writer
+	if o.Compress {
+		gw = gzip.NewWriter(w)
+		out = gw
+	}
+	if o.Range.To.IsZero() || wc.opts.Timestamp == nil {
+		_, err = copyBuffer(out, r)
+	} else {
+		err = copyUntil(out, r, o.Range.To, wc.opts.Timestamp)
+	}
+	if gw != nil {
+		if e := gw.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// copyUntil copies the lines read from r to w up to the first with a
+// time after to, found by timestamp.
+func copyUntil(w io.Writer, r io.Reader, to time.Time, timestamp func(line []byte) (time.Time, bool)) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			t, ok := timestamp(bytes.TrimSuffix(line, []byte("\n")))
+			if ok && t.After(to) {
+				return nil
+			}
+			_, werr := w.Write(line)
+			if werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
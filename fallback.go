@@ -0,0 +1,125 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// defaultFallbackRetry is used when Options.FallbackRetry is zero.
+const defaultFallbackRetry = 10 * time.Second
+
+// failOver handles err, which occurred while writing p to the log
+// file after bw bytes of the current Write had been written. If
+// FallbackPath is set and err shows that the log file has become
+// unwritable, the remainder of the write, rest, goes to the fallback
+// file and Write succeeds. Otherwise err is returned.
+func (wc *Writer) failOver(bw int, rest []byte, err error) (int, error) {
+	if wc.opts.FallbackPath == "" || !isUnwritable(err) {
+		return bw, err
+	}
+	f, e := wc.fs.OpenFile(wc.opts.FallbackPath,
+		os.O_WRONLY|os.O_APPEND|os.O_CREATE, wc.perm)
+	if e != nil {
+		return bw, err
+	}
+	now := wc.clock.Now()
+	_, e = f.Write(wc.record("logrot: %s: writing here as %s is unwritable: %v",
+		now.Format(time.RFC3339), wc.path, err))
+	if e != nil {
+		_ = f.Close()
+		return bw, err
+	}
+	wc.diag(slog.LevelWarn, "logrot: writing to fallback file",
+		"fallback", wc.opts.FallbackPath, "error", err)
+	wc.fallback = f
+	wc.fallbackStart = now
+	wc.fallbackBytes = 0
+	wc.lastRetry = now
+	n, err := wc.writeFallback(rest)
+	return bw + n, err
+}
+
+// record returns the formatted text ended by the delimiter.
+func (wc *Writer) record(format string, a ...interface{}) []byte {
+	return append([]byte(fmt.Sprintf(format, a...)), wc.delim...)
+}
+
+// lineBreak returns a copy of the delimiter if the log file ends part
+// way through a record and nil otherwise.
+func (wc *Writer) lineBreak() []byte {
+	if wc.size > 0 && wc.lastNewline != wc.size-1 || len(wc.livePart) > 0 {
+		return append([]byte(nil), wc.delim...)
+	}
+	return nil
+}
+
+// isUnwritable reports whether err shows that a file can no longer be
+// written, because of its permissions or a read-only file system.
+func isUnwritable(err error) bool {
+	return os.IsPermission(err) || isReadOnly(err)
+}
+
+// writeFallback writes p to the fallback file.
+func (wc *Writer) writeFallback(p []byte) (int, error) {
+	n, err := wc.fallback.Write(p)
+	wc.fallbackBytes += int64(n)
+	wc.stats.BytesWritten += int64(n)
+	return n, err
+}
+
+// switchBack returns to writing to the log file if it has become
+// writable again, adding a line to it which records the gap. It
+// does nothing if it was last called less than FallbackRetry ago and
+// reports whether the log file is in use.
+func (wc *Writer) switchBack() bool {
+	retry := wc.opts.FallbackRetry
+	if retry == 0 {
+		retry = defaultFallbackRetry
+	}
+	now := wc.clock.Now()
+	if now.Sub(wc.lastRetry) < retry {
+		return false
+	}
+	wc.lastRetry = now
+	if wc.reopen() != nil {
+		return false
+	}
+	marker := append(wc.lineBreak(), wc.record(
+		"logrot: %s: %d bytes were written to %s from %s while this file was unwritable",
+		now.Format(time.RFC3339), wc.fallbackBytes, wc.opts.FallbackPath,
+		wc.fallbackStart.Format(time.RFC3339))...)
+	n, err := wc.writeData(marker)
+	wc.size += int64(n)
+	if err != nil {
+		return false
+	}
+	wc.lastNewline = wc.size - 1
+	_ = wc.fallback.Close()
+	wc.fallback = nil
+	wc.diag(slog.LevelInfo, "logrot: log file writable again",
+		"fallback", wc.opts.FallbackPath, "bytes", wc.fallbackBytes)
+	return true
+}
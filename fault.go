@@ -0,0 +1,69 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import "os"
+
+// FaultOp is an operation at which Options.Fault can inject a failure.
+type FaultOp int
+
+const (
+	// FaultWrite is a write to the log file, by Write or by a
+	// rotation moving the data after the last newline.
+	FaultWrite FaultOp = iota
+	// FaultGzipClose is the flush of the gzip stream which
+	// completes an archive.
+	FaultGzipClose
+	// FaultRename is the renaming of any file, such as of an archive
+	// while the archives are shifted.
+	FaultRename
+	// FaultTruncate is the truncation of the log file during a
+	// rotation.
+	FaultTruncate
+)
+
+// fault returns the failure injected by Options.Fault for op on the
+// file name, if any.
+func (wc *Writer) fault(op FaultOp, name string) error {
+	if wc.opts.Fault == nil {
+		return nil
+	}
+	return wc.opts.Fault(op, name)
+}
+
+// rename renames oldpath to newpath on the Writer's FS unless
+// Options.Fault injects a failure.
+func (wc *Writer) rename(oldpath, newpath string) error {
+	if err := wc.fault(FaultRename, oldpath); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	return wc.fs.Rename(oldpath, newpath)
+}
+
+// truncate changes the size of the log file unless Options.Fault
+// injects a failure.
+func (wc *Writer) truncate(size int64) error {
+	if err := wc.fault(FaultTruncate, wc.path); err != nil {
+		return &os.PathError{Op: "truncate", Path: wc.path, Err: err}
+	}
+	return truncateFile(wc.file, size)
+}
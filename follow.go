@@ -0,0 +1,477 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// followInterval is how often a Follower checks for new data.
+const followInterval = 250 * time.Millisecond
+
+// Follower reads the data written to a log file from the time it was
+// created, following the log file across rotations. When a rotation
+// moves data not yet read into new archives, the Follower reads it
+// from them before going on with the log file, so that nothing is
+// missed or repeated at the boundary. A log file which shrinks without
+// a new archive, as when maxFiles is 1, is read again from its start.
+//
+// Data can only be missed or repeated if so many rotations happen
+// between checks, made every quarter second, that the newest archive
+// the Follower knew of is removed.
+//
+// A Follower reads the Header and Footer lines along with the data,
+// but to find the boundary it must know of them, so a log file written
+// with Header or Footer set must be followed with FollowWithOptions
+// and the same options. The Follower skips the Footer of an archive,
+// and the Header of the file after it, if it has already read data
+// which the rotation carried past them.
+type Follower struct {
+	fs     FS
+	clock  Clock
+	path   string
+	base   string // archive names less ".<n>.gz"
+	delim  []byte // the delimiter which ends each record
+	header bool   // each file starts with a Header
+	footer bool   // each archive ends with a Footer
+
+	mu         sync.Mutex  // held by Read
+	pos        int64       // bytes read from the log file
+	skipHeader bool        // pos does not yet count the next Header
+	first      os.FileInfo // archive 1 when last checked, or nil
+	queue      []io.Reader // data to read before checking again
+	files      []File      // files opened for queue
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// Follow returns a Follower of the log file at path, starting at its
+// current end, which reads archives beside the log file.
+func Follow(path string) (*Follower, error) {
+	return FollowWithOptions(path, nil)
+}
+
+// FollowWithOptions is like Follow but reads archives in
+// opts.ArchiveDir, if set, through opts.FS, if set, and waits for new
+// data with opts.Clock, if set. It takes the Header and Footer lines
+// into account as the Writer adds them with opts.Header, opts.Footer,
+// opts.Delimiter, opts.CRLF and opts.Raw. The other options are
+// ignored, except that it fails if opts.Encrypter is set, as the
+// archives cannot be decrypted, or opts.CompressLive, as the log file
+// cannot be read as it is written.
+func FollowWithOptions(path string, opts *Options) (*Follower, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Encrypter != nil {
+		return nil, errors.New("logrot: archives are encrypted")
+	}
+	if o.CompressLive {
+		return nil, errors.New("logrot: log file is compressed")
+	}
+	f := &Follower{
+		fs:     o.FS,
+		clock:  o.Clock,
+		path:   path,
+		base:   archiveBase(path, o.ArchiveDir),
+		delim:  []byte{'\n'},
+		header: o.Header != "" && !o.Raw,
+		footer: o.Footer != "" && !o.Raw,
+		stop:   make(chan struct{}),
+	}
+	switch {
+	case len(o.Delimiter) > 0:
+		f.delim = append([]byte(nil), o.Delimiter...)
+	case o.CRLF:
+		f.delim = []byte{'\r', '\n'}
+	}
+	if f.fs == nil {
+		f.fs = osFS{}
+	}
+	if f.clock == nil {
+		f.clock = systemClock{}
+	}
+	var err error
+	f.first, err = f.statArchive(1)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.fs.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		f.pos = fi.Size()
+	}
+	return f, nil
+}
+
+// Offset returns the number of bytes of the log file which have been
+// read, which is where the Follower started until data is read.
+func (f *Follower) Offset() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pos
+}
+
+// Read reads data written to the log file, waiting until there is
+// some. Once the Follower is closed it returns io.EOF.
+func (f *Follower) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for {
+		select {
+		case <-f.stop:
+			f.closeFiles()
+			return 0, io.EOF
+		default:
+		}
+		for len(f.queue) > 0 {
+			n, err := f.queue[0].Read(p)
+			if err == errRotated {
+				// check again once the rotation is complete
+				f.closeFiles()
+				break
+			}
+			if err == io.EOF {
+				f.queue = f.queue[1:]
+				err = nil
+			}
+			if len(f.queue) == 0 {
+				f.closeFiles()
+			}
+			if n > 0 || err != nil {
+				return n, err
+			}
+		}
+		err := f.check()
+		if err != nil {
+			return 0, err
+		}
+		if len(f.queue) == 0 && !sleep(f.clock, followInterval, f.stop) {
+			f.closeFiles()
+			return 0, io.EOF
+		}
+	}
+}
+
+// Close stops the Follower, ending any Read in progress.
+func (f *Follower) Close() error {
+	f.closeOnce.Do(func() { close(f.stop) })
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closeFiles()
+	return nil
+}
+
+// closeFiles closes the files opened for f.queue and empties it.
+func (f *Follower) closeFiles() {
+	for _, file := range f.files {
+		_ = file.Close()
+	}
+	f.files = nil
+	f.queue = nil
+}
+
+// statArchive returns the FileInfo of archive n, or nil if it does not
+// exist.
+func (f *Follower) statArchive(n int) (os.FileInfo, error) {
+	fi, err := f.fs.Stat(fmt.Sprintf("%s.%d.gz", f.base, n))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return fi, err
+}
+
+// check queues any data added since the last check: the data after
+// f.pos moved by rotations into new archives, and the data after that
+// in the log file. Nothing is queued while a rotation is in progress.
+func (f *Follower) check() error {
+	if _, err := f.fs.Lstat(f.path + ".rotating"); err == nil {
+		return nil
+	}
+	first, err := f.statArchive(1)
+	if err != nil {
+		return err
+	}
+	if !sameArchive(first, f.first) {
+		err := f.queueRotated()
+		if err != nil {
+			f.closeFiles()
+			return err
+		}
+		f.first = first
+	}
+	file, err := open(f.fs, f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		f.closeFiles()
+		return err
+	}
+	fi, err := file.Stat()
+	if err == nil {
+		// a rotation since the archives were checked leaves
+		// nothing to go on from until it is complete
+		var rotating bool
+		rotating, err = f.rotating()
+		if err == nil && rotating {
+			_ = file.Close()
+			return nil
+		}
+	}
+	if err != nil {
+		_ = file.Close()
+		f.closeFiles()
+		return err
+	}
+	if fi.Size() < f.pos {
+		f.pos = 0
+		f.skipHeader = false
+	}
+	if f.skipHeader {
+		h, err := readRecord(bufio.NewReader(io.NewSectionReader(file, 0, fi.Size())), f.delim)
+		if err == io.EOF {
+			// the Header is not yet complete
+			_ = file.Close()
+			return nil
+		}
+		if err != nil {
+			_ = file.Close()
+			f.closeFiles()
+			return err
+		}
+		f.pos += int64(len(h))
+		f.skipHeader = false
+	}
+	f.files = append(f.files, file)
+	f.queue = append(f.queue, &followReader{f: f, file: file, end: fi.Size()})
+	return nil
+}
+
+// queueRotated queues the data after f.pos which rotations since
+// f.first was archive 1 moved into new archives. Each new archive took
+// the start of the log file, so f.pos is carried through them, leaving
+// the position in the log file to go on from.
+func (f *Follower) queueRotated() error {
+	k := 0 // the number of new archives
+	for {
+		fi, err := f.statArchive(k + 1)
+		if err != nil {
+			return err
+		}
+		if fi == nil || sameArchive(fi, f.first) {
+			break
+		}
+		k++
+	}
+	for n := k; n > 0; n-- {
+		name := fmt.Sprintf("%s.%d.gz", f.base, n)
+		file, err := open(f.fs, name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		f.files = append(f.files, file)
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("logrot: %s: %v", name, err)
+		}
+		var r io.Reader = zr
+		if f.skipHeader {
+			br := bufio.NewReader(zr)
+			h, err := readRecord(br, f.delim)
+			if err != nil && err != io.EOF {
+				return fmt.Errorf("logrot: %s: %v", name, err)
+			}
+			f.pos += int64(len(h))
+			f.skipHeader = false
+			r = io.MultiReader(bytes.NewReader(h), br)
+		}
+		r, err = f.skipArchive(r)
+		if err != nil {
+			return fmt.Errorf("logrot: %s: %v", name, err)
+		}
+		if r != nil {
+			f.queue = append(f.queue, r)
+		}
+	}
+	return nil
+}
+
+// skipArchive skips the first f.pos bytes of the data of an archive,
+// read from r. If they end before its Footer it returns the rest of
+// the data, Footer and all, and sets f.pos to 0. Otherwise it returns
+// nil and takes the data before the Footer from f.pos, leaving what
+// the rotation carried into the next file.
+func (f *Follower) skipArchive(r io.Reader) (io.Reader, error) {
+	c := &recordCounter{delim: f.delim}
+	skipped, err := io.CopyN(c, r, f.pos)
+	if err == io.EOF {
+		data := skipped
+		if f.footer && c.start == c.n {
+			data = c.prev
+		}
+		f.pos -= data
+		f.skipHeader = f.header
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.footer && f.pos > 0 {
+		// what is left may be no more than the Footer, or its end
+		br := bufio.NewReader(r)
+		rec, err := readRecord(br, f.delim)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if _, e := br.Peek(1); err == nil && e == io.EOF && c.start != c.n {
+			f.pos -= c.start
+			f.skipHeader = f.header
+			return nil, nil
+		}
+		r = io.MultiReader(bytes.NewReader(rec), br)
+	}
+	f.pos = 0
+	return r, nil
+}
+
+// readRecord reads from br up to and including the first delim. If br
+// ends first it returns what it read and io.EOF.
+func readRecord(br *bufio.Reader, delim []byte) ([]byte, error) {
+	var rec []byte
+	for {
+		b, err := br.ReadSlice(delim[len(delim)-1])
+		rec = append(rec, b...)
+		switch {
+		case err == nil && bytes.HasSuffix(rec, delim):
+			return rec, nil
+		case err != nil && err != bufio.ErrBufferFull:
+			return rec, err
+		}
+	}
+}
+
+// recordCounter counts the bytes written to it and finds where the
+// records among them start.
+type recordCounter struct {
+	delim []byte
+	n     int64  // bytes written
+	start int64  // offset of the record being written
+	prev  int64  // offset of the record before it
+	tail  []byte // the end of the data written, in which a delim may start
+}
+
+func (c *recordCounter) Write(p []byte) (int, error) {
+	buf := append(c.tail, p...)
+	base := c.n - int64(len(c.tail))
+	i := 0
+	for {
+		j := bytes.Index(buf[i:], c.delim)
+		if j == -1 {
+			break
+		}
+		i += j + len(c.delim)
+		c.prev, c.start = c.start, base+int64(i)
+	}
+	c.n += int64(len(p))
+	if t := len(buf) - len(c.delim) + 1; t > i {
+		i = t
+	}
+	c.tail = append([]byte(nil), buf[i:]...)
+	return len(p), nil
+}
+
+// rotating reports whether a rotation has begun since f.first was
+// archive 1.
+func (f *Follower) rotating() (bool, error) {
+	if _, err := f.fs.Lstat(f.path + ".rotating"); err == nil {
+		return true, nil
+	}
+	first, err := f.statArchive(1)
+	if err != nil {
+		return false, err
+	}
+	return !sameArchive(first, f.first), nil
+}
+
+// sameArchive reports whether a and b, either of which may be nil,
+// are the same archive.
+func sameArchive(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return sameFile(a, b) && a.ModTime().Equal(b.ModTime())
+}
+
+// errRotated is returned by followReader when a rotation may have
+// changed the log file under it.
+var errRotated = errors.New("logrot: log file rotated")
+
+// followReader reads the log file from f.pos up to end, advancing
+// f.pos by what is read. As a rotation may empty the log file and more
+// be written to it between its size being taken and the read, the
+// data read is only returned if no rotation has begun since, so that
+// f.pos stays right for reading the rest from the new archive.
+type followReader struct {
+	f    *Follower
+	file File
+	end  int64
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	if r.f.pos >= r.end {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.end-r.f.pos {
+		p = p[:r.end-r.f.pos]
+	}
+	n, err := r.file.ReadAt(p, r.f.pos)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	if n > 0 {
+		rotating, e := r.f.rotating()
+		switch {
+		case e != nil:
+			return 0, e
+		case rotating:
+			return 0, errRotated
+		}
+	}
+	r.f.pos += int64(n)
+	return n, err
+}
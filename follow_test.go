@@ -0,0 +1,139 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readFollower reads n bytes from f, failing the test if they do not
+// come in time.
+func readFollower(t *testing.T, f *Follower, n int) string {
+	t.Helper()
+	buf := make([]byte, n)
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(f, buf)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		f.Close()
+		<-done
+		t.Fatalf("Follower read %q, want %d bytes", strings.TrimRight(string(buf), "\x00"), n)
+	}
+	return string(buf)
+}
+
+// rotationSet returns the data of the archives of path, oldest first,
+// and then of path itself.
+func rotationSet(t *testing.T, path string) string {
+	t.Helper()
+	var all []byte
+	for n := 9; n > 0; n-- {
+		file, err := os.Open(fmt.Sprintf("%s.%d.gz", path, n))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(file)
+		if err == nil {
+			var data []byte
+			data, err = io.ReadAll(zr)
+			all = append(all, data...)
+		}
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(append(all, data...))
+}
+
+func TestFollowHeaderFooter(t *testing.T) {
+	for _, partial := range []string{"par", strings.Repeat("p", 200)} {
+		path := filepath.Join(t.TempDir(), "log")
+		opts := &Options{
+			Header: "# started after $prev",
+			Footer: "# continued in $next",
+		}
+		w, err := OpenWithOptions(path, 0600, 1000, 9, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := FollowWithOptions(path, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(w, "one\ntwo\n%s", partial)
+		if got, want := readFollower(t, f, 8+len(partial)), "one\ntwo\n"+partial; got != want {
+			t.Fatalf("read %q, want %q", got, want)
+		}
+		// the rotation carries the partial line, which has been
+		// read, past the Footer and the next Header
+		if err := w.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(w, "tial\nthree\n")
+		// the Follower reads this rotation's Footer and Header
+		if err := w.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(w, "four\n")
+		all := rotationSet(t, path)
+		want := all[strings.Index(all, "tial\n"):]
+		if got := readFollower(t, f, len(want)); got != want {
+			t.Errorf("partial line %d bytes: read %q, want %q", len(partial), got, want)
+		}
+		if strings.Count(want, "# continued") != 1 || strings.Count(want, "# started") != 1 {
+			t.Errorf("read %q, want one Footer and one Header", want)
+		}
+		f.Close()
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFollowCompressLive(t *testing.T) {
+	_, err := FollowWithOptions(filepath.Join(t.TempDir(), "log"), &Options{CompressLive: true})
+	if err == nil {
+		t.Error("FollowWithOptions succeeded with CompressLive")
+	}
+}
@@ -0,0 +1,206 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+)
+
+// FS is a file system on which a Writer keeps its files. Its methods
+// behave as the functions of the same names in package os. An FS
+// supplied in Options.FS, such as an in-memory file system, lets
+// rotation be tested quickly and hermetically and its failures be
+// simulated. If the FS also implements Link, as os.Link, it is used
+// to hand archives to an Archiver without copying them, except on
+// Windows.
+type FS interface {
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.DirEntry, error)
+	MkdirAll(path string, perm os.FileMode) error
+	Chmod(name string, mode os.FileMode) error
+	Chown(name string, uid, gid int) error
+}
+
+// File is an open file of an FS. Its methods behave as those of
+// os.File. Locking with LockFile and preallocation with Preallocate
+// only take effect on an *os.File.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.WriterAt
+	io.Seeker
+	io.Closer
+	Name() string
+	Stat() (os.FileInfo, error)
+	Sync() error
+	Truncate(size int64) error
+}
+
+// osFS is the FS of the operating system, used if Options.FS is nil.
+type osFS struct{}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		// avoid a non-nil File holding a nil *os.File
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (osFS) ReadDir(name string) ([]os.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (osFS) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (osFS) Chown(name string, uid, gid int) error {
+	return chown(name, uid, gid)
+}
+
+func (osFS) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+// open opens the file name on fsys for reading, as os.Open does.
+func open(fsys FS, name string) (File, error) {
+	return fsys.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// link makes newname a hard link to oldname, if fsys supports it.
+func link(fsys FS, oldname, newname string) error {
+	l, ok := fsys.(interface {
+		Link(oldname, newname string) error
+	})
+	if !ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname,
+			Err: errors.ErrUnsupported}
+	}
+	return l.Link(oldname, newname)
+}
+
+// readFile is os.ReadFile on fsys.
+func readFile(fsys FS, name string) ([]byte, error) {
+	f, err := open(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// writeFile is os.WriteFile on fsys.
+func writeFile(fsys FS, name string, data []byte, perm os.FileMode) error {
+	f, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// createTemp creates a new file in dir on fsys whose name is prefix
+// followed by a random string, as os.CreateTemp does.
+func createTemp(fsys FS, dir, prefix string) (File, error) {
+	for i := 0; ; i++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := fsys.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) && i < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// sameFile reports whether a and b describe the same file, as
+// os.SameFile does. For the files of an FS other than the operating
+// system's their Sys values must be equal and not nil.
+func sameFile(a, b os.FileInfo) bool {
+	if os.SameFile(a, b) {
+		return true
+	}
+	x, y := a.Sys(), b.Sys()
+	return x != nil && reflect.TypeOf(x).Comparable() && x == y
+}
+
+// readAt fills p from f at off. Unlike f.ReadAt it does not return
+// io.EOF if p is filled, which a File other than an *os.File may.
+func readAt(f File, p []byte, off int64) error {
+	n, err := f.ReadAt(p, off)
+	if err == io.EOF && n == len(p) {
+		err = nil
+	}
+	return err
+}
+
+// makeDirs creates the directories of the log file and archives if
+// MkdirAll is set.
+func (wc *Writer) makeDirs() error {
+	if !wc.opts.MkdirAll {
+		return nil
+	}
+	perm := wc.opts.DirPerm
+	if perm == 0 {
+		perm = 0755
+	}
+	err := wc.fs.MkdirAll(filepath.Dir(wc.path), perm)
+	if err == nil && wc.opts.ArchiveDir != "" {
+		err = wc.fs.MkdirAll(wc.opts.ArchiveDir, perm)
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Match is a line found by Grep.
+type Match struct {
+	File   string // the archive or log file holding the line
+	Offset int64  // offset of the line in the decompressed data of File
+	Line   []byte // the line without its newline
+}
+
+// TimeRange is a range of times from From to To inclusive. A zero
+// From or To leaves the range open at that end.
+type TimeRange struct {
+	From, To time.Time
+}
+
+// contains reports whether t is within tr.
+func (tr TimeRange) contains(t time.Time) bool {
+	return (tr.From.IsZero() || !t.Before(tr.From)) &&
+		(tr.To.IsZero() || !t.After(tr.To))
+}
+
+// Grep returns the lines of the history of the log file at path, as
+// read by OpenReader, for which match returns true, oldest first. A
+// regular expression's Match method may be used. The archives are
+// decompressed in parallel, so match must be safe to call from
+// several goroutines.
+//
+// Archives written before tr.From are skipped without being read. The
+// lines of the other files are only checked against tr if
+// Options.Timestamp is set, as for GrepWithOptions, when a line with
+// no time takes that of the line before it.
+func Grep(path string, match func(line []byte) bool, tr TimeRange) ([]Match, error) {
+	return GrepWithOptions(path, match, tr, nil)
+}
+
+// GrepWithOptions is like Grep but opens the files as
+// OpenReaderWithOptions does and checks the time of each line with
+// opts.Timestamp, if set.
+func GrepWithOptions(path string, match func(line []byte) bool, tr TimeRange, opts *Options) ([]Match, error) {
+	r, err := OpenReaderWithOptions(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var parts []readerPart
+	for _, p := range r.parts {
+		if p.modTime.IsZero() || tr.From.IsZero() || !p.modTime.Before(tr.From) {
+			parts = append(parts, p)
+		}
+	}
+	results := make([][]Match, len(parts))
+	errs := make([]error, len(parts))
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for i, p := range parts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, p readerPart) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i], errs[i] = grepPart(p, match, tr, r.timestamp)
+		}(i, p)
+	}
+	wg.Wait()
+	var matches []Match
+	for i := range parts {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		matches = append(matches, results[i]...)
+	}
+	return matches, nil
+}
+
+// grepPart returns the matching lines of p within tr, checked with
+// timestamp if it is non-nil.
+func grepPart(p readerPart, match func(line []byte) bool, tr TimeRange,
+	timestamp func(line []byte) (time.Time, bool)) ([]Match, error) {
+	ranged := timestamp != nil && !(tr.From.IsZero() && tr.To.IsZero())
+	var matches []Match
+	var off int64
+	var last time.Time // time of the last line which had one
+	br := bufio.NewReader(p.r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			text := bytes.TrimSuffix(line, []byte("\n"))
+			in := true
+			if ranged {
+				if t, ok := timestamp(text); ok {
+					last = t
+				}
+				in = !last.IsZero() && tr.contains(last)
+			}
+			if in && match(text) {
+				matches = append(matches, Match{File: p.name, Offset: off, Line: text})
+			}
+			off += int64(len(line))
+		}
+		if err == io.EOF {
+			return matches, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,158 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import "bytes"
+
+// maxRecordPeek is the most of a line passed to RecordStart when
+// scanning the log file.
+const maxRecordPeek = 4 << 10
+
+// startsRecord reports whether the line at the start of rest begins a
+// record. If rest is empty the line is not yet known and it reports
+// false.
+func (wc *Writer) startsRecord(rest []byte) bool {
+	if len(rest) == 0 {
+		return false
+	}
+	if i := bytes.Index(rest, wc.delim); i != -1 {
+		rest = rest[:i]
+	}
+	return wc.opts.RecordStart(rest)
+}
+
+// lastSplit is like lastDelim applied to p[:end] but only considers
+// delimiters accepted by isSplit, which may look beyond end.
+func (wc *Writer) lastSplit(p []byte, end int) (int, error) {
+	for {
+		i, err := wc.lastDelim(p[:end])
+		if err != nil || i == -1 {
+			return i, err
+		}
+		ok, err := wc.isSplit(p, i)
+		if ok || err != nil {
+			return i, err
+		}
+		end = i
+	}
+}
+
+// firstSplit is like firstDelim but only considers delimiters
+// accepted by isSplit.
+func (wc *Writer) firstSplit(p []byte, from int) (int, error) {
+	for {
+		i, err := wc.firstDelim(p, from)
+		if err != nil || i == -1 {
+			return i, err
+		}
+		ok, err := wc.isSplit(p, i)
+		if ok || err != nil {
+			return i, err
+		}
+		from = i + 1
+	}
+}
+
+// isSplit reports whether the delimiter ending at p[i] is a point at
+// which the log file may be split: it must be followed by the start of
+// a record if RecordStart is set and end a JSON object in JSON Lines
+// mode.
+func (wc *Writer) isSplit(p []byte, i int) (bool, error) {
+	if wc.opts.RecordStart != nil && !wc.startsRecord(p[i+1:]) {
+		return false, nil
+	}
+	if wc.opts.JSONLines {
+		return wc.endsObject(p, i)
+	}
+	return true, nil
+}
+
+// checkBoundary records the end of the log file as the last split
+// point if the file ends in a delimiter and p starts a record, which
+// could not be known until p was written. It follows the same rule
+// as write: the split point is recorded if it is before maxSize or
+// there is no other.
+func (wc *Writer) checkBoundary(p []byte) error {
+	n := int64(len(wc.delim))
+	if wc.size < n || wc.lastNewline == wc.size-1 ||
+		(wc.size > wc.maxSize && wc.lastNewline >= wc.headerEnd) ||
+		!wc.startsRecord(p) {
+		return nil
+	}
+	end := make([]byte, n)
+	err := readAt(wc.file, end, wc.size-n)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(end, wc.delim) {
+		return nil
+	}
+	if wc.opts.JSONLines {
+		line, err := wc.fileLine(wc.size - n)
+		if err != nil || !isObject(line) {
+			return err
+		}
+	}
+	wc.lastNewline = wc.size - 1
+	return nil
+}
+
+// findLastSplit returns the position of the last byte of the last
+// delimiter in the first size bytes of file at which it may be split,
+// as for isSplit, or -1 if there is none.
+func (wc *Writer) findLastSplit(file File, size int64) (int64, error) {
+	if wc.opts.RecordStart == nil && !wc.opts.JSONLines {
+		return findLastNewline(file, size, wc.delim)
+	}
+	buf := make([]byte, maxRecordPeek)
+	end := size
+	for {
+		i, err := findLastNewline(file, end, wc.delim)
+		if err != nil || i == -1 {
+			return i, err
+		}
+		end = i
+		if wc.opts.RecordStart != nil {
+			n := size - i - 1
+			if n > int64(len(buf)) {
+				n = int64(len(buf))
+			}
+			err = readAt(file, buf[:n], i+1)
+			if err != nil {
+				return -1, err
+			}
+			if !wc.startsRecord(buf[:n]) {
+				continue
+			}
+		}
+		if wc.opts.JSONLines {
+			line, err := readLine(file, i+1-int64(len(wc.delim)), wc.delim)
+			if err != nil {
+				return -1, err
+			}
+			if !isObject(line) {
+				continue
+			}
+		}
+		return i, nil
+	}
+}
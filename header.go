@@ -0,0 +1,105 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// header returns Options.Header expanded for a log file started now
+// after the archive prev, which is empty if there is none, or nil if
+// there is no header.
+func (wc *Writer) header(prev string) []byte {
+	if wc.opts.Header == "" {
+		return nil
+	}
+	return wc.expandLine(wc.opts.Header, map[string]string{
+		"start": wc.clock.Now().Format(time.RFC3339),
+		"prev":  prev,
+	})
+}
+
+// footer returns Options.Footer expanded for data rotated now into
+// the archive named archive, or nil if there is no footer.
+func (wc *Writer) footer(archive string) []byte {
+	if wc.opts.Footer == "" {
+		return nil
+	}
+	return wc.expandLine(wc.opts.Footer, map[string]string{
+		"end":     wc.clock.Now().Format(time.RFC3339),
+		"archive": archive,
+		"next":    wc.path,
+	})
+}
+
+// expandLine returns the template tmpl, with the variables in vars and
+// $host, $pid and $path replaced by their values and any others by
+// nothing, as a line ended with the delimiter.
+func (wc *Writer) expandLine(tmpl string, vars map[string]string) []byte {
+	return wc.record("%s", os.Expand(tmpl, func(v string) string {
+		switch v {
+		case "host":
+			host, _ := os.Hostname()
+			return host
+		case "pid":
+			return strconv.Itoa(os.Getpid())
+		case "path":
+			return wc.path
+		}
+		return vars[v]
+	}))
+}
+
+// writeHeader writes the header to the log file if it is empty,
+// naming archive 1 as the previous archive if it exists.
+func (wc *Writer) writeHeader() error {
+	if wc.opts.Header == "" || wc.size > 0 {
+		return nil
+	}
+	prev := ""
+	if n, err := wc.lastArchive(); err == nil && n > 0 {
+		prev = wc.archiveName(1)
+	}
+	n, err := wc.writeData(wc.header(prev))
+	wc.size += int64(n)
+	// the header is a line of its own but not a record to rotate
+	wc.lastNewline = wc.size - 1
+	wc.headerEnd = wc.size
+	return err
+}
+
+// writeStart writes p at the start of the log file, which has just
+// been emptied.
+func (wc *Writer) writeStart(p []byte) error {
+	if err := wc.fault(FaultWrite, wc.path); err != nil {
+		return &os.PathError{Op: "write", Path: wc.path, Err: err}
+	}
+	var err error
+	if wc.opts.Append {
+		_, err = wc.file.Write(p)
+	} else {
+		_, err = wc.file.WriteAt(p, 0)
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"strings"
+	"time"
+)
+
+// Health describes whether a Writer is working, for the readiness
+// and liveness checks of a service.
+type Health struct {
+	// Writable reports whether Write may succeed: the Writer is
+	// open and no write has failed.
+	Writable bool
+
+	// Fallback reports whether data is being written to
+	// Options.FallbackPath because the log file cannot be written.
+	Fallback bool
+
+	// LastWrite is when data was last written successfully, or zero
+	// if none has been, and SinceLastWrite the time since then.
+	LastWrite      time.Time
+	SinceLastWrite time.Duration
+
+	// Queued is the number of writes waiting in the asynchronous
+	// queue.
+	Queued int
+
+	// Rotating reports whether an archive is being compressed.
+	Rotating bool
+
+	// PendingArchives is the number of archives waiting to be sent
+	// again to Options.Archiver.
+	PendingArchives int
+
+	// LastError is the error which failed the Writer, or else the
+	// error of the last rotation, or nil.
+	LastError error
+}
+
+// Health returns the health of wc. It does not wait for a rotation in
+// progress, whose error is then not reported until it completes.
+func (wc *Writer) Health() Health {
+	wc.mu.Lock()
+	h := Health{
+		Writable:  !wc.closed && wc.writeErr == nil,
+		Fallback:  wc.fallback != nil,
+		LastWrite: wc.lastOK,
+		Queued:    len(wc.queue),
+		LastError: wc.writeErr,
+	}
+	if !h.LastWrite.IsZero() {
+		h.SinceLastWrite = wc.clock.Now().Sub(h.LastWrite)
+	}
+	if wc.rotMu.TryLock() {
+		if h.LastError == nil {
+			h.LastError = wc.bgErr
+		}
+		wc.rotMu.Unlock()
+	} else {
+		h.Rotating = true
+	}
+	wc.mu.Unlock()
+	if wc.queue != nil {
+		wc.errMu.Lock()
+		if wc.qerr != nil {
+			h.Writable = false
+			h.LastError = wc.qerr
+		}
+		wc.errMu.Unlock()
+		wc.qmu.RLock()
+		if wc.qclosed {
+			h.Writable = false
+		}
+		wc.qmu.RUnlock()
+	}
+	if wc.retry != nil {
+		entries, err := wc.fs.ReadDir(wc.pendingDir())
+		if err == nil {
+			for _, e := range entries {
+				if strings.HasSuffix(e.Name(), ".json") {
+					h.PendingArchives++
+				}
+			}
+		}
+	}
+	return h
+}
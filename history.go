@@ -0,0 +1,89 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import "sync"
+
+// defaultHistorySize is used when Options.HistorySize is zero.
+const defaultHistorySize = 16
+
+// history is the recent rotations returned by History.
+type history struct {
+	mu        sync.Mutex // guards rotations
+	size      int        // most rotations kept
+	rotations []Rotation // oldest first
+}
+
+// newHistory returns the history for opts, or nil if it is disabled.
+func newHistory(opts *Options) *history {
+	n := opts.HistorySize
+	if n == 0 {
+		n = defaultHistorySize
+	}
+	if n < 0 {
+		return nil
+	}
+	return &history{size: n}
+}
+
+// add records r, forgetting the oldest rotation if the history is
+// full.
+func (h *history) add(r Rotation) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.rotations) == h.size {
+		copy(h.rotations, h.rotations[1:])
+		h.rotations = h.rotations[:h.size-1]
+	}
+	h.rotations = append(h.rotations, r)
+}
+
+// loadHistory fills the history from the manifest, if Manifest is
+// set, so that rotations by earlier processes are included. Their
+// Durations are unknown and left zero, and their Archives are the
+// names the archives had when last recorded.
+func (wc *Writer) loadHistory() {
+	if wc.hist == nil || !wc.opts.Manifest {
+		return
+	}
+	m, err := readManifest(wc.fs, manifestName(wc.path, wc.opts.ArchiveDir))
+	if err != nil {
+		return
+	}
+	for i := len(m.Archives) - 1; i >= 0; i-- {
+		e := m.Archives[i]
+		wc.hist.add(Rotation{Start: e.To, Bytes: e.End - e.Start, Archive: e.Archive})
+	}
+}
+
+// History returns the most recent rotation attempts of wc, oldest
+// first, up to Options.HistorySize of them, as they were passed to
+// OnRotate. If Manifest is set it begins with the archives recorded in
+// the manifest when wc was opened.
+func (wc *Writer) History() []Rotation {
+	if wc.hist == nil {
+		return nil
+	}
+	wc.hist.mu.Lock()
+	defer wc.hist.mu.Unlock()
+	return append([]Rotation(nil), wc.hist.rotations...)
+}
@@ -0,0 +1,68 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import "log/slog"
+
+// checkIdle runs when IdleClose may have elapsed since the last write,
+// closing the log file if it has, or otherwise checking again when it
+// will have. A failure to sync is returned by the next Write.
+func (wc *Writer) checkIdle() {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	wc.idleTimer = nil
+	if wc.closed || wc.file == nil {
+		return
+	}
+	idle := wc.clock.Now().Sub(wc.lastWrite)
+	if idle < wc.opts.IdleClose {
+		wc.idleTimer = wc.clock.AfterFunc(wc.opts.IdleClose-idle, wc.checkIdle)
+		return
+	}
+	if wc.syncTimer != nil {
+		wc.syncTimer.Stop()
+		wc.syncTimer = nil
+	}
+	var err error
+	if wc.unsynced > 0 {
+		err = wc.sync()
+	}
+	if e := wc.file.Close(); err == nil {
+		err = e
+	}
+	wc.file = nil
+	wc.idle = true
+	wc.diag(slog.LevelDebug, "logrot: closed idle log file")
+	if err != nil && wc.writeErr == nil {
+		wc.writeErr = err
+		wc.stats.Errors++
+	}
+}
+
+// touch records a write for IdleClose, starting the timer which
+// checks for idleness if it is not running.
+func (wc *Writer) touch() {
+	wc.lastWrite = wc.clock.Now()
+	if wc.idleTimer == nil {
+		wc.idleTimer = wc.clock.AfterFunc(wc.opts.IdleClose, wc.checkIdle)
+	}
+}
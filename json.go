@@ -0,0 +1,125 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Malformed is a policy for lines which are not JSON objects in JSON
+// Lines mode.
+type Malformed int
+
+const (
+	// KeepMalformed makes Write write malformed lines as they are.
+	// The log file is not split just after them.
+	KeepMalformed Malformed = iota
+	// RejectMalformed makes Write return an error, writing nothing,
+	// if p contains a malformed line. The Writer remains usable.
+	RejectMalformed
+	// FlagMalformed makes Write replace each malformed line with a
+	// JSON object holding it as a string, such as
+	// {"logrot_malformed":"oops"}.
+	FlagMalformed
+)
+
+// isObject reports whether line holds a single JSON object.
+func isObject(line []byte) bool {
+	line = bytes.TrimSpace(line)
+	return len(line) > 0 && line[0] == '{' && json.Valid(line)
+}
+
+// readLine returns the bytes of file from just after the last
+// occurrence of delim ending before end up to end.
+func readLine(file File, end int64, delim []byte) ([]byte, error) {
+	i, err := findLastNewline(file, end, delim)
+	if err != nil {
+		return nil, err
+	}
+	line := make([]byte, end-i-1)
+	err = readAt(file, line, i+1)
+	return line, err
+}
+
+// fileLine is readLine on the log file.
+func (wc *Writer) fileLine(end int64) ([]byte, error) {
+	return readLine(wc.file, end, wc.delim)
+}
+
+// endsObject reports whether the line ended by the delimiter ending at
+// p[i] is a JSON object. The line may begin in the log file, whose end
+// p is taken to follow.
+func (wc *Writer) endsObject(p []byte, i int) (bool, error) {
+	start := i + 1 - len(wc.delim) // start of the delimiter
+	if start < 0 {
+		// the line and part of the delimiter are in the file
+		line, err := wc.fileLine(wc.size + int64(start))
+		return isObject(line), err
+	}
+	j, err := wc.lastDelim(p[:start])
+	if err != nil {
+		return false, err
+	}
+	if j != -1 {
+		return isObject(p[j+1 : start]), nil
+	}
+	line, err := wc.fileLine(wc.size)
+	if err != nil {
+		return false, err
+	}
+	return isObject(append(line, p[:start]...)), nil
+}
+
+// checkJSON applies the MalformedJSON policy to the complete lines in
+// p, which is taken to begin at the start of a line. Blank lines are
+// allowed. It returns the data to write in place of p, or nil if p
+// should be written as it is.
+func (wc *Writer) checkJSON(p []byte) ([]byte, error) {
+	var out []byte
+	done := 0 // bytes of p copied to out
+	for off := 0; ; {
+		i := bytes.Index(p[off:], wc.delim)
+		if i == -1 {
+			break
+		}
+		line := p[off : off+i]
+		if len(bytes.TrimSpace(line)) > 0 && !isObject(line) {
+			if wc.opts.MalformedJSON == RejectMalformed {
+				return nil, fmt.Errorf(
+					"logrot: line is not a JSON object: %q", line)
+			}
+			s, _ := json.Marshal(string(line))
+			out = append(out, p[done:off]...)
+			out = append(out, `{"logrot_malformed":`...)
+			out = append(out, s...)
+			out = append(out, '}')
+			done = off + i
+		}
+		off += i + len(wc.delim)
+	}
+	if out == nil {
+		return nil, nil
+	}
+	return append(out, p[done:]...), nil
+}
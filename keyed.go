@@ -0,0 +1,469 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyedWriter writes to one Writer for each key, such as the name of a
+// tenant or service, with the log file <dir>/<key>.log, opening them
+// as they are first written to. It can limit the number of Writers
+// open at once and the space taken by all their files, for the likes
+// of a multi-tenant gateway.
+type KeyedWriter struct {
+	dir      string
+	perm     os.FileMode
+	maxSize  int64
+	maxFiles int
+	opts     KeyedOptions
+	wopts    Options // settings of each Writer
+	ext      string  // archive extension
+	sweeper  *sweeper
+
+	mu      sync.Mutex               // guards the fields below
+	open    map[string]*list.Element // of *keyedEntry, by key
+	lru     *list.List               // of *keyedEntry, most recent first
+	closing map[string]chan struct{} // evicted keys, closed when done
+	opening map[string]chan struct{} // keys being opened, closed when done
+	closed  bool
+}
+
+// keyedEntry is an open Writer of a KeyedWriter.
+type keyedEntry struct {
+	key  string
+	wc   *Writer
+	refs int // writes in progress
+}
+
+// KeyedOptions are the settings of a KeyedWriter.
+type KeyedOptions struct {
+	// Options, if non-nil, are the settings of each Writer. Any
+	// OnRotate is still called.
+	Options *Options
+
+	// MaxOpen, if positive, is the most Writers open at once. To
+	// write to another key the least recently used Writer is closed,
+	// unless all are in use, when the limit is briefly exceeded.
+	MaxOpen int
+
+	// Budget, if positive, is the most bytes taken by the log files,
+	// archives and checksum files of all the keys, including those
+	// whose Writers are closed. Whenever a Writer rotates, the
+	// oldest archives across all the keys are deleted until the
+	// total is within Budget, keeping the most recent
+	// Options.PurgeKeep archives of each key.
+	Budget int64
+
+	// OnError, if non-nil, is called with each error keeping to
+	// Budget, from the goroutine which does so.
+	OnError func(error)
+}
+
+// OpenKeyed returns a KeyedWriter of Writers with the log files
+// <dir>/<key>.log, opened as OpenWithOptions does with the given perm,
+// maxSize, maxFiles and opts.Options.
+func OpenKeyed(dir string, perm os.FileMode, maxSize int64, maxFiles int, opts *KeyedOptions) (*KeyedWriter, error) {
+	if maxSize < 1 {
+		return nil, errors.New("logrot: maxSize < 1")
+	}
+	if maxFiles < 1 {
+		return nil, errors.New("logrot: maxFiles < 1")
+	}
+	kw := &KeyedWriter{
+		dir:      dir,
+		perm:     perm,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		open:     make(map[string]*list.Element),
+		lru:      list.New(),
+		closing:  make(map[string]chan struct{}),
+		opening:  make(map[string]chan struct{}),
+		ext:      ".gz",
+	}
+	if opts != nil {
+		kw.opts = *opts
+	}
+	if kw.opts.Options != nil {
+		kw.wopts = *kw.opts.Options
+	}
+	if kw.wopts.FS == nil {
+		kw.wopts.FS = osFS{}
+	}
+	if kw.wopts.Encrypter != nil {
+		kw.ext += kw.wopts.Encrypter.Ext()
+	}
+	if kw.opts.Budget > 0 {
+		kw.sweeper = newSweeper(kw.enforce, 0, kw.wopts.Clock, kw.opts.OnError)
+		onRotate := kw.wopts.OnRotate
+		kw.wopts.OnRotate = func(r Rotation) {
+			if onRotate != nil {
+				onRotate(r)
+			}
+			kw.sweeper.trigger()
+		}
+		kw.sweeper.trigger()
+	}
+	return kw, nil
+}
+
+// checkKey returns an error if key cannot name a log file in the
+// directory.
+func checkKey(key string) error {
+	if key == "" || key[0] == '.' || strings.ContainsAny(key, `/\`) ||
+		filepath.Base(key) != key {
+		return fmt.Errorf("logrot: invalid key %q", key)
+	}
+	return nil
+}
+
+// path returns the log file of key.
+func (kw *KeyedWriter) path(key string) string {
+	return filepath.Join(kw.dir, key+".log")
+}
+
+// WriteKeyed writes p to the Writer of key, opening it if needed.
+func (kw *KeyedWriter) WriteKeyed(key string, p []byte) (int, error) {
+	e, err := kw.acquire(key)
+	if err != nil {
+		return 0, err
+	}
+	defer kw.release(e)
+	return e.wc.Write(p)
+}
+
+// acquire returns the entry of key, opening its Writer if needed,
+// with a reference taken which must be released.
+func (kw *KeyedWriter) acquire(key string) (*keyedEntry, error) {
+	err := checkKey(key)
+	if err != nil {
+		return nil, err
+	}
+	kw.mu.Lock()
+	defer kw.mu.Unlock()
+	for {
+		if kw.closed {
+			return nil, errors.New("logrot: KeyedWriter is closed")
+		}
+		if el, ok := kw.open[key]; ok {
+			kw.lru.MoveToFront(el)
+			e := el.Value.(*keyedEntry)
+			e.refs++
+			return e, nil
+		}
+		if kw.busy(key) {
+			// the evicted Writer must be closed before another
+			// is opened on the same file, and only one may be
+			// opened
+			kw.waitBusy(key)
+			continue
+		}
+		evicted := kw.evict()
+		if len(evicted) == 0 {
+			break
+		}
+		kw.mu.Unlock()
+		err = kw.closeEvicted(evicted)
+		kw.mu.Lock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	// open without kw.mu so that writes to other keys are not held
+	// up by a slow open
+	done := make(chan struct{})
+	kw.opening[key] = done
+	kw.mu.Unlock()
+	wc, err := OpenWithOptions(kw.path(key), kw.perm, kw.maxSize, kw.maxFiles, &kw.wopts)
+	kw.mu.Lock()
+	close(done)
+	delete(kw.opening, key)
+	if err != nil {
+		return nil, err
+	}
+	if kw.closed {
+		_ = wc.Close()
+		return nil, errors.New("logrot: KeyedWriter is closed")
+	}
+	e := &keyedEntry{key: key, wc: wc, refs: 1}
+	kw.open[key] = kw.lru.PushFront(e)
+	return e, nil
+}
+
+// release releases the reference to e taken by acquire.
+func (kw *KeyedWriter) release(e *keyedEntry) {
+	kw.mu.Lock()
+	e.refs--
+	kw.mu.Unlock()
+}
+
+// evict removes the least recently used Writers not in use until
+// there is room for another within MaxOpen, and returns them to be
+// closed by closeEvicted. kw.mu must be held.
+func (kw *KeyedWriter) evict() []*keyedEntry {
+	if kw.opts.MaxOpen <= 0 {
+		return nil
+	}
+	var evicted []*keyedEntry
+	for el := kw.lru.Back(); el != nil && len(kw.open)+len(kw.opening) >= kw.opts.MaxOpen; {
+		prev := el.Prev()
+		e := el.Value.(*keyedEntry)
+		if e.refs == 0 {
+			kw.lru.Remove(el)
+			delete(kw.open, e.key)
+			kw.closing[e.key] = make(chan struct{})
+			evicted = append(evicted, e)
+		}
+		el = prev
+	}
+	return evicted
+}
+
+// closeEvicted closes the Writers returned by evict, returning the
+// first error. kw.mu must not be held, so that writes to other keys
+// are not held up by a slow Close.
+func (kw *KeyedWriter) closeEvicted(evicted []*keyedEntry) error {
+	var err error
+	for _, e := range evicted {
+		if cerr := e.wc.Close(); err == nil {
+			err = cerr
+		}
+		kw.mu.Lock()
+		close(kw.closing[e.key])
+		delete(kw.closing, e.key)
+		kw.mu.Unlock()
+	}
+	return err
+}
+
+// busy reports whether a Writer of key is being closed by
+// closeEvicted or opened by acquire. kw.mu must be held.
+func (kw *KeyedWriter) busy(key string) bool {
+	_, closing := kw.closing[key]
+	_, opening := kw.opening[key]
+	return closing || opening
+}
+
+// waitBusy waits until no Writer of key is being closed by
+// closeEvicted or opened by acquire. kw.mu must be held, and is
+// released while waiting.
+func (kw *KeyedWriter) waitBusy(key string) {
+	for kw.busy(key) {
+		done, ok := kw.closing[key]
+		if !ok {
+			done = kw.opening[key]
+		}
+		kw.mu.Unlock()
+		<-done
+		kw.mu.Lock()
+	}
+}
+
+// Close closes the open Writers, returning the first error. Writes in
+// progress must have completed. The Writers are closed without kw.mu,
+// so that a slow Close does not hold up other calls, which fail.
+func (kw *KeyedWriter) Close() error {
+	if kw.sweeper != nil {
+		kw.sweeper.close()
+	}
+	kw.mu.Lock()
+	var writers []*Writer
+	for el := kw.lru.Front(); el != nil; el = el.Next() {
+		writers = append(writers, el.Value.(*keyedEntry).wc)
+	}
+	kw.open = make(map[string]*list.Element)
+	kw.lru.Init()
+	kw.closed = true
+	kw.mu.Unlock()
+	var err error
+	for _, wc := range writers {
+		if e := wc.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// keyedSet is the files of one key of a KeyedWriter.
+type keyedSet struct {
+	key      string
+	wc       *Writer     // nil if closed
+	size     int64       // bytes taken by all the files
+	archives []time.Time // modification times, by archive number less 1
+}
+
+// archiveName returns the name of archive n of key.
+func (kw *KeyedWriter) archiveName(key string, n int) string {
+	return fmt.Sprintf("%s.%d%s",
+		archiveBase(kw.path(key), kw.wopts.ArchiveDir), n, kw.ext)
+}
+
+// scan returns the files of every key in the directory.
+func (kw *KeyedWriter) scan() ([]*keyedSet, error) {
+	entries, err := kw.wopts.FS.ReadDir(kw.dir)
+	if err != nil {
+		return nil, err
+	}
+	var sets []*keyedSet
+	for _, ent := range entries {
+		key := strings.TrimSuffix(ent.Name(), ".log")
+		if key == ent.Name() || checkKey(key) != nil {
+			continue
+		}
+		kw.mu.Lock()
+		kw.waitBusy(key)
+		var wc *Writer
+		if el, ok := kw.open[key]; ok {
+			wc = el.Value.(*keyedEntry).wc
+		}
+		kw.mu.Unlock()
+		s := &keyedSet{key: key, wc: wc}
+		if wc != nil {
+			ms, err := wc.managedSet()
+			if err != nil {
+				return nil, err
+			}
+			s.size, s.archives = ms.size, ms.archives
+		} else {
+			err := kw.scanClosed(s)
+			if err != nil {
+				return nil, err
+			}
+		}
+		sets = append(sets, s)
+	}
+	return sets, nil
+}
+
+// scanClosed fills in s for a key whose Writer is closed.
+func (kw *KeyedWriter) scanClosed(s *keyedSet) error {
+	fsys := kw.wopts.FS
+	// the log file may have been removed, leaving only archives
+	fi, err := fsys.Stat(kw.path(s.key))
+	switch {
+	case err == nil:
+		s.size = fi.Size()
+	case !os.IsNotExist(err):
+		return err
+	}
+	for n := 1; ; n++ {
+		name := kw.archiveName(s.key, n)
+		fi, err := fsys.Stat(name)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.size += fi.Size()
+		if sfi, err := fsys.Stat(sidecarName(name)); err == nil {
+			s.size += sfi.Size()
+		}
+		s.archives = append(s.archives, fi.ModTime())
+	}
+}
+
+// enforce deletes the oldest archives across all the keys until they
+// are within the budget or only the archives kept by PurgeKeep remain.
+func (kw *KeyedWriter) enforce() error {
+	sets, err := kw.scan()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, s := range sets {
+		total += s.size
+	}
+	keep := kw.wopts.PurgeKeep
+	for total > kw.opts.Budget {
+		var oldest *keyedSet
+		for _, s := range sets {
+			n := len(s.archives)
+			if n <= keep {
+				continue
+			}
+			if oldest == nil || s.archives[n-1].Before(oldest.archives[len(oldest.archives)-1]) {
+				oldest = s
+			}
+		}
+		if oldest == nil {
+			return nil
+		}
+		var freed int64
+		if oldest.wc != nil {
+			freed, err = oldest.wc.removeOldest()
+		} else {
+			freed, err = kw.removeClosed(oldest.key, len(oldest.archives))
+		}
+		if err != nil {
+			return err
+		}
+		oldest.archives = oldest.archives[:len(oldest.archives)-1]
+		total -= freed
+	}
+	return nil
+}
+
+// removeClosed deletes archive n, the oldest, of key, whose Writer was
+// closed when scanned, returning the bytes freed. If the Writer has
+// been opened since, its oldest archive is deleted through it, without
+// kw.mu so that a rotation in progress does not hold up other keys.
+func (kw *KeyedWriter) removeClosed(key string, n int) (int64, error) {
+	kw.mu.Lock()
+	kw.waitBusy(key)
+	if el, ok := kw.open[key]; ok {
+		e := el.Value.(*keyedEntry)
+		e.refs++
+		kw.mu.Unlock()
+		defer kw.release(e)
+		return e.wc.removeOldest()
+	}
+	defer kw.mu.Unlock()
+	fsys := kw.wopts.FS
+	name := kw.archiveName(key, n)
+	if _, err := fsys.Stat(kw.archiveName(key, n+1)); err == nil {
+		// not the oldest after all
+		return 0, nil
+	}
+	var freed int64
+	for _, f := range []string{name, sidecarName(name)} {
+		fi, err := fsys.Stat(f)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil {
+			err = fsys.Remove(f)
+		}
+		if err != nil {
+			return freed, err
+		}
+		freed += fi.Size()
+	}
+	return freed, nil
+}
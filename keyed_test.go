@@ -0,0 +1,101 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeyedWriter(t *testing.T) {
+	dir := t.TempDir()
+	kw, err := OpenKeyed(dir, 0644, 10, 3, &KeyedOptions{MaxOpen: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []struct{ key, data string }{
+		{"a", "a1\n"}, {"b", "b1\n"}, {"c", "c1\n"}, {"a", "a2\n"},
+	} {
+		if _, err := kw.WriteKeyed(w.key, []byte(w.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kw.mu.Lock()
+	open := len(kw.open)
+	kw.mu.Unlock()
+	if open != 2 {
+		t.Errorf("%d Writers open, want MaxOpen 2", open)
+	}
+	for _, key := range []string{"", ".hidden", "a/b", `a\b`} {
+		if _, err := kw.WriteKeyed(key, []byte("x\n")); err == nil {
+			t.Errorf("WriteKeyed(%q) succeeded", key)
+		}
+	}
+	if err := kw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kw.WriteKeyed("a", []byte("a3\n")); err == nil {
+		t.Error("WriteKeyed after Close succeeded")
+	}
+	for key, want := range map[string]string{"a": "a1\na2\n", "b": "b1\n", "c": "c1\n"} {
+		data, err := os.ReadFile(filepath.Join(dir, key+".log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s.log holds %q, want %q", key, data, want)
+		}
+	}
+}
+
+// TestKeyedCloseUnlocked checks that while KeyedWriter.Close waits for
+// a Writer to close, writes to other keys fail at once rather than
+// waiting for it.
+func TestKeyedCloseUnlocked(t *testing.T) {
+	a := &hungArchiver{started: make(chan struct{}, 1)}
+	kw, err := OpenKeyed(t.TempDir(), 0644, 10, 3, &KeyedOptions{
+		Options: &Options{Archiver: a, ArchiveTimeout: 2 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rotate so that Close waits for the archive being sent
+	if _, err := kw.WriteKeyed("a", []byte("0123456789\nab")); err != nil {
+		t.Fatal(err)
+	}
+	<-a.started
+	done := make(chan error, 1)
+	go func() { done <- kw.Close() }()
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	if _, err := kw.WriteKeyed("b", []byte("b\n")); err == nil {
+		t.Error("WriteKeyed during Close succeeded")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("WriteKeyed waited %v for Close", d)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
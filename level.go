@@ -0,0 +1,200 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// maxLevelFields is how many fields at the start of a line are
+// searched for a level.
+const maxLevelFields = 4
+
+// commonLevels are the levels recognised by LevelWriter besides those
+// it routes, so that records of other levels are not taken to
+// continue the record before them.
+var commonLevels = map[string]bool{
+	"trace": true, "debug": true, "info": true, "notice": true,
+	"warn": true, "warning": true, "error": true, "err": true,
+	"crit": true, "critical": true, "alert": true, "emerg": true,
+	"fatal": true, "panic": true,
+}
+
+// LevelWriter routes records to different Writers by their level, so
+// that, for example, errors can be kept longer than debug messages,
+// each Writer having its own size and number of files.
+type LevelWriter struct {
+	writers map[string]*Writer // keyed by lower case level
+	def     *Writer
+	level   func(line []byte) string
+}
+
+// NewLevelWriter returns a LevelWriter writing the records of each
+// level in writers to its Writer, and other records to def, which may
+// be nil if every record has a level in writers. Levels are matched
+// without regard to case. If level is nil, the level of a line is the
+// first of its first four fields, with any quotes, brackets and
+// "level=" prefix removed, which is a level in writers or a common
+// one such as "info", as in "2006-01-02T15:04:05Z [ERROR] message",
+// "level=error msg=..." or {"level":"error",...}. Otherwise it is
+// whatever level returns for the line without its newline, or "" if
+// it has none.
+func NewLevelWriter(writers map[string]*Writer, def *Writer, level func(line []byte) string) *LevelWriter {
+	lw := &LevelWriter{
+		writers: make(map[string]*Writer, len(writers)),
+		def:     def,
+		level:   level,
+	}
+	for l, wc := range writers {
+		lw.writers[strings.ToLower(l)] = wc
+	}
+	if lw.level == nil {
+		lw.level = lw.findLevel
+	}
+	return lw
+}
+
+// findLevel returns the first of the first maxLevelFields fields of
+// line which is a level of lw or in commonLevels, or "" if there is
+// none.
+func (lw *LevelWriter) findLevel(line []byte) string {
+	return findLevel(line, func(l string) bool {
+		_, ok := lw.writers[l]
+		return ok
+	})
+}
+
+// findLevel returns the first of the first maxLevelFields fields of
+// line, lower cased and with any quotes, brackets and "level=" prefix
+// removed, which is in commonLevels or for which isLevel, if not nil,
+// returns true, or "" if there is none.
+func findLevel(line []byte, isLevel func(string) bool) string {
+	fields := bytes.Fields(line)
+	if len(fields) > maxLevelFields {
+		fields = fields[:maxLevelFields]
+	}
+	for _, f := range fields {
+		f = bytes.Trim(bytes.ToLower(f), `{}[]()"',:`)
+		for _, prefix := range []string{"level=", `level":"`} {
+			f = bytes.TrimPrefix(f, []byte(prefix))
+		}
+		l := string(f)
+		if commonLevels[l] || isLevel != nil && isLevel(l) {
+			return l
+		}
+	}
+	return ""
+}
+
+// errorLevels are the levels in commonLevels of errors or worse.
+var errorLevels = map[string]bool{
+	"error": true, "err": true, "crit": true, "critical": true,
+	"alert": true, "emerg": true, "fatal": true, "panic": true,
+}
+
+// IsError reports whether line has a level, found as LevelWriter
+// finds levels by default, of error or worse, such as "ERROR" or
+// "fatal". It may be used as Options.QuotaKeep.
+func IsError(line []byte) bool {
+	return errorLevels[findLevel(line, nil)]
+}
+
+// writer returns the Writer for level.
+func (lw *LevelWriter) writer(level string) (*Writer, error) {
+	if wc, ok := lw.writers[strings.ToLower(level)]; ok {
+		return wc, nil
+	}
+	if lw.def == nil {
+		return nil, fmt.Errorf("logrot: no Writer for level %q", level)
+	}
+	return lw.def, nil
+}
+
+// Write writes each line of p to the Writer for its level. A line with
+// no level, such as the continuation of a record, goes with the line
+// before it, and at the start of p to the default Writer. Each call to
+// Write is taken to begin at the start of a line, so a line written by
+// several calls should be written with WriteLevel.
+func (lw *LevelWriter) Write(p []byte) (int, error) {
+	written := 0
+	var wc *Writer
+	start := 0 // of the lines going to wc
+	for i := 0; i < len(p); {
+		end := bytes.IndexByte(p[i:], '\n')
+		if end == -1 {
+			end = len(p)
+		} else {
+			end += i + 1
+		}
+		if level := lw.level(bytes.TrimSuffix(p[i:end], []byte("\n"))); level != "" || wc == nil {
+			next, err := lw.writer(level)
+			if err != nil {
+				return written, err
+			}
+			if wc != nil && next != wc {
+				n, err := wc.Write(p[start:i])
+				written += n
+				if err != nil {
+					return written, err
+				}
+				start = i
+			}
+			wc = next
+		}
+		i = end
+	}
+	if wc == nil {
+		return 0, nil
+	}
+	n, err := wc.Write(p[start:])
+	return written + n, err
+}
+
+// WriteLevel writes p to the Writer for level.
+func (lw *LevelWriter) WriteLevel(level string, p []byte) (int, error) {
+	wc, err := lw.writer(level)
+	if err != nil {
+		return 0, err
+	}
+	return wc.Write(p)
+}
+
+// Close closes each of the Writers, returning the first error.
+func (lw *LevelWriter) Close() error {
+	closed := map[*Writer]bool{nil: true}
+	var err error
+	closeOnce := func(wc *Writer) {
+		if !closed[wc] {
+			closed[wc] = true
+			if e := wc.Close(); err == nil {
+				err = e
+			}
+		}
+	}
+	for _, wc := range lw.writers {
+		closeOnce(wc)
+	}
+	closeOnce(lw.def)
+	return err
+}
@@ -0,0 +1,332 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// checkLive returns an error if CompressLive is set with an option it
+// cannot be used with.
+func checkLive(opts *Options) error {
+	bad := ""
+	switch {
+	case opts.Shared:
+		bad = "Shared"
+	case opts.Append:
+		bad = "Append"
+	case opts.LockFile:
+		bad = "LockFile"
+	case opts.Encrypter != nil:
+		bad = "Encrypter"
+	case opts.Preallocate:
+		bad = "Preallocate"
+	case opts.FallbackPath != "":
+		bad = "FallbackPath"
+	case opts.IdleClose > 0:
+		bad = "IdleClose"
+	case opts.ReopenInterval > 0:
+		bad = "ReopenInterval"
+	case opts.CopyTruncate:
+		bad = "CopyTruncate"
+	case opts.RecordStart != nil:
+		bad = "RecordStart"
+	case opts.JSONLines:
+		bad = "JSONLines"
+	default:
+		return nil
+	}
+	return errors.New("logrot: CompressLive cannot be used with " + bad)
+}
+
+// openLive opens the log file in CompressLive mode. Any existing log
+// file is archived as it is, as its uncompressed size is not known.
+func (wc *Writer) openLive() error {
+	err := wc.makeDirs()
+	if err != nil {
+		return err
+	}
+	size, err := statLog(wc.fs, wc.path)
+	if err != nil {
+		return err
+	}
+	if size > 0 {
+		err = wc.lockRotation()
+		if err == nil {
+			wc.stagedAt = wc.clock.Now()
+			err = wc.archiveGz(wc.path, -1)
+		}
+		wc.unlockRotation()
+		if err != nil {
+			return err
+		}
+	}
+	return wc.createLive()
+}
+
+// createLive creates an empty log file in CompressLive mode.
+func (wc *Writer) createLive() error {
+	file, err := wc.fs.OpenFile(wc.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, wc.perm)
+	if err != nil {
+		return err
+	}
+	err = wc.setAttrs(wc.path, wc.perm)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	wc.file = file
+	if wc.gz == nil {
+		wc.gz = gzip.NewWriter(file)
+	} else {
+		wc.gz.Reset(file)
+	}
+	wc.size = 0
+	wc.lastNewline = -1
+	return nil
+}
+
+// writeLive is writeSplit in CompressLive mode. The data is compressed
+// as it is written, a line at a time, so any part of a line not yet
+// ended is kept in memory until it is.
+func (wc *Writer) writeLive(p []byte) (int, error) {
+	data := p
+	if len(wc.livePart) > 0 {
+		data = append(wc.livePart, p...)
+	}
+	end := len(data) // of the last line ended
+	if len(wc.delim) > 0 {
+		end = bytes.LastIndex(data, wc.delim) + len(wc.delim)
+		if end < len(wc.delim) {
+			end = 0
+		}
+	}
+	lines, rest := data[:end], data[end:]
+	for len(lines) > 0 {
+		n := len(lines)
+		if room := wc.maxSize - wc.size; int64(n) > room {
+			n = 0
+			if room > 0 {
+				n = wc.lastLineEnd(lines[:room])
+			}
+			if n == 0 && wc.size > 0 {
+				err := wc.rotate()
+				if err != nil {
+					return 0, err
+				}
+				continue
+			}
+			if n == 0 {
+				// a line longer than maxSize fills a file
+				n = bytes.Index(lines, wc.delim) + len(wc.delim)
+			}
+		}
+		_, err := wc.gz.Write(lines[:n])
+		if err != nil {
+			return 0, err
+		}
+		wc.replicate(lines[:n])
+		wc.size += int64(n)
+		wc.lastNewline = wc.size - 1
+		wc.stats.BytesWritten += int64(n)
+		wc.unflushed = true
+		lines = lines[n:]
+	}
+	wc.livePart = append([]byte(nil), rest...)
+	if !wc.unflushed {
+		return len(p), nil
+	}
+	if wc.opts.LiveFlush <= 0 {
+		return len(p), wc.flushLive()
+	}
+	if wc.flushTimer == nil {
+		wc.flushTimer = wc.clock.AfterFunc(wc.opts.LiveFlush, wc.timedFlush)
+	}
+	return len(p), nil
+}
+
+// lastLineEnd returns the length of the lines of p up to the end of
+// its last delimiter, or of p in raw mode.
+func (wc *Writer) lastLineEnd(p []byte) int {
+	if len(wc.delim) == 0 {
+		return len(p)
+	}
+	i := bytes.LastIndex(p, wc.delim)
+	if i == -1 {
+		return 0
+	}
+	return i + len(wc.delim)
+}
+
+// flushLive flushes the data compressed in CompressLive mode to the
+// log file, so that it can be read while the file is written.
+func (wc *Writer) flushLive() error {
+	wc.unflushed = false
+	return wc.gz.Flush()
+}
+
+// timedFlush runs when LiveFlush has elapsed since data was written.
+// An error is returned by the next Write.
+func (wc *Writer) timedFlush() {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	wc.flushTimer = nil
+	if wc.closed || wc.gz == nil || !wc.unflushed {
+		return
+	}
+	if err := wc.flushLive(); err != nil && wc.writeErr == nil {
+		wc.writeErr = err
+		wc.stats.Errors++
+	}
+}
+
+// closeLive ends the gzip stream of the log file and closes it. If
+// final is set, as for Close, any line not yet ended is written first.
+func (wc *Writer) closeLive(final bool) error {
+	if wc.flushTimer != nil {
+		wc.flushTimer.Stop()
+		wc.flushTimer = nil
+	}
+	var err error
+	if final && len(wc.livePart) > 0 {
+		_, err = wc.gz.Write(wc.livePart)
+		wc.replicate(wc.livePart)
+		wc.livePart = nil
+	}
+	if e := wc.gz.Close(); err == nil {
+		err = e
+	}
+	wc.unflushed = false
+	if err == nil && (wc.opts.SyncOnRotate || wc.unsynced > 0) {
+		err = wc.file.Sync()
+		wc.unsynced = 0
+	}
+	if e := wc.file.Close(); err == nil {
+		err = e
+	}
+	wc.file = nil
+	return err
+}
+
+// rotateLive performs a rotation in CompressLive mode, which needs no
+// compression: the log file is completed and renamed to
+// <path>.1.gz. The rotation lock must be held.
+func (wc *Writer) rotateLive() error {
+	err := wc.closeLive(false)
+	if err != nil {
+		return err
+	}
+	err = wc.archiveGz(wc.path, wc.size)
+	if err != nil {
+		return err
+	}
+	return wc.createLive()
+}
+
+// archiveGz shifts the archives and moves the complete gzip file src,
+// holding size bytes of data or -1 if unknown, to <path>.1.gz, or
+// removes it if maxFiles is 1. The rotation lock must be held.
+func (wc *Writer) archiveGz(src string, size int64) error {
+	err := wc.shiftArchives()
+	if err != nil {
+		return err
+	}
+	if wc.maxFiles == 1 {
+		return wc.fs.Remove(src)
+	}
+	name := wc.archiveName(1)
+	err = wc.moveFile(src, name, wc.archivePerm())
+	if err == nil && wc.archivePerm() != wc.perm {
+		err = wc.fs.Chmod(name, wc.archivePerm())
+	}
+	if err == nil {
+		err = wc.setAttrs(name, wc.archivePerm())
+	}
+	var sum []byte
+	if err == nil && (wc.opts.Checksums || wc.opts.Manifest) {
+		sum, err = wc.fileSum(name)
+	}
+	if err == nil && wc.opts.Checksums {
+		err = wc.writeSidecar(name, sum)
+	}
+	if err == nil && wc.opts.SyncDir {
+		err = syncDir(wc.fs, filepath.Dir(wc.archiveBase))
+	}
+	if err != nil {
+		return err
+	}
+	if wc.opts.Archiver != nil {
+		wc.sendArchive(size)
+	}
+	if wc.opts.Manifest && size >= 0 {
+		return wc.updateManifest(nil, size, sum)
+	}
+	return nil
+}
+
+// fileSum returns the SHA-256 checksum of the file name.
+func (wc *Writer) fileSum(name string) ([]byte, error) {
+	f, err := open(wc.fs, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = copyBuffer(h, f)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// liveReader reads the data of a log file written in CompressLive
+// mode, which may end part way through its gzip stream.
+type liveReader struct {
+	f  io.Reader
+	zr *gzip.Reader
+}
+
+func (r *liveReader) Read(p []byte) (int, error) {
+	if r.zr == nil {
+		zr, err := gzip.NewReader(r.f)
+		if err == io.ErrUnexpectedEOF {
+			// the header is not yet complete
+			err = io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		r.zr = zr
+	}
+	n, err := r.zr.Read(p)
+	if err == io.ErrUnexpectedEOF {
+		// the rest is still being written
+		err = io.EOF
+	}
+	return n, err
+}
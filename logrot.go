@@ -79,89 +79,268 @@ package logrot // import "xi2.org/x/logrot"
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
 )
 
-type writeCloser struct {
+// Writer is a log file writer with rotation and gzip compression. It
+// is returned by OpenWithOptions, and by Open as an io.WriteCloser.
+type Writer struct {
 	path        string
 	perm        os.FileMode
 	maxSize     int64
 	maxFiles    int
-	file        *os.File
+	file        File
 	size        int64
-	lastNewline int64
+	lastNewline int64     // position of the last byte of the last delim
+	headerEnd   int64     // length of the header this Writer wrote
+	delim       []byte    // Options.Delimiter or "\n", empty in raw mode
+	midLine     bool      // data ends part way through a line, see stamp.go
+	lastLine    []byte    // last line kept by suppressRepeats
+	repeats     int       // repeats of lastLine suppressed, or -1 if none
+	archives    int       // cached result of lastArchive, or -1
+	archiveBase string    // archive names less ".<n><archiveExt>"
+	archiveExt  string    // ".gz" and any Encrypter extension
+	lastCheck   time.Time // time of last checkReopen
+	lastWrite   time.Time // time of last write, for IdleClose
+	lastOK      time.Time // time of last successful write, see health.go
+	idleTimer   Timer     // runs checkIdle, see idle.go
+	idle        bool      // the log file was closed by checkIdle
+	unsynced    int64     // bytes written since last sync, see sync.go
+	syncTimer   Timer
+	clock       Clock // Options.Clock or the system clock
+	fs          FS    // Options.FS or the operating system's
+	opts        Options
 	closed      bool
 	writeErr    error
+	stats       Stats
 	mu          sync.Mutex
+	callCtx     context.Context // context of the call holding mu, or nil
+
+	// asynchronous mode, see async.go
+	queue   chan *[]byte
+	drained chan struct{}
+	qclosed bool
+	qmu     sync.RWMutex // guards qclosed and sending on queue
+	qerr    error
+	errMu   sync.Mutex // guards qerr
+	dropped int64      // accessed atomically
+	high    int32      // 1 if above HighWater, accessed atomically
+	highMu  sync.Mutex // serialises calls to OnHighWater
+
+	// compression of archives, see background.go
+	rotMu    sync.Mutex // held while the staging file is in use
+	lockFile File       // <path>.lock if LockFile is set
+	bgErr    error      // guarded by rotMu
+	handoff  bool       // staging file left for the caller of write
+	pending  Rotation   // rotation awaiting compression by that caller
+	notifyMu sync.Mutex // serialises calls to OnRotate
+	stagedAt time.Time  // start of the rotation which staged the data
+
+	// sending archives to Options.Archiver, see archive.go
+	archivedAt time.Time // stagedAt of the last archive sent
+	archiveSem chan struct{}
+	archiveWG  sync.WaitGroup
+	archiveCtx context.Context    // passed to Archiver
+	archiveEnd context.CancelFunc // cancels archiveCtx, for Close
+	sent       []*sentArchive     // archives passed to Archiver
+	sentMu     sync.Mutex         // guards sent
+	retry      *retryState        // nil unless RetryArchives, see retry.go
+
+	// rate limiting, see rate.go
+	rate        *rateLimiter // nil unless RateLimit is set
+	rateDropped int64        // writes dropped by rate, accessed atomically
+	quota       *quotaState  // nil unless DailyQuota is set, see quota.go
+	space       *spaceState  // nil unless MinFreeSpace applies, see space.go
+
+	// CompressLive mode, see live.go
+	gz         *gzip.Writer // compressing to the log file, or nil
+	livePart   []byte       // data after the last delimiter written
+	unflushed  bool         // data is held by gz
+	flushTimer Timer        // runs timedFlush
+
+	// CompressMirror mode, see mirror.go
+	mirror   File         // compressed mirror of the log file, or nil
+	mirrorGz *gzip.Writer // compressing to mirror
+	mirrored int64        // bytes of the log file in mirror
+
+	// second copy of the log file, see shadow.go
+	shadow *Writer // nil unless ShadowPath is set and working
+
+	// channel returned by Events, see events.go
+	events eventState
+	hist   *history // nil unless HistorySize >= 0, see history.go
+
+	// fallback file, see fallback.go
+	fallback      File // non-nil while writing to FallbackPath
+	fallbackStart time.Time
+	fallbackBytes int64 // bytes written to fallback
+	lastRetry     time.Time
 }
 
 // rotate performs the rotation as described in the comment for
 // Open. It assumes file contains a newline.
-func (wc *writeCloser) rotate() error {
-	// find highest n such that <path>.<n>.gz exists
-	n := 0
-	for {
-		_, err := os.Lstat(fmt.Sprintf("%s.%d.gz", wc.path, n+1))
-		if err != nil && !os.IsNotExist(err) {
-			return err
+func (wc *Writer) rotate() (err error) {
+	r := Rotation{Start: wc.clock.Now(), Bytes: wc.lastNewline + 1, ctx: wc.callCtx}
+	if wc.maxFiles > 1 {
+		r.Archive = wc.archiveName(1)
+	}
+	skipped := false
+	defer func() {
+		if skipped {
+			return
 		}
 		if err == nil {
-			n++
-		} else {
-			break
+			wc.stats.Rotations++
+			wc.replicateRotation(r)
 		}
-	}
-	// delete expired gz files
-	for ; n > wc.maxFiles-2 && n > 0; n-- {
-		err := os.Remove(fmt.Sprintf("%s.%d.gz", wc.path, n))
-		if err != nil && !os.IsNotExist(err) {
-			return err
+		if !wc.handoff {
+			wc.notifyRotate(r, err)
 		}
+	}()
+	err = wc.lockRotation()
+	if err != nil {
+		wc.unlockRotation()
+		return err
 	}
-	// move each gz file up one number
-	for ; n > 0; n-- {
-		err := os.Rename(
-			fmt.Sprintf("%s.%d.gz", wc.path, n),
-			fmt.Sprintf("%s.%d.gz", wc.path, n+1))
-		if err != nil && !os.IsNotExist(err) {
-			return err
+	if wc.lastNewline < wc.headerEnd {
+		// lockRotation found that another process rotated the log
+		// file first
+		wc.unlockRotation()
+		skipped = true
+		return nil
+	}
+	r.Bytes = wc.lastNewline + 1
+	wc.stagedAt = r.Start
+	if wc.gz != nil {
+		err = wc.rotateLive()
+		wc.unlockRotation()
+		return err
+	}
+	hdr := wc.header(r.Archive)
+	renamed := false
+	archived := false // by archiveMirror
+	wc.updateMirror()
+	switch {
+	case wc.maxFiles == 1:
+		// nothing is archived but old gz files are deleted
+		err = wc.shiftArchives()
+	case wc.mirror != nil:
+		// the mirror is already compressed
+		err = wc.archiveMirror()
+		archived = err == nil
+	case wc.opts.RenameRotate && wc.lastNewline+1 == wc.size:
+		// the file ends in a newline so it can be archived whole
+		err = wc.renameAside()
+		renamed = err == nil
+	default:
+		// copy file contents up to last newline to the staging file
+		err = wc.stage()
+		for err != nil && wc.purge(err) {
+			err = wc.stage()
 		}
 	}
-	// copy file contents up to last newline to <path>.1.gz
-	if wc.maxFiles > 1 {
-		w, err := os.OpenFile(
-			fmt.Sprintf("%s.1.gz", wc.path), os.O_WRONLY|os.O_CREATE, wc.perm)
+	if err == nil && wc.maxFiles > 1 && wc.opts.SyncDir {
+		// make sure the staging file survives a crash before the
+		// data leaves the log file
+		err = syncDir(wc.fs, filepath.Dir(wc.path))
+	}
+	if err == nil && !renamed {
+		err = wc.moveTail(hdr)
+	} else if err == nil && len(hdr) > 0 {
+		err = wc.writeStart(hdr)
+	}
+	if err == nil && wc.opts.SyncOnRotate {
+		err = wc.file.Sync()
+	}
+	if err != nil || wc.maxFiles == 1 || archived {
+		wc.unlockRotation()
 		if err != nil {
 			return err
 		}
-		gw := gzip.NewWriter(w)
-		err = func() error {
-			// wrap in function literal to ensure gw and w are closed and
-			// flushed before next step
-			defer func() {
-				e := gw.Close()
-				if e != nil {
-					err = e
-				}
-				e = w.Close()
-				if e != nil {
-					err = e
-				}
-			}()
-			_, err = wc.file.Seek(0, 0)
+	}
+	// adjust recorded size
+	wc.size = wc.size - wc.lastNewline - 1 + int64(len(hdr))
+	wc.lastNewline = int64(len(hdr)) - 1
+	wc.headerEnd = int64(len(hdr))
+	if wc.opts.CompressMirror && wc.maxFiles > 1 {
+		wc.openMirror()
+	}
+	if wc.maxFiles > 1 && !archived {
+		if wc.opts.Shared {
+			// compress before other processes can rotate again
+			err = wc.archiveStaged()
+			wc.unlockRotation()
 			if err != nil {
 				return err
 			}
-			_, err = io.CopyN(gw, wc.file, wc.lastNewline+1)
+		} else if wc.opts.BackgroundCompress {
+			wc.compressInBackground()
+		} else {
+			// leave the compression to the caller of write
+			wc.handoff = true
+			wc.pending = r
+		}
+	}
+	if wc.opts.Preallocate {
+		return wc.preallocate()
+	}
+	return nil
+}
+
+// moveTail copies the contents beyond the last newline to the
+// beginning of the file, after header, and truncates it.
+func (wc *Writer) moveTail(header []byte) error {
+	if wc.opts.Append || len(header) > 0 {
+		// in append mode every write goes to the end of the file,
+		// and a header may not fit before the contents beyond the
+		// last newline, so read them into memory, empty the file
+		// and write them back
+		if wc.opts.Append {
+			// include what other processes have appended while
+			// the data was staged
+			fi, err := wc.file.Stat()
+			if err != nil {
+				return err
+			}
+			if fi.Size() > wc.size {
+				wc.size = fi.Size()
+			}
+		}
+		bp := copyBufs.Get().(*[]byte)
+		defer copyBufs.Put(bp)
+		buf := *bp
+		if tail := wc.size - wc.lastNewline - 1; tail <= int64(len(buf)) {
+			buf = buf[:tail]
+		} else {
+			buf = make([]byte, tail)
+		}
+		n, err := wc.file.ReadAt(buf, wc.lastNewline+1)
+		if err == io.EOF && wc.opts.Append {
+			// another process has emptied the file since it was
+			// read, leaving less, or nothing, to move
+			buf, err = buf[:n], nil
+		}
+		if err != nil {
 			return err
-		}()
+		}
+		err = wc.truncate(0)
 		if err != nil {
 			return err
 		}
+		if len(header) > 0 {
+			buf = append(header[:len(header):len(header)], buf...)
+		}
+		return wc.writeStart(buf)
 	}
 	// copy contents beyond last newline to beginning of file
 	sr := io.NewSectionReader(
@@ -170,27 +349,521 @@ func (wc *writeCloser) rotate() error {
 	if err != nil {
 		return err
 	}
-	_, err = io.Copy(wc.file, sr)
+	if err = wc.fault(FaultWrite, wc.path); err != nil {
+		return &os.PathError{Op: "write", Path: wc.path, Err: err}
+	}
+	_, err = copyBuffer(wc.file, sr)
 	if err != nil {
 		return err
 	}
 	// truncate file
-	err = wc.file.Truncate(wc.size - wc.lastNewline - 1)
+	return wc.truncate(wc.size - wc.lastNewline - 1)
+}
+
+// notifyRotate completes r with its duration and err and passes it
+// to the OnRotate and OnRotateContext functions, if any, and as an
+// Event, and records it in the History.
+func (wc *Writer) notifyRotate(r Rotation, err error) {
+	r.Duration = wc.clock.Now().Sub(r.Start)
+	r.Err = err
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	r.ctx = nil // not kept beyond the call
+	if wc.hist != nil {
+		wc.hist.add(r)
+	}
+	if wc.opts.OnRotate != nil || wc.opts.OnRotateContext != nil {
+		wc.notifyMu.Lock()
+		defer wc.notifyMu.Unlock()
+		if wc.opts.OnRotate != nil {
+			wc.opts.OnRotate(r)
+		}
+		if wc.opts.OnRotateContext != nil {
+			wc.opts.OnRotateContext(ctx, r)
+		}
+	}
+	if err != nil {
+		wc.diag(slog.LevelError, "logrot: rotation failed", "error", err)
+	} else {
+		wc.diag(slog.LevelInfo, "logrot: rotated", "archive", r.Archive,
+			"bytes", r.Bytes, "duration", r.Duration)
+	}
+	wc.emit(Rotated, wc.path, r, err)
+}
+
+// shiftArchives deletes expired gz files and renames the remainder
+// so that <path>.1.gz is free for a new archive.
+func (wc *Writer) shiftArchives() error {
+	n, err := wc.lastArchive()
 	if err != nil {
 		return err
 	}
-	// adjust recorded size
-	wc.size = wc.size - wc.lastNewline - 1
-	wc.lastNewline = -1
+	// forget n until the shift has succeeded
+	wc.archives = -1
+	// delete expired gz files
+	for ; n > wc.maxFiles-2 && n > 0; n-- {
+		if wc.opts.RemoveArchived {
+			wc.forgetSent(wc.archiveName(n))
+		}
+		err := wc.removeArchive(wc.archiveName(n))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	kept := n
+	// move each gz file up one number
+	for ; n > 0; n-- {
+		err := wc.renameArchive(wc.archiveName(n), wc.archiveName(n+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if wc.maxFiles > 1 {
+		wc.archives = kept + 1
+	} else {
+		wc.archives = 0
+	}
 	return nil
 }
 
-func (wc *writeCloser) Write(p []byte) (_ int, err error) {
+// lastArchive returns the highest n such that <path>.<n>.gz exists,
+// or zero if there is none. The result of the previous shift is
+// cached in wc.archives and is used if <path>.<n>.gz still exists and
+// <path>.<n+1>.gz does not, so normally no directory scan is needed.
+func (wc *Writer) lastArchive() (int, error) {
+	exists := func(n int) (bool, error) {
+		_, err := wc.fs.Lstat(wc.archiveName(n))
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		return err == nil, nil
+	}
+	if n := wc.archives; n >= 0 {
+		next, err := exists(n + 1)
+		if err != nil {
+			return 0, err
+		}
+		last := true
+		if n > 0 && !next {
+			last, err = exists(n)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if last && !next {
+			return n, nil
+		}
+	}
+	// find highest n such that <path>.<n>.gz exists
+	n := 0
+	for {
+		ok, err := exists(n + 1)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return n, nil
+		}
+		n++
+	}
+}
+
+// ArchiveFile describes an archive, as returned by Archives.
+type ArchiveFile struct {
+	Name    string    // such as <path>.1.gz
+	Size    int64     // bytes taken by the archive
+	ModTime time.Time // when it was written
+}
+
+// Archives returns the archives of wc, newest first.
+func (wc *Writer) Archives() ([]ArchiveFile, error) {
+	wc.rotMu.Lock()
+	defer wc.rotMu.Unlock()
+	n, err := wc.lastArchive()
+	if err != nil {
+		return nil, err
+	}
+	var files []ArchiveFile
+	for i := 1; i <= n; i++ {
+		fi, err := wc.fs.Stat(wc.archiveName(i))
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files,
+			ArchiveFile{Name: wc.archiveName(i), Size: fi.Size(), ModTime: fi.ModTime()})
+	}
+	return files, nil
+}
+
+// archiveName returns the name of archive n, <path>.<n>.gz unless
+// ArchiveDir or Encrypter is set.
+func (wc *Writer) archiveName(n int) string {
+	return fmt.Sprintf("%s.%d%s", wc.archiveBase, n, wc.archiveExt)
+}
+
+// compress writes the gzipped contents of src to archive 1. The data
+// is written to <path>.1.gz.tmp which is moved into place once
+// complete, so the archive is never left partially written. It
+// returns the SHA-256 checksum of the archive if Checksums or Manifest
+// is set.
+func (wc *Writer) compress(src io.Reader) ([]byte, error) {
+	tmp := fmt.Sprintf("%s.1.gz.tmp", wc.path)
+	w, err := wc.fs.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, wc.archivePerm())
+	if err != nil {
+		return nil, err
+	}
+	var sum checksum
+	if wc.opts.VerifyArchive {
+		src = io.TeeReader(src, &sum)
+	}
+	var out io.Writer = w
+	var digest hash.Hash
+	if wc.opts.Checksums || wc.opts.Manifest {
+		digest = sha256.New()
+		out = io.MultiWriter(w, digest)
+	}
+	var ew io.WriteCloser
+	if wc.opts.Encrypter != nil {
+		ew, err = wc.opts.Encrypter.Encrypt(out)
+		if err != nil {
+			_ = w.Close()
+			_ = wc.fs.Remove(tmp)
+			return nil, err
+		}
+	}
+	gw := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(gw)
+	if ew != nil {
+		gw.Reset(ew)
+	} else {
+		gw.Reset(out)
+	}
+	_, err = copyBuffer(gw, src)
+	if e := wc.fault(FaultGzipClose, tmp); e != nil {
+		if err == nil {
+			err = e
+		}
+	} else if e := gw.Close(); err == nil {
+		err = e
+	}
+	if ew != nil {
+		if e := ew.Close(); err == nil {
+			err = e
+		}
+	}
+	if err == nil && wc.opts.SyncOnRotate {
+		err = w.Sync()
+	}
+	if e := w.Close(); err == nil {
+		err = e
+	}
+	if err == nil && wc.opts.VerifyArchive {
+		err = verifyArchive(wc.fs, tmp, sum)
+	}
+	if err != nil {
+		_ = wc.fs.Remove(tmp)
+		return nil, err
+	}
+	err = wc.moveFile(tmp, wc.archiveName(1), wc.archivePerm())
+	if err == nil {
+		err = wc.setAttrs(wc.archiveName(1), wc.archivePerm())
+	}
+	if err != nil || digest == nil {
+		return nil, err
+	}
+	digestSum := digest.Sum(nil)
+	if wc.opts.Checksums {
+		err = wc.writeSidecar(wc.archiveName(1), digestSum)
+	}
+	return digestSum, err
+}
+
+// archivePerm returns the permissions of new archives.
+func (wc *Writer) archivePerm() os.FileMode {
+	if wc.opts.ArchivePerm != 0 {
+		return wc.opts.ArchivePerm
+	}
+	return wc.perm
+}
+
+// setAttrs sets the permissions of the file name to perm if
+// ExactPerm is set and its owner and group if Chown is set.
+func (wc *Writer) setAttrs(name string, perm os.FileMode) error {
+	if wc.opts.ExactPerm {
+		err := wc.fs.Chmod(name, perm)
+		if err != nil {
+			return err
+		}
+	}
+	if !wc.opts.Chown {
+		return nil
+	}
+	return wc.fs.Chown(name, wc.opts.Owner, wc.opts.Group)
+}
+
+// openLog opens the log file at path on fsys for reading and writing,
+// creating it with permissions perm if necessary.
+func openLog(fsys FS, path string, perm os.FileMode, appendMode bool) (File, error) {
+	flag := os.O_RDWR | os.O_CREATE
+	if appendMode {
+		flag |= os.O_APPEND
+	}
+	if _, ok := fsys.(osFS); !ok {
+		return fsys.OpenFile(path, flag, perm)
+	}
+	f, err := openFile(path, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// statLog returns the size of the file at path on fsys, or zero if
+// it does not exist, checking that it is a regular file.
+func statLog(fsys FS, path string) (int64, error) {
+	fi, err := fsys.Lstat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if fi.Mode()&os.ModeType != 0 {
+		return 0, fmt.Errorf("logrot: %s is not a regular file", path)
+	}
+	return fi.Size(), nil
+}
+
+// findLastNewline returns the position of the last byte of the last
+// occurrence of delim within the first size bytes of file, or -1 if
+// there is none. An empty delim, as in raw mode, occurs after every
+// byte.
+func findLastNewline(file File, size int64, delim []byte) (int64, error) {
+	if len(delim) == 0 {
+		return size - 1, nil
+	}
+	// determine last newline position within file by reading
+	// backwards. Each read extends into the previous one by
+	// len(delim)-1 bytes to find a delim which spans them.
+	const bufExp = 13 // 8KB buffer
+	k := int64(len(delim) - 1)
+	bp := copyBufs.Get().(*[]byte)
+	defer copyBufs.Put(bp)
+	buf := *bp
+	if int64(len(buf)) < 1<<bufExp+k {
+		buf = make([]byte, 1<<bufExp+k)
+	}
+	off := ((size - 1) >> bufExp) << bufExp
+	bufSz := size - off
+	for off >= 0 {
+		n := bufSz + k
+		if off+n > size {
+			n = size - off
+		}
+		err := readAt(file, buf[:n], off)
+		if err != nil {
+			return -1, err
+		}
+		i := bytes.LastIndex(buf[:n], delim)
+		if i != -1 {
+			return off + int64(i) + k, nil
+		}
+		off -= 1 << bufExp
+		bufSz = 1 << bufExp
+	}
+	return -1, nil
+}
+
+// writeData writes p at the end of the log file, retrying if
+// PurgeOnFull frees some space.
+func (wc *Writer) writeData(p []byte) (n int, err error) {
+	for {
+		var m int
+		if err = wc.fault(FaultWrite, wc.path); err != nil {
+			err = &os.PathError{Op: "write", Path: wc.path, Err: err}
+		} else if wc.opts.Append {
+			m, err = wc.file.Write(p[n:])
+		} else {
+			m, err = wc.file.WriteAt(p[n:], wc.size+int64(n))
+		}
+		n += m
+		if err == nil || !wc.purgeForWrite(err) {
+			return n, err
+		}
+	}
+}
+
+// Write is equivalent to WriteContext(context.Background(), p).
+func (wc *Writer) Write(p []byte) (int, error) {
+	return wc.WriteContext(context.Background(), p)
+}
+
+// WriteContext writes p to the log file, rotating it as described in
+// the comment for Open. A rotation made by the call is passed to
+// Options.OnRotateContext with ctx. In asynchronous mode ctx is not
+// used.
+func (wc *Writer) WriteContext(ctx context.Context, p []byte) (int, error) {
+	if wc.rate != nil && !wc.limitRate(p) {
+		return len(p), nil
+	}
+	q := p // p as transformed by the options
+	if wc.opts.Redact != nil {
+		q = wc.redact(q)
+	}
+	if wc.opts.JSONLines && wc.opts.MalformedJSON != KeepMalformed {
+		r, err := wc.checkJSON(q)
+		if err != nil {
+			return 0, err
+		}
+		if r != nil {
+			q = r
+		}
+	}
+	if len(q) == len(p) && (len(p) == 0 || &q[0] == &p[0]) {
+		return wc.send(ctx, p)
+	}
+	_, err := wc.send(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// send passes p to the queue in asynchronous mode and otherwise
+// writes it for the call with context ctx.
+func (wc *Writer) send(ctx context.Context, p []byte) (int, error) {
+	if wc.queue != nil {
+		n, err := wc.enqueue(p)
+		wc.checkHighWater()
+		return n, err
+	}
+	return wc.lockedWrite(ctx, p)
+}
+
+// WriteBatch is equivalent to WriteBatchContext(context.Background(),
+// lines).
+func (wc *Writer) WriteBatch(lines [][]byte) (int, error) {
+	return wc.WriteBatchContext(context.Background(), lines)
+}
+
+// WriteBatchContext writes the concatenation of lines to the log
+// file. The result is the same as writing each line with
+// WriteContext but the Writer's lock is taken once and the lines
+// reach the file in as few writes as rotation allows. It returns the
+// total number of bytes written.
+func (wc *Writer) WriteBatchContext(ctx context.Context, lines [][]byte) (int, error) {
+	b := queueBufs.Get().(*[]byte)
+	defer putQueueBuf(b)
+	for _, l := range lines {
+		*b = append(*b, l...)
+	}
+	return wc.WriteContext(ctx, *b)
+}
+
+// Rotate rotates the log file now, whatever its size, as it would be
+// once it reached maxSize, archiving the data up to its last newline.
+// It does nothing if the log file holds no complete line. As with
+// Write, if it fails the Writer fails from then on.
+func (wc *Writer) Rotate() error {
 	wc.mu.Lock()
-	defer wc.mu.Unlock()
+	err := wc.forceRotate()
+	handoff, r := wc.handoff, wc.pending
+	wc.handoff = false
+	if err != nil && wc.writeErr == nil {
+		wc.writeErr = err
+	}
+	wc.mu.Unlock()
+	if handoff {
+		if e := wc.finishRotation(r); e != nil {
+			wc.mu.Lock()
+			if wc.writeErr == nil {
+				wc.writeErr = e
+			}
+			wc.mu.Unlock()
+			if err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// forceRotate performs the work of Rotate. It assumes wc.mu is held.
+func (wc *Writer) forceRotate() error {
+	if wc.writeErr != nil {
+		return fmt.Errorf(
+			"logrot: Rotate cannot complete due to previous error: %v",
+			wc.writeErr)
+	}
+	if wc.closed {
+		return errors.New("logrot: Writer is closed")
+	}
+	if wc.fallback != nil {
+		return errors.New("logrot: writing to the fallback file")
+	}
+	err := wc.ensureOpen()
+	if err != nil {
+		return err
+	}
+	if wc.opts.Shared {
+		err = wc.lockShared()
+		if err != nil {
+			return err
+		}
+		defer unlockFile(wc.lockFile)
+	}
+	if wc.lastNewline < wc.headerEnd {
+		return nil
+	}
+	return wc.rotate()
+}
+
+// Path returns the name of the log file.
+func (wc *Writer) Path() string {
+	return wc.path
+}
+
+// lockedWrite calls write with wc.mu held, and with wc.callCtx set to
+// ctx. If a rotation during the write left an archive to be
+// compressed, it then compresses it with wc.mu released, so that only
+// this caller waits for it.
+func (wc *Writer) lockedWrite(ctx context.Context, p []byte) (int, error) {
+	wc.mu.Lock()
+	wc.callCtx = ctx
+	n, err := wc.write(p)
+	wc.callCtx = nil
+	handoff, r := wc.handoff, wc.pending
+	wc.handoff = false
+	wc.mu.Unlock()
+	if handoff {
+		if e := wc.finishRotation(r); e != nil {
+			wc.mu.Lock()
+			if wc.writeErr == nil {
+				wc.writeErr = e
+				wc.stats.Errors++
+				wc.diag(slog.LevelError, "logrot: write failed", "error", e)
+				wc.emit(WriteError, wc.path, Rotation{}, e)
+			}
+			wc.mu.Unlock()
+			if err == nil {
+				err = e
+			}
+		}
+	}
+	return n, err
+}
+
+// write performs the work of Write. It assumes wc.mu is held.
+func (wc *Writer) write(p []byte) (n int, err error) {
+	wc.stats.Writes++
 	if wc.writeErr != nil {
 		// If Write returns an error once, any subsequent calls
-		// fail. To continue writing one must create a new WriteCloser
+		// fail. To continue writing one must create a new Writer
 		// using Open.
 		return 0, fmt.Errorf(
 			"logrot: Write cannot complete due to previous error: %v",
@@ -199,33 +872,151 @@ func (wc *writeCloser) Write(p []byte) (_ int, err error) {
 	defer func() {
 		// save return value on exit
 		wc.writeErr = err
+		if err != nil {
+			wc.stats.Errors++
+			wc.diag(slog.LevelError, "logrot: write failed", "error", err)
+			wc.emit(WriteError, wc.path, Rotation{}, err)
+		} else {
+			wc.lastOK = wc.clock.Now()
+		}
 	}()
 	if wc.closed {
-		return 0, errors.New("logrot: WriteCloser is closed")
+		return 0, errors.New("logrot: Writer is closed")
+	}
+	err = wc.ensureOpen()
+	if err != nil {
+		return 0, err
+	}
+	if wc.opts.IdleClose > 0 {
+		wc.touch()
+	}
+	if wc.opts.Shared {
+		err = wc.lockShared()
+		if err != nil {
+			return 0, err
+		}
+		defer unlockFile(wc.lockFile)
+	}
+	if wc.opts.SuppressRepeats || wc.opts.TimestampFormat != "" ||
+		wc.quota != nil || wc.space != nil && wc.opts.LowSpaceKeep != nil {
+		orig := len(p)
+		// the line filters need wc.midLine, so run under wc.mu
+		if wc.space != nil && wc.opts.LowSpaceKeep != nil {
+			p = wc.keepForSpace(p)
+		}
+		if wc.quota != nil {
+			p = wc.applyQuota(p)
+		}
+		if wc.opts.SuppressRepeats {
+			p = wc.suppressRepeats(p)
+		}
+		if wc.opts.TimestampFormat != "" {
+			p = wc.stamp(p)
+		} else if len(p) > 0 {
+			wc.midLine = !bytes.HasSuffix(p, wc.delim)
+		}
+		defer func() {
+			// report the bytes of p before it was changed
+			if err == nil {
+				n = orig
+			} else {
+				n = 0
+			}
+		}()
+	}
+	if wc.fallback != nil && !wc.switchBack() {
+		return wc.writeFallback(p)
+	}
+	if wc.opts.ReopenInterval > 0 {
+		err = wc.checkReopen()
+		if err != nil {
+			return wc.failOver(0, p, err)
+		}
+	}
+	if wc.opts.CopyTruncate {
+		err = wc.checkTruncated()
+		if err != nil {
+			return wc.failOver(0, p, err)
+		}
+	}
+	if wc.space != nil {
+		err = wc.checkSpace()
+		if err != nil {
+			return wc.failOver(0, p, err)
+		}
+	}
+	if wc.rate != nil && wc.lineBreak() == nil {
+		// report dropped data between lines
+		if report := wc.dropReport(false); report != nil {
+			_, err = wc.writeSplit(report)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	var bw int
+	if wc.opts.MaxLineBytes > 0 && len(wc.delim) > 0 &&
+		wc.opts.RecordStart == nil && !wc.opts.JSONLines {
+		bw, err = wc.writeLimited(p)
+	} else {
+		bw, err = wc.writeSplit(p)
+	}
+	if err != nil {
+		return bw, err
+	}
+	if wc.opts.SyncInterval > 0 || wc.opts.SyncEveryBytes > 0 {
+		return bw, wc.syncPolicy(bw)
+	}
+	return bw, nil
+}
+
+// writeSplit writes p to the log file, splitting it where necessary
+// to rotate the log file.
+func (wc *Writer) writeSplit(p []byte) (_ int, err error) {
+	if wc.gz != nil {
+		return wc.writeLive(p)
 	}
 	bw := 0 // total bytes written
 	br := 0 // bytes read from p in each loop iteration
 	for ; len(p) > 0; p, br = p[br:], 0 {
-		// advance br a line at a time until we reach end of buffer or
-		// br+wc.size advances past wc.maxSize
-		for {
-			i := bytes.IndexByte(p[br:], '\n')
-			if i == -1 {
-				br += len(p[br:])
-				break
+		// set br to the end of the first line ending at or after
+		// maxSize, or to the end of the buffer if there is none,
+		// recording the last newline before maxSize or, failing
+		// that, the first newline found
+		fit := 0 // bytes of p that fit before maxSize
+		if room := wc.maxSize - wc.size; room > 0 {
+			fit = len(p)
+			if room < int64(fit) {
+				fit = int(room)
 			}
-			lnl := wc.size + int64(br+i)
-			if lnl < wc.maxSize || wc.lastNewline == -1 {
-				// record newline if before maxSize or first newline found
-				wc.lastNewline = lnl
+		}
+		if wc.opts.RecordStart != nil {
+			err = wc.checkBoundary(p)
+			if err != nil {
+				return bw, err
 			}
-			br += i + 1
-			if wc.size+int64(br) > wc.maxSize {
-				break
+		}
+		var i int
+		i, err = wc.lastSplit(p, fit)
+		if err != nil {
+			return bw, err
+		}
+		if i != -1 {
+			wc.lastNewline = wc.size + int64(i)
+		}
+		br = len(p)
+		i, err = wc.firstSplit(p, fit)
+		if err != nil {
+			return bw, err
+		}
+		if i != -1 {
+			if wc.lastNewline < wc.headerEnd {
+				wc.lastNewline = wc.size + int64(i)
 			}
+			br = i + 1
 		}
 		rotate := false
-		if wc.lastNewline != -1 {
+		if wc.lastNewline >= wc.headerEnd {
 			max := wc.lastNewline + 1
 			if wc.maxSize > max {
 				max = wc.maxSize
@@ -234,50 +1025,184 @@ func (wc *writeCloser) Write(p []byte) (_ int, err error) {
 				// file data + data to be written contains a newline
 				// and exceeds max(maxSize,lastNewline+1) in
 				// size. Reduce write down to this limit and schedule
-				// a rotation following the write.
+				// a rotation following the write. If the newline is
+				// part of this write, stop just after it instead so
+				// that rotate finds nothing beyond it to move.
+				if wc.lastNewline >= wc.size {
+					max = wc.lastNewline + 1
+				}
 				br = int(max - wc.size)
+				if br < 0 {
+					// the file was already too large when opened
+					br = 0
+				}
 				rotate = true
 			}
 		}
 		var n int
-		n, err = wc.file.WriteAt(p[:br], wc.size)
+		n, err = wc.writeData(p[:br])
 		bw += n
 		wc.size += int64(n)
+		wc.stats.BytesWritten += int64(n)
+		wc.updateMirror()
+		wc.replicate(p[:n])
 		if err != nil {
-			return bw, err
+			return wc.failOver(bw, p[n:], err)
 		}
 		if rotate {
 			err = wc.rotate()
 			if err != nil {
-				return bw, err
+				return wc.failOver(bw, p[br:], err)
 			}
 		}
 	}
 	return bw, nil
 }
 
-func (wc *writeCloser) Close() error {
+// Close closes the log file. Subsequent calls to Write will fail. In
+// asynchronous mode Close first waits for queued writes to complete.
+func (wc *Writer) Close() error {
+	if wc.queue != nil {
+		wc.closeQueue()
+	}
 	wc.mu.Lock()
 	defer wc.mu.Unlock()
 	if !wc.closed {
-		err := wc.file.Close()
+		if wc.syncTimer != nil {
+			wc.syncTimer.Stop()
+			wc.syncTimer = nil
+		}
+		if wc.idleTimer != nil {
+			wc.idleTimer.Stop()
+			wc.idleTimer = nil
+		}
+		if wc.writeErr == nil && wc.fallback == nil {
+			err := wc.writeReports()
+			if err != nil {
+				return err
+			}
+		}
+		if wc.unsynced > 0 {
+			err := wc.sync()
+			if err != nil {
+				return err
+			}
+		}
+		var err error
+		if wc.gz != nil {
+			err = wc.closeLive(true)
+		} else if wc.file != nil {
+			err = wc.file.Close()
+		}
+		wc.discardMirror()
+		wc.closeShadow()
 		if err != nil {
 			return err
 		}
+		if wc.fallback != nil {
+			err = wc.fallback.Close()
+			if err != nil {
+				return err
+			}
+		}
 		wc.closed = true
+		// wait for any compression in progress
+		wc.rotMu.Lock()
+		defer wc.rotMu.Unlock()
+		if wc.archiveEnd != nil {
+			wc.stopArchiving()
+		}
+		wc.closeEvents()
+		if wc.opts.RemoveArchived {
+			err = wc.closeArchived()
+		}
+		if wc.lockFile != nil {
+			if e := wc.lockFile.Close(); err == nil {
+				err = e
+			}
+		}
+		if wc.bgErr != nil {
+			return wc.bgErr
+		}
+		return err
 	}
 	return nil
 }
 
+// ensureOpen opens the log file if LazyOpen deferred opening it or
+// IdleClose closed it.
+func (wc *Writer) ensureOpen() error {
+	if wc.file != nil {
+		return nil
+	}
+	if wc.opts.CompressLive {
+		return wc.openLive()
+	}
+	if wc.idle {
+		return wc.reopen()
+	}
+	return wc.openFile()
+}
+
+// writeReports writes the lines reporting data suppressed or dropped
+// by SuppressRepeats, LowSpaceKeep, DailyQuota and RateLimit which
+// are still to be written, for Close, opening the log file if it has
+// not been opened.
+func (wc *Writer) writeReports() error {
+	var reports []byte
+	if wc.repeats > 0 {
+		reports = wc.appendRepeats(nil)
+		if wc.opts.TimestampFormat != "" {
+			reports = wc.stamp(reports)
+		}
+	}
+	if wc.space != nil {
+		reports = append(reports, wc.spaceReport()...)
+	}
+	if wc.quota != nil {
+		reports = append(reports, wc.quotaReport()...)
+	}
+	if wc.rate != nil {
+		reports = append(reports, wc.dropReport(true)...)
+	}
+	if len(reports) == 0 {
+		return nil
+	}
+	err := wc.ensureOpen()
+	if err != nil {
+		return err
+	}
+	_, err = wc.writeSplit(append(wc.lineBreak(), reports...))
+	if wc.handoff {
+		// there is no caller of write to leave the compression to
+		wc.handoff = false
+		if e := wc.finishRotation(wc.pending); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// closeFiles closes the files opened by OpenWithOptions.
+func (wc *Writer) closeFiles() error {
+	err := wc.file.Close()
+	if wc.lockFile != nil {
+		if e := wc.lockFile.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
 // Open opens the file at path for writing in append mode. If it does
 // not exist it is created with permissions of perm.
 //
-// The returned WriteCloser keeps track of the size of the file and
-// the position of the most recent newline. If during a call to Write
-// a particular byte to be written would cause the file size to exceed
-// maxSize bytes, and at least one newline has been written to the
-// file already, then a rotation occurs before the byte is written. A
-// rotation is the following procedure:
+// The returned WriteCloser, a *Writer, keeps track of the size of the
+// file and the position of the most recent newline. If during a call
+// to Write a particular byte to be written would cause the file size
+// to exceed maxSize bytes, and at least one newline has been written
+// to the file already, then a rotation occurs before the byte is
+// written. A rotation is the following procedure:
 //
 // Let N = highest n such that <path>.<n>.gz exists or zero
 // otherwise. Let M = maxFiles. Starting at n = N, while n > M-2 and n
@@ -288,58 +1213,236 @@ func (wc *writeCloser) Close() error {
 // <path> beyond the final newline are copied to the beginning of the
 // file and <path> is truncated to contain just those contents.
 //
+// So that other goroutines may continue writing while an archive is
+// compressed, the contents to be archived are first copied to
+// <path>.rotating and the truncation is done before the archives are
+// renamed. The Write that caused the rotation returns once the
+// compression has completed. If the compression is interrupted, the
+// next call to Open completes it. Open also repairs the archives left
+// by an interrupted rotation: gaps in their numbering are closed and
+// a damaged <path>.1.gz is renamed to <path>.1.gz.corrupt, or removed
+// if its contents are still waiting in <path>.rotating.
+//
 // It is safe to call Write/Close from multiple goroutines.
 func Open(path string, perm os.FileMode, maxSize int64, maxFiles int) (io.WriteCloser, error) {
+	wc, err := OpenWithOptions(path, perm, maxSize, maxFiles, nil)
+	if err != nil {
+		return nil, err
+	}
+	return wc, nil
+}
+
+// OpenWithOptions is like Open but takes additional settings in
+// opts, and returns the *Writer. A nil opts is equivalent to a zero
+// Options.
+func OpenWithOptions(path string, perm os.FileMode, maxSize int64, maxFiles int, opts *Options) (*Writer, error) {
 	if maxSize < 1 {
 		return nil, errors.New("logrot: maxSize < 1")
 	}
 	if maxFiles < 1 {
 		return nil, errors.New("logrot: maxFiles < 1")
 	}
-	// if path exists determine size and check path is a regular file.
-	var size int64
-	fi, err := os.Lstat(path)
-	if err != nil && !os.IsNotExist(err) {
-		return nil, err
+	var fsys FS = osFS{}
+	if opts != nil && opts.FS != nil {
+		fsys = opts.FS
 	}
-	if err == nil {
-		if fi.Mode()&os.ModeType != 0 {
-			return nil, fmt.Errorf("logrot: %s is not a regular file", path)
+	delim := []byte{'\n'}
+	switch {
+	case opts == nil:
+	case opts.Raw:
+		delim = nil
+	case len(opts.Delimiter) > 0:
+		delim = append([]byte(nil), opts.Delimiter...)
+	case opts.CRLF:
+		delim = []byte{'\r', '\n'}
+	}
+	wc := &Writer{
+		path:     path,
+		perm:     perm,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		fs:       fsys,
+		delim:    delim,
+		archives: -1,
+		repeats:  -1,
+	}
+	if opts != nil {
+		wc.opts = *opts
+	}
+	wc.clock = wc.opts.Clock
+	if wc.clock == nil {
+		wc.clock = systemClock{}
+	}
+	if wc.opts.Raw {
+		wc.opts.RecordStart = nil
+		wc.opts.JSONLines = false
+	}
+	if wc.opts.Raw || wc.opts.JSONLines || wc.opts.RecordStart != nil {
+		wc.opts.TimestampFormat = ""
+		wc.opts.SuppressRepeats = false
+	}
+	wc.rate = newRateLimiter(&wc.opts, wc.clock.Now())
+	if wc.opts.DailyQuota > 0 {
+		wc.quota = new(quotaState)
+	}
+	if wc.opts.Raw || wc.opts.CompressLive {
+		wc.opts.Header = ""
+		wc.opts.Footer = ""
+	}
+	if wc.opts.CompressMirror {
+		err := checkMirror(&wc.opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if wc.opts.ShadowPath != "" {
+		err := checkShadow(path, &wc.opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if wc.opts.CompressLive {
+		err := checkLive(&wc.opts)
+		if err != nil {
+			return nil, err
+		}
+		// the data is never copied
+		wc.opts.VerifyArchive = false
+		wc.opts.BackgroundCompress = false
+		wc.opts.RenameRotate = false
+	}
+	if wc.opts.Archiver != nil {
+		n := wc.opts.ArchiveConcurrency
+		if n <= 0 {
+			n = defaultArchiveConcurrency
+		}
+		wc.archiveSem = make(chan struct{}, n)
+		wc.archiveCtx, wc.archiveEnd = context.WithCancel(context.Background())
+		wc.archivedAt = wc.clock.Now()
+		if wc.opts.RetryArchives {
+			wc.retry = &retryState{
+				delay: retryMinDelay,
+				stop:  make(chan struct{}),
+			}
+		}
+	}
+	wc.archiveBase = archiveBase(path, wc.opts.ArchiveDir)
+	wc.archiveExt = ".gz"
+	if wc.opts.Encrypter != nil {
+		wc.archiveExt += wc.opts.Encrypter.Ext()
+		// the archives cannot be read back
+		wc.opts.VerifyArchive = false
+	}
+	if wc.opts.Shared {
+		wc.opts.Append = true
+		wc.opts.LockFile = true
+		wc.opts.BackgroundCompress = false
+	}
+	if wc.opts.Durable {
+		wc.opts.SyncOnRotate = true
+		wc.opts.SyncDir = true
+	}
+	if wc.opts.LockFile && !lockSupported {
+		return nil, errLockUnsupported
+	}
+	if wc.opts.MinFreeSpace > 0 && wc.opts.FS == nil {
+		if !freeSpaceSupported {
+			return nil, errFreeSpaceUnsupported
+		}
+		wc.space = new(spaceState)
+	}
+	wc.hist = newHistory(&wc.opts)
+	wc.loadHistory()
+	if wc.opts.LazyOpen {
+		// fail now if the log file could not be opened later
+		_, err := statLog(fsys, path)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err := wc.ensureOpen()
+		if err != nil {
+			return nil, err
 		}
-		size = fi.Size()
+	}
+	if wc.opts.ShadowPath != "" {
+		wc.openShadow()
+	}
+	if wc.opts.AsyncQueue > 0 {
+		wc.startQueue()
+	}
+	return wc, nil
+}
+
+// openFile opens the log file, creating it and, with MkdirAll, its
+// directory if necessary, and recovers from any rotation left
+// incomplete by an earlier process.
+func (wc *Writer) openFile() error {
+	err := wc.makeDirs()
+	if err != nil {
+		return err
+	}
+	size, err := statLog(wc.fs, wc.path)
+	if err != nil {
+		return err
 	}
 	// open path for reading/writing, creating it if necessary.
-	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, perm)
+	file, err := openLog(wc.fs, wc.path, wc.perm, wc.opts.Append)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	// determine last newline position within file by reading backwards.
-	var lastNewline int64 = -1
-	const bufExp = 13 // 8KB buffer
-	buf := make([]byte, 1<<bufExp)
-	off := ((size - 1) >> bufExp) << bufExp
-	bufSz := size - off
-	for off >= 0 {
-		_, err = file.ReadAt(buf[:bufSz], off)
+	wc.lastNewline, err = wc.findLastSplit(file, size)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	wc.midLine = wc.lastNewline != size-1
+	err = wc.setAttrs(wc.path, wc.perm)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	wc.file = file
+	wc.size = size
+	if wc.opts.Preallocate {
+		err = wc.preallocate()
 		if err != nil {
-			_ = file.Close()
-			return nil, err
+			return wc.abandonFile(err)
 		}
-		i := bytes.LastIndexByte(buf[:bufSz], '\n')
-		if i != -1 {
-			lastNewline = off + int64(i)
-			break
+	}
+	if wc.opts.LockFile {
+		wc.lockFile, err = wc.fs.OpenFile(wc.path+".lock",
+			os.O_RDWR|os.O_CREATE, wc.perm)
+		if err != nil {
+			return wc.abandonFile(err)
 		}
-		off -= 1 << bufExp
-		bufSz = 1 << bufExp
 	}
-	return &writeCloser{
-		path:        path,
-		perm:        perm,
-		maxSize:     maxSize,
-		maxFiles:    maxFiles,
-		file:        file,
-		size:        size,
-		lastNewline: lastNewline,
-	}, nil
+	if wc.maxFiles > 1 {
+		err = wc.recoverStaging()
+		if err != nil {
+			return wc.abandonFile(err)
+		}
+	}
+	err = wc.writeHeader()
+	if err != nil {
+		return wc.abandonFile(err)
+	}
+	if wc.retry != nil {
+		// retry any archives left by an earlier process
+		wc.wakeRetry()
+	}
+	if wc.opts.CompressMirror && wc.maxFiles > 1 {
+		wc.openMirror()
+	}
+	return nil
+}
+
+// abandonFile closes the files opened by openFile, which failed with
+// err, and returns err.
+func (wc *Writer) abandonFile(err error) error {
+	_ = wc.closeFiles()
+	wc.discardMirror()
+	wc.file = nil
+	wc.lockFile = nil
+	return err
 }
@@ -0,0 +1,85 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"encoding/json"
+	"expvar"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenWriteCloser(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	var w io.WriteCloser
+	w, err := Open(path, 0644, 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := w.(*Writer); !ok {
+		t.Errorf("Open returned %T, want *Writer", w)
+	}
+	if _, err := w.Write([]byte("0123456789\nabc\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "abc\n" {
+		t.Errorf("log file holds %q", data)
+	}
+	if _, err := os.Stat(path + ".1.gz"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStatsExpvar(t *testing.T) {
+	wc, err := OpenWithOptions(filepath.Join(t.TempDir(), "log"), 0644, 10, 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wc.Close()
+	for _, l := range []string{"0123456789\n", "abc\n"} {
+		if _, err := wc.Write([]byte(l)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := Stats{Writes: 2, BytesWritten: 15, Rotations: 1, Size: 4}
+	if got := wc.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	wc.PublishExpvar("logrot_test_stats")
+	var got Stats
+	err = json.Unmarshal([]byte(expvar.Get("logrot_test_stats").String()), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("expvar holds %+v, want %+v", got, want)
+	}
+}
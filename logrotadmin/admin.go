@@ -0,0 +1,203 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package logrotadmin provides an HTTP handler with which fleet
+// tooling can rotate logrot Writers and observe them remotely. Mounted
+// at /logrot/, as in
+//
+//	mux.Handle("/logrot/", http.StripPrefix("/logrot",
+//		logrotadmin.Handler(w, &logrotadmin.Options{Token: token})))
+//
+// it serves:
+//
+//	POST /rotate    rotate the log files now, as Writer.Rotate does
+//	GET /stats      the counters of each Writer, as Writer.Stats returns
+//	GET /archives   the archives of each Writer, newest first
+//
+// Each response is a JSON object whose "writers" member has an element
+// for each Writer, with its "path". The requests of a Manager's
+// handler may be given a "path" query parameter to select one of its
+// Writers, and the response to GET /stats also has the "usage" of all
+// of them, as Manager.Usage returns.
+package logrotadmin // import "xi2.org/x/logrot/logrotadmin"
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"xi2.org/x/logrot"
+)
+
+// Options are the settings of a handler.
+type Options struct {
+	// Token, if non-empty, must be presented by each request in the
+	// header "Authorization: Bearer <Token>".
+	Token string
+
+	// Authorize, if non-nil, is called with each request which has
+	// passed any Token check and must return true for it to be
+	// served, so that other schemes, such as client certificates,
+	// can be used. If both Token and Authorize are empty, every
+	// request is refused unless Insecure is set.
+	Authorize func(r *http.Request) bool
+
+	// Insecure, if true and Token and Authorize are empty, serves
+	// every request, which is safe only behind other
+	// authentication.
+	Insecure bool
+}
+
+// handler is the http.Handler returned by Handler and ManagerHandler.
+type handler struct {
+	writers func() []*logrot.Writer
+	manager *logrot.Manager // nil for a single Writer
+	opts    Options
+}
+
+// Handler returns a handler for the Writer wc.
+func Handler(wc *logrot.Writer, opts *Options) http.Handler {
+	h := &handler{writers: func() []*logrot.Writer { return []*logrot.Writer{wc} }}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+// ManagerHandler returns a handler for the Writers of m.
+func ManagerHandler(m *logrot.Manager, opts *Options) http.Handler {
+	h := &handler{writers: m.Writers, manager: m}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+// writerStatus is an element of the "writers" member of a response.
+type writerStatus struct {
+	Path     string               `json:"path"`
+	Stats    *logrot.Stats        `json:"stats,omitempty"`
+	Archives []logrot.ArchiveFile `json:"archives,omitempty"`
+	Rotated  bool                 `json:"rotated,omitempty"`
+	Error    string               `json:"error,omitempty"`
+}
+
+// response is the body of a response.
+type response struct {
+	Writers []writerStatus `json:"writers"`
+	Usage   *int64         `json:"usage,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="logrot"`)
+		reply(w, http.StatusUnauthorized, &response{Error: "unauthorized"})
+		return
+	}
+	var method string
+	var do func(wc *logrot.Writer, s *writerStatus) error
+	op := strings.TrimSuffix(r.URL.Path, "/")
+	switch op {
+	case "/rotate":
+		method = http.MethodPost
+		do = func(wc *logrot.Writer, s *writerStatus) error {
+			err := wc.Rotate()
+			s.Rotated = err == nil
+			return err
+		}
+	case "/stats":
+		method = http.MethodGet
+		do = func(wc *logrot.Writer, s *writerStatus) error {
+			st := wc.Stats()
+			s.Stats = &st
+			return nil
+		}
+	case "/archives":
+		method = http.MethodGet
+		do = func(wc *logrot.Writer, s *writerStatus) error {
+			var err error
+			s.Archives, err = wc.Archives()
+			return err
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != method && !(method == http.MethodGet && r.Method == http.MethodHead) {
+		w.Header().Set("Allow", method)
+		reply(w, http.StatusMethodNotAllowed, &response{Error: "method not allowed"})
+		return
+	}
+	resp := &response{Writers: []writerStatus{}}
+	status := http.StatusOK
+	path := r.URL.Query().Get("path")
+	for _, wc := range h.writers() {
+		if path != "" && wc.Path() != path {
+			continue
+		}
+		s := writerStatus{Path: wc.Path()}
+		if err := do(wc, &s); err != nil {
+			s.Error = err.Error()
+			status = http.StatusInternalServerError
+		}
+		resp.Writers = append(resp.Writers, s)
+	}
+	if path != "" && len(resp.Writers) == 0 {
+		reply(w, http.StatusNotFound, &response{Error: "no Writer of " + path})
+		return
+	}
+	if h.manager != nil && op == "/stats" && path == "" {
+		usage, err := h.manager.Usage()
+		if err != nil {
+			resp.Error = err.Error()
+			status = http.StatusInternalServerError
+		} else {
+			resp.Usage = &usage
+		}
+	}
+	reply(w, status, resp)
+}
+
+// authorized reports whether r may be served.
+func (h *handler) authorized(r *http.Request) bool {
+	if h.opts.Token == "" && h.opts.Authorize == nil && !h.opts.Insecure {
+		return false
+	}
+	if h.opts.Token != "" {
+		auth := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if len(token) == len(auth) ||
+			subtle.ConstantTimeCompare([]byte(token), []byte(h.opts.Token)) != 1 {
+			return false
+		}
+	}
+	return h.opts.Authorize == nil || h.opts.Authorize(r)
+}
+
+// reply writes resp as the JSON body of a response with status.
+func reply(w http.ResponseWriter, status int, resp *response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,57 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrotadmin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"xi2.org/x/logrot"
+)
+
+func TestNilOptionsRejectsRotate(t *testing.T) {
+	wc, err := logrot.OpenWithOptions(filepath.Join(t.TempDir(), "log"), 0644, 1000, 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wc.Close()
+	if _, err := wc.Write([]byte("line\n")); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []*Options{nil, {}} {
+		rec := httptest.NewRecorder()
+		Handler(wc, opts).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rotate", nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("POST /rotate with %v: status %d, want %d", opts, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	if st := wc.Stats(); st.Rotations != 0 {
+		t.Errorf("rotations = %d, want 0", st.Rotations)
+	}
+	rec := httptest.NewRecorder()
+	Handler(wc, &Options{Insecure: true}).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rotate", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("POST /rotate with Insecure: status %d, want %d", rec.Code, http.StatusOK)
+	}
+}
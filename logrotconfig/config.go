@@ -0,0 +1,389 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package logrotconfig loads the settings of a logrot.Writer from a
+// YAML or TOML file, so that rotation can be configured declaratively
+// and the same configuration reused across services. The logrot
+// command reads such files with its -c flag. A YAML example:
+//
+//	path: /var/log/myapp.log
+//	perm: "0640"
+//	size: 100M
+//	files: 10
+//	compression:
+//	  background: true
+//	  checksums: true
+//	retention:
+//	  remove_archived: true
+//	  keep_local: 2
+//	archiver:
+//	  type: s3
+//	  bucket: logs
+//	  prefix: web-1/
+//
+// The equivalent TOML uses the same keys, with compression, retention
+// and archiver as tables. Unknown keys are errors.
+//
+// An archiver type is only known once the package under
+// xi2.org/x/logrot/archivers which provides it is imported, as it
+// registers itself with RegisterArchiver, so that a program links in
+// only the archivers it uses. For the example above:
+//
+//	import _ "xi2.org/x/logrot/archivers/s3rot"
+//
+// Watch applies changes to the rotation settings in a file to Writers
+// already open, so that they can be retuned without a restart.
+package logrotconfig // import "xi2.org/x/logrot/logrotconfig"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"xi2.org/x/logrot"
+)
+
+// Config holds the settings of a Writer. Only Path is required; the
+// other fields default as described.
+type Config struct {
+	// Path is the log file.
+	Path string `yaml:"path" toml:"path"`
+
+	// Perm is the permissions of created files, in octal, such as
+	// "0640". The default is "0644".
+	Perm string `yaml:"perm" toml:"perm"`
+
+	// Size is the size at which the log file is rotated, as for
+	// ParseSize. The default is "10M".
+	Size string `yaml:"size" toml:"size"`
+
+	// Files is the number of files kept, the log file and its
+	// archives. The default is 10.
+	Files int `yaml:"files" toml:"files"`
+
+	// ArchiveDir, Append, Shared and Durable set the Options fields
+	// of the same names.
+	ArchiveDir string `yaml:"archive_dir" toml:"archive_dir"`
+	Append     bool   `yaml:"append" toml:"append"`
+	Shared     bool   `yaml:"shared" toml:"shared"`
+	Durable    bool   `yaml:"durable" toml:"durable"`
+
+	Compression Compression `yaml:"compression" toml:"compression"`
+	Retention   Retention   `yaml:"retention" toml:"retention"`
+
+	// Archiver, if present, sends each archive to a destination.
+	Archiver *Archiver `yaml:"archiver" toml:"archiver"`
+}
+
+// Compression holds the settings for compressing archives.
+type Compression struct {
+	Background bool `yaml:"background" toml:"background"` // BackgroundCompress
+	Verify     bool `yaml:"verify" toml:"verify"`         // VerifyArchive
+	Checksums  bool `yaml:"checksums" toml:"checksums"`   // Checksums
+
+	// Perm is the permissions of the archives, in octal. The
+	// default is Config.Perm.
+	Perm string `yaml:"perm" toml:"perm"`
+}
+
+// Retention holds the settings for removing archives besides the
+// limit of Config.Files.
+type Retention struct {
+	PurgeOnFull    bool `yaml:"purge_on_full" toml:"purge_on_full"`     // PurgeOnFull
+	PurgeKeep      int  `yaml:"purge_keep" toml:"purge_keep"`           // PurgeKeep
+	RemoveArchived bool `yaml:"remove_archived" toml:"remove_archived"` // RemoveArchived
+	KeepLocal      int  `yaml:"keep_local" toml:"keep_local"`           // KeepLocal
+}
+
+// Archiver selects and configures one of the Archivers under
+// xi2.org/x/logrot/archivers. Type is one of "s3", "gcs", "azblob",
+// "sftp", "webhook" and "exec", or another type registered with
+// RegisterArchiver; the other fields are those of the Config of that
+// package which apply to it.
+type Archiver struct {
+	Type string `yaml:"type" toml:"type"`
+
+	Bucket       string `yaml:"bucket" toml:"bucket"`               // s3, gcs
+	Prefix       string `yaml:"prefix" toml:"prefix"`               // s3, gcs, azblob
+	Region       string `yaml:"region" toml:"region"`               // s3
+	StorageClass string `yaml:"storage_class" toml:"storage_class"` // s3, gcs
+
+	CredentialsFile string `yaml:"credentials_file" toml:"credentials_file"` // gcs
+
+	Container        string `yaml:"container" toml:"container"`                 // azblob
+	ConnectionString string `yaml:"connection_string" toml:"connection_string"` // azblob
+	ServiceURL       string `yaml:"service_url" toml:"service_url"`             // azblob
+	Tier             string `yaml:"tier" toml:"tier"`                           // azblob
+
+	Addr           string `yaml:"addr" toml:"addr"`                         // sftp
+	User           string `yaml:"user" toml:"user"`                         // sftp
+	Dir            string `yaml:"dir" toml:"dir"`                           // sftp, exec
+	KeyFile        string `yaml:"key_file" toml:"key_file"`                 // sftp
+	KnownHostsFile string `yaml:"known_hosts_file" toml:"known_hosts_file"` // sftp
+
+	URL      string            `yaml:"url" toml:"url"`             // webhook
+	Header   map[string]string `yaml:"header" toml:"header"`       // webhook
+	SendBody bool              `yaml:"send_body" toml:"send_body"` // webhook
+
+	Command []string `yaml:"command" toml:"command"` // exec
+	Stdin   bool     `yaml:"stdin" toml:"stdin"`     // exec
+	Env     []string `yaml:"env" toml:"env"`         // exec
+
+	// Timeout is a duration such as "30s", for sftp and exec.
+	Timeout string `yaml:"timeout" toml:"timeout"`
+
+	// Concurrency, Retry and RetryMaxDelay set ArchiveConcurrency,
+	// RetryArchives and RetryMaxDelay, a duration such as "10m".
+	Concurrency   int    `yaml:"concurrency" toml:"concurrency"`
+	Retry         bool   `yaml:"retry" toml:"retry"`
+	RetryMaxDelay string `yaml:"retry_max_delay" toml:"retry_max_delay"`
+}
+
+// Load reads the Config in the file name, which is parsed as TOML if
+// its name ends in ".toml" and as YAML otherwise.
+func Load(name string) (*Config, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	format := "yaml"
+	if strings.EqualFold(filepath.Ext(name), ".toml") {
+		format = "toml"
+	}
+	c, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("logrotconfig: %s: %w", name, err)
+	}
+	return c, nil
+}
+
+// Parse parses data as a Config in format, "yaml" or "toml".
+func Parse(data []byte, format string) (*Config, error) {
+	c := new(Config)
+	switch format {
+	case "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err := dec.Decode(c)
+		if err != nil && !(errors.Is(err, io.EOF) && len(bytes.TrimSpace(data)) == 0) {
+			return nil, err
+		}
+	case "toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return nil, err
+		}
+		if keys := md.Undecoded(); len(keys) > 0 {
+			return nil, fmt.Errorf("unknown key %q", keys[0].String())
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	return c, nil
+}
+
+// ParseSize parses a size in bytes with an optional suffix K, M or G
+// multiplying it by 1<<10, 1<<20 or 1<<30.
+func ParseSize(s string) (int64, error) {
+	shift := 0
+	switch {
+	case strings.HasSuffix(s, "K"):
+		shift = 10
+	case strings.HasSuffix(s, "M"):
+		shift = 20
+	case strings.HasSuffix(s, "G"):
+		shift = 30
+	}
+	if shift != 0 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, errors.New("size must be positive")
+	}
+	if n > (1<<63-1)>>shift {
+		return 0, errors.New("size too large")
+	}
+	return n << shift, nil
+}
+
+// Open opens a Writer with the settings of c.
+func (c *Config) Open() (*logrot.Writer, error) {
+	if c.Path == "" {
+		return nil, errors.New("logrotconfig: no path")
+	}
+	perm, err := parsePerm(c.Perm, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s, err := c.Settings()
+	if err != nil {
+		return nil, err
+	}
+	opts, err := c.Options()
+	if err != nil {
+		return nil, err
+	}
+	return logrot.OpenWithOptions(c.Path, perm, s.MaxSize, s.MaxFiles, opts)
+}
+
+// Settings returns the settings of c which can be changed while a
+// Writer is in use: Size, Files, Compression and Retention, less
+// Retention.RemoveArchived.
+func (c *Config) Settings() (logrot.Settings, error) {
+	s := logrot.Settings{
+		MaxSize:            10 << 20,
+		MaxFiles:           c.Files,
+		BackgroundCompress: c.Compression.Background,
+		VerifyArchive:      c.Compression.Verify,
+		Checksums:          c.Compression.Checksums,
+		PurgeOnFull:        c.Retention.PurgeOnFull,
+		PurgeKeep:          c.Retention.PurgeKeep,
+		KeepLocal:          c.Retention.KeepLocal,
+	}
+	var err error
+	if c.Size != "" {
+		s.MaxSize, err = ParseSize(c.Size)
+		if err != nil {
+			return s, fmt.Errorf("logrotconfig: size %q: %w", c.Size, err)
+		}
+	}
+	if s.MaxFiles == 0 {
+		s.MaxFiles = 10
+	}
+	if c.Compression.Perm != "" {
+		s.ArchivePerm, err = parsePerm(c.Compression.Perm, 0)
+		if err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+// Options returns the Options set by c. If c has an Archiver it is
+// created, which may connect to its destination.
+func (c *Config) Options() (*logrot.Options, error) {
+	opts := &logrot.Options{
+		ArchiveDir:         c.ArchiveDir,
+		Append:             c.Append,
+		Shared:             c.Shared,
+		Durable:            c.Durable,
+		BackgroundCompress: c.Compression.Background,
+		VerifyArchive:      c.Compression.Verify,
+		Checksums:          c.Compression.Checksums,
+		PurgeOnFull:        c.Retention.PurgeOnFull,
+		PurgeKeep:          c.Retention.PurgeKeep,
+		RemoveArchived:     c.Retention.RemoveArchived,
+		KeepLocal:          c.Retention.KeepLocal,
+	}
+	var err error
+	if c.Compression.Perm != "" {
+		opts.ArchivePerm, err = parsePerm(c.Compression.Perm, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if a := c.Archiver; a != nil {
+		opts.Archiver, err = a.archiver()
+		if err != nil {
+			return nil, err
+		}
+		opts.ArchiveConcurrency = a.Concurrency
+		opts.RetryArchives = a.Retry
+		opts.RetryMaxDelay, err = parseDuration("retry_max_delay", a.RetryMaxDelay)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+var (
+	archiversMu sync.Mutex
+	archivers   = make(map[string]func(a *Archiver) (logrot.Archiver, error))
+)
+
+// RegisterArchiver makes the archiver type typ available, creating its
+// Archivers with fn from the settings in a. It is called from the
+// init function of the package which provides the Archiver. It panics
+// if typ is already registered.
+func RegisterArchiver(typ string, fn func(a *Archiver) (logrot.Archiver, error)) {
+	archiversMu.Lock()
+	defer archiversMu.Unlock()
+	if _, ok := archivers[typ]; ok {
+		panic("logrotconfig: archiver type " + strconv.Quote(typ) + " registered twice")
+	}
+	archivers[typ] = fn
+}
+
+// ParseTimeout parses a.Timeout, returning zero if it is empty.
+func (a *Archiver) ParseTimeout() (time.Duration, error) {
+	return parseDuration("timeout", a.Timeout)
+}
+
+// archiver creates the Archiver described by a.
+func (a *Archiver) archiver() (logrot.Archiver, error) {
+	archiversMu.Lock()
+	fn := archivers[a.Type]
+	archiversMu.Unlock()
+	if fn == nil {
+		return nil, fmt.Errorf("logrotconfig: unknown archiver type %q", a.Type)
+	}
+	return fn(a)
+}
+
+// parsePerm parses the octal permissions s, returning def if s is
+// empty.
+func parsePerm(s string, def os.FileMode) (os.FileMode, error) {
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n&^0777 != 0 {
+		return 0, fmt.Errorf("logrotconfig: invalid permissions %q", s)
+	}
+	return os.FileMode(n), nil
+}
+
+// parseDuration parses the duration s of the setting key, returning
+// zero if s is empty.
+func parseDuration(key, s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("logrotconfig: %s: %w", key, err)
+	}
+	return d, nil
+}
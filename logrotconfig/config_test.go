@@ -0,0 +1,131 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrotconfig
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"xi2.org/x/logrot"
+)
+
+// testArchiver is registered as the archiver type "test".
+type testArchiver struct {
+	url string
+}
+
+func (a *testArchiver) Archive(ctx context.Context, name string, meta logrot.ArchiveMeta) error {
+	return nil
+}
+
+func init() {
+	RegisterArchiver("test", func(a *Archiver) (logrot.Archiver, error) {
+		return &testArchiver{url: a.URL}, nil
+	})
+}
+
+func TestParse(t *testing.T) {
+	want := &Config{
+		Path:        "/var/log/app.log",
+		Size:        "100M",
+		Files:       3,
+		Compression: Compression{Background: true},
+		Archiver:    &Archiver{Type: "test", URL: "http://example.com/"},
+	}
+	for format, data := range map[string]string{
+		"yaml": `
+path: /var/log/app.log
+size: 100M
+files: 3
+compression:
+  background: true
+archiver:
+  type: test
+  url: http://example.com/
+`,
+		"toml": `
+path = "/var/log/app.log"
+size = "100M"
+files = 3
+[compression]
+background = true
+[archiver]
+type = "test"
+url = "http://example.com/"
+`,
+	} {
+		c, err := Parse([]byte(data), format)
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		if !reflect.DeepEqual(c, want) {
+			t.Errorf("%s: parsed %+v, want %+v", format, c, want)
+		}
+	}
+	if _, err := Parse([]byte("path: x\nsizes: 1M\n"), "yaml"); err == nil {
+		t.Error("unknown YAML key parsed")
+	}
+	if _, err := Parse([]byte("path = \"x\"\nsizes = \"1M\"\n"), "toml"); err == nil {
+		t.Error("unknown TOML key parsed")
+	}
+}
+
+func TestSettings(t *testing.T) {
+	s, err := (&Config{}).Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.MaxSize != 10<<20 || s.MaxFiles != 10 {
+		t.Errorf("default MaxSize %d, MaxFiles %d", s.MaxSize, s.MaxFiles)
+	}
+	for _, size := range []string{"0", "-1K", "1T", "9999999999G"} {
+		if _, err := (&Config{Size: size}).Settings(); err == nil {
+			t.Errorf("size %q accepted", size)
+		}
+	}
+}
+
+func TestArchiver(t *testing.T) {
+	opts, err := (&Config{Archiver: &Archiver{Type: "test", URL: "u", Concurrency: 2}}).Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := opts.Archiver.(*testArchiver); !ok || a.url != "u" {
+		t.Errorf("Archiver is %#v", opts.Archiver)
+	}
+	if opts.ArchiveConcurrency != 2 {
+		t.Errorf("ArchiveConcurrency is %d", opts.ArchiveConcurrency)
+	}
+	_, err = (&Config{Archiver: &Archiver{Type: "s3"}}).Options()
+	if err == nil || !strings.Contains(err.Error(), `unknown archiver type "s3"`) {
+		t.Errorf("unregistered archiver type: %v", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterArchiver did not panic on a duplicate type")
+		}
+	}()
+	RegisterArchiver("test", nil)
+}
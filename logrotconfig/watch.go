@@ -0,0 +1,133 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrotconfig
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"xi2.org/x/logrot"
+)
+
+// defaultWatchInterval is how often Watch checks the file by default.
+const defaultWatchInterval = 5 * time.Second
+
+// Watcher reloads a settings file when it changes, as returned by
+// Watch.
+type Watcher struct {
+	name    string
+	writers []*logrot.Writer
+	onError func(error)
+	fi      os.FileInfo // the file when last loaded
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Watch checks the file name every interval, or every five seconds if
+// interval is zero, and each time it has changed loads it and applies
+// its Settings to each of writers with Writer.Update, so that rotation
+// can be retuned, say across a fleet, by changing the file, without
+// restarting. The other settings, such as Path and Archiver, are not
+// reloaded. An error in loading the file, which leaves every Writer
+// as it was, or in updating a Writer is passed to onError, if it is
+// not nil. Watch does not apply the file as it is when called, which
+// is taken to be what writers were opened with.
+func Watch(name string, interval time.Duration, onError func(error), writers ...*logrot.Writer) (*Watcher, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	w := &Watcher{
+		name:    name,
+		writers: writers,
+		onError: onError,
+		fi:      fi,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.run(interval)
+	return w, nil
+}
+
+// run checks the file every interval until w is closed.
+func (w *Watcher) run(interval time.Duration) {
+	defer close(w.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-t.C:
+			w.check()
+		}
+	}
+}
+
+// check reloads the file if it has changed since it was last loaded.
+func (w *Watcher) check() {
+	fi, err := os.Stat(w.name)
+	if err != nil {
+		w.error(err)
+		return
+	}
+	if fi.ModTime().Equal(w.fi.ModTime()) && fi.Size() == w.fi.Size() &&
+		os.SameFile(fi, w.fi) {
+		return
+	}
+	w.fi = fi
+	c, err := Load(w.name)
+	if err != nil {
+		w.error(err)
+		return
+	}
+	s, err := c.Settings()
+	if err != nil {
+		w.error(err)
+		return
+	}
+	for _, wc := range w.writers {
+		if err := wc.Update(s); err != nil {
+			w.error(err)
+		}
+	}
+}
+
+// error passes err to w.onError, if set.
+func (w *Watcher) error(err error) {
+	if w.onError != nil {
+		w.onError(err)
+	}
+}
+
+// Close stops w, waiting for any reload in progress to finish.
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() { close(w.stop) })
+	<-w.done
+	return nil
+}
@@ -0,0 +1,337 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrotrepl
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"xi2.org/x/logrot"
+)
+
+// defaultBuffer is used when ClientOptions.Buffer is zero or less.
+const defaultBuffer = 4 << 20
+
+// Delays between attempts to connect to the Server.
+const (
+	minRedial = 100 * time.Millisecond
+	maxRedial = 30 * time.Second
+)
+
+// ClientOptions are the settings of a Client.
+type ClientOptions struct {
+	// Name is sent to the Server, whose Open function it selects
+	// the Writer with. The Server refuses a name containing a path
+	// separator or NUL, or beginning with '.'.
+	Name string
+
+	// Secret, if not empty, is sent to the Server to be compared
+	// with its Options.Secret.
+	Secret string
+
+	// Buffer is the most data, in bytes, held waiting to be sent.
+	// If zero, 4MiB is used.
+	Buffer int
+
+	// Dial, if non-nil, is used to connect to the Server in place of
+	// net.Dial, such as to use TLS.
+	Dial func() (net.Conn, error)
+
+	// OnError, if non-nil, is called with each error connecting to
+	// or sending to the Server, from the Client's goroutine.
+	OnError func(error)
+}
+
+// ClientStats holds counters describing the activity of a Client.
+type ClientStats struct {
+	Sent      int64 // bytes of data sent
+	Dropped   int64 // bytes of data lost
+	Queued    int   // bytes of data waiting to be sent
+	Connected bool  // connected to the Server
+}
+
+// A Client sends what a logrot.Writer writes to a Server. It
+// implements logrot.Replica.
+type Client struct {
+	opts ClientOptions
+	done chan struct{} // closed when run returns
+
+	mu     sync.Mutex // guards the fields below
+	cond   *sync.Cond // signalled when frames are queued or on Close
+	frames []frame    // waiting to be sent
+	lost   int64      // bytes lost since the last gap frame queued
+	stats  ClientStats
+	closed bool
+}
+
+// frame is a frame waiting to be sent.
+type frame struct {
+	kind byte
+	p    []byte
+}
+
+var _ logrot.Replica = (*Client)(nil)
+
+// NewClient returns a Client sending to the Server at address on the
+// named network, as for net.Dial, unless opts.Dial is set. It
+// connects in the background, and again whenever the connection is
+// lost.
+func NewClient(network, address string, opts *ClientOptions) *Client {
+	c := &Client{done: make(chan struct{})}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.Buffer <= 0 {
+		c.opts.Buffer = defaultBuffer
+	}
+	if c.opts.Dial == nil {
+		c.opts.Dial = func() (net.Conn, error) {
+			return net.DialTimeout(network, address, 10*time.Second)
+		}
+	}
+	c.cond = sync.NewCond(&c.mu)
+	go c.run()
+	return c
+}
+
+// hello returns the payload of the hello frame.
+func (c *Client) hello() []byte {
+	p := []byte(c.opts.Name)
+	if c.opts.Secret != "" {
+		p = append(append(p, 0), c.opts.Secret...)
+	}
+	return p
+}
+
+// Append queues p to be sent, or counts it as lost if the queue is
+// full.
+func (c *Client) Append(p []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	if c.stats.Queued+len(p) > c.opts.Buffer {
+		c.lose(int64(len(p)))
+		return
+	}
+	c.queueGap()
+	c.stats.Queued += len(p)
+	for len(p) > 0 {
+		n := len(p)
+		if n > maxFrame {
+			n = maxFrame
+		}
+		c.frames = append(c.frames, frame{frameData, append([]byte(nil), p[:n]...)})
+		p = p[n:]
+	}
+	c.cond.Signal()
+}
+
+// Rotated queues the rotation to be sent.
+func (c *Client) Rotated(r logrot.Rotation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.queueGap()
+	c.frames = append(c.frames, frame{kind: frameRotate})
+	c.cond.Signal()
+}
+
+// lose counts n bytes of data as lost. It assumes c.mu is held.
+func (c *Client) lose(n int64) {
+	c.lost += n
+	c.stats.Dropped += n
+}
+
+// queueGap queues a gap frame for any data lost since the last. It
+// assumes c.mu is held.
+func (c *Client) queueGap() {
+	if c.lost == 0 {
+		return
+	}
+	p := make([]byte, 8)
+	binary.BigEndian.PutUint64(p, uint64(c.lost))
+	c.frames = append(c.frames, frame{frameGap, p})
+	c.lost = 0
+}
+
+// Stats returns a snapshot of the counters for c.
+func (c *Client) Stats() ClientStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Close sends what is queued, trying once more to connect if not
+// connected, and disconnects. It should be called after the Writer
+// is closed, so that its last writes are sent.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	<-c.done
+	return nil
+}
+
+// run connects to the Server and sends it the queued frames until c
+// is closed.
+func (c *Client) run() {
+	defer close(c.done)
+	var conn net.Conn
+	var w *bufio.Writer
+	delay := time.Duration(0)
+	for {
+		c.mu.Lock()
+		for len(c.frames) == 0 && !c.closed {
+			c.cond.Wait()
+		}
+		frames, closed := c.frames, c.closed
+		c.frames = nil
+		c.mu.Unlock()
+		if conn == nil {
+			var err error
+			conn, err = c.opts.Dial()
+			if err == nil {
+				w = bufio.NewWriter(conn)
+				err = writeFrame(w, frameHello, c.hello())
+				if err != nil {
+					_ = conn.Close()
+					conn = nil
+				}
+			}
+			if err != nil {
+				c.error(err)
+				if closed {
+					c.discard(frames)
+					return
+				}
+				c.requeue(frames)
+				if delay == 0 {
+					delay = minRedial
+				} else if delay < maxRedial {
+					delay *= 2
+				}
+				c.sleep(delay)
+				continue
+			}
+			delay = 0
+			c.setConnected(true)
+		}
+		err := c.send(w, frames)
+		if err != nil {
+			c.error(err)
+			_ = conn.Close()
+			conn = nil
+			c.setConnected(false)
+			c.discard(frames)
+		}
+		if closed {
+			if conn != nil {
+				_ = conn.Close()
+				c.setConnected(false)
+			}
+			return
+		}
+	}
+}
+
+// send writes frames to w and flushes it.
+func (c *Client) send(w *bufio.Writer, frames []frame) error {
+	var sent int
+	for _, f := range frames {
+		err := writeFrame(w, f.kind, f.p)
+		if err != nil {
+			return err
+		}
+		if f.kind == frameData {
+			sent += len(f.p)
+		}
+	}
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.stats.Sent += int64(sent)
+	c.stats.Queued -= sent
+	c.mu.Unlock()
+	return nil
+}
+
+// requeue puts frames, not sent, back at the front of the queue,
+// for the next connection.
+func (c *Client) requeue(frames []frame) {
+	c.mu.Lock()
+	c.frames = append(frames, c.frames...)
+	c.mu.Unlock()
+}
+
+// discard counts the data of frames, which may not have been
+// received, as lost.
+func (c *Client) discard(frames []frame) {
+	var n int
+	for _, f := range frames {
+		if f.kind == frameData {
+			n += len(f.p)
+		}
+	}
+	c.mu.Lock()
+	c.stats.Queued -= n
+	c.lose(int64(n))
+	c.mu.Unlock()
+}
+
+// sleep waits for d, or until c is closed.
+func (c *Client) sleep(d time.Duration) {
+	t := time.AfterFunc(d, func() {
+		c.mu.Lock()
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	})
+	defer t.Stop()
+	deadline := time.Now().Add(d)
+	c.mu.Lock()
+	for !c.closed && time.Now().Before(deadline) {
+		c.cond.Wait()
+	}
+	c.mu.Unlock()
+}
+
+func (c *Client) setConnected(b bool) {
+	c.mu.Lock()
+	c.stats.Connected = b
+	c.mu.Unlock()
+}
+
+// error passes err to OnError, if set.
+func (c *Client) error(err error) {
+	if c.opts.OnError != nil {
+		c.opts.OnError(err)
+	}
+}
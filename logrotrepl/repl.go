@@ -0,0 +1,139 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package logrotrepl keeps a copy of the files of a logrot.Writer on
+// another host, for a hot standby. A Client, set as the Replica of
+// the Writer, streams what is written to the log file and each
+// rotation to a Server, which writes them to a logrot.Writer of its
+// own, so that the same log file and archives are built there:
+//
+//	c := logrotrepl.NewClient("tcp", "standby:5170",
+//		&logrotrepl.ClientOptions{Name: "app", Secret: secret})
+//	w, err := logrot.OpenWithOptions("app.log", 0644, 10<<20, 10,
+//		&logrot.Options{Replica: c})
+//
+// and on the standby
+//
+//	s, err := logrotrepl.Listen("tcp", ":5170", &logrotrepl.Options{
+//		Secret: secret,
+//		Open: func(name string) (*logrot.Writer, error) {
+//			path := filepath.Join("/var/log/standby", name+".log")
+//			return logrot.OpenWithOptions(path, 0644, math.MaxInt64, 10, nil)
+//		},
+//	})
+//
+// A Server accepts only names which can name a file in a directory,
+// with no path separator, NUL or leading '.', so that a Client cannot
+// write outside the directory chosen by Open. A Server must be given
+// a Secret, or an Authorize function, to decide who may write to its
+// log files, and the connection should be protected with TLS if it
+// crosses an untrusted network.
+//
+// The Client queues what it sends, so a slow or unreachable Server
+// never delays the Writer. Data which does not fit in the queue, or
+// is lost with a connection, is reported to the Server as a gap, and
+// the copy of the log file lacks it until the next rotation.
+package logrotrepl // import "xi2.org/x/logrot/logrotrepl"
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// The kinds of frame sent by a Client. Each frame is its kind, the
+// length of its payload as 4 bytes big-endian, then the payload. The
+// payload of the hello frame is the Client's Name, followed by NUL
+// and its Secret if it has one.
+const (
+	frameHello  = 'H' // sent first
+	frameData   = 'D' // data appended to the log file
+	frameRotate = 'R' // the log file was rotated; no payload
+	frameGap    = 'G' // bytes lost, as 8 bytes big-endian
+)
+
+// maxFrame is the largest payload sent in one frame.
+const maxFrame = 1 << 20
+
+// errFrameTooLarge is returned by readFrame for a payload larger than
+// maxFrame.
+var errFrameTooLarge = errors.New("logrotrepl: frame too large")
+
+// GapError is passed to Options.OnError when a Client reports data
+// lost on the way, so that the copy of the log file lacks it.
+type GapError struct {
+	Name string // the Client's Name
+	Lost int64  // bytes lost
+}
+
+func (e *GapError) Error() string {
+	return fmt.Sprintf("logrotrepl: %q lost %d bytes", e.Name, e.Lost)
+}
+
+// checkName returns an error if name cannot name a file in a
+// directory.
+func checkName(name string) error {
+	if name == "" || name[0] == '.' || strings.ContainsAny(name, "/\\\x00") ||
+		filepath.Base(name) != name {
+		return fmt.Errorf("logrotrepl: invalid name %q", name)
+	}
+	return nil
+}
+
+// writeFrame writes a frame of kind with payload p to w.
+func writeFrame(w *bufio.Writer, kind byte, p []byte) error {
+	var hdr [5]byte
+	hdr[0] = kind
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(p)))
+	_, err := w.Write(hdr[:])
+	if err == nil {
+		_, err = w.Write(p)
+	}
+	return err
+}
+
+// readFrame reads a frame from r, returning its payload in buf if it
+// is large enough.
+func readFrame(r *bufio.Reader, buf []byte) (kind byte, p []byte, err error) {
+	var hdr [5]byte
+	_, err = io.ReadFull(r, hdr[:])
+	if err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > maxFrame {
+		return 0, nil, errFrameTooLarge
+	}
+	if int(n) <= cap(buf) {
+		p = buf[:n]
+	} else {
+		p = make([]byte, n)
+	}
+	_, err = io.ReadFull(r, p)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return hdr[0], p, err
+}
@@ -0,0 +1,151 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrotrepl
+
+import (
+	"compress/gzip"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"xi2.org/x/logrot"
+)
+
+// readSet returns the data of the log file path and of its archive 1,
+// or "" for a file which does not exist.
+func readSet(path string) (log, archive string) {
+	data, _ := os.ReadFile(path)
+	log = string(data)
+	f, err := os.Open(path + ".1.gz")
+	if err != nil {
+		return log, ""
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return log, ""
+	}
+	data, _ = io.ReadAll(zr)
+	return log, string(data)
+}
+
+func TestReplicate(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Listen("tcp", "127.0.0.1:0", &Options{
+		Secret: "secret",
+		Open: func(name string) (*logrot.Writer, error) {
+			return logrot.OpenWithOptions(filepath.Join(dir, name+".log"),
+				0600, math.MaxInt64, 3, nil)
+		},
+		OnError: func(err error) { t.Error(err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := NewClient("tcp", s.Addr().String(), &ClientOptions{Name: "app", Secret: "secret"})
+	defer c.Close()
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := logrot.OpenWithOptions(path, 0600, 20, 3, &logrot.Options{Replica: c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for _, line := range []string{"first line\n", "second line\n", "third"} {
+		if _, err := io.WriteString(w, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantLog, wantArchive := readSet(path)
+	if wantArchive == "" {
+		t.Fatal("the Writer did not rotate")
+	}
+	var log, archive string
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+		log, archive = readSet(filepath.Join(dir, "app.log"))
+		if log == wantLog && archive == wantArchive {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("replica holds %q and archive %q, want %q and %q", log, archive, wantLog, wantArchive)
+}
+
+func TestRefused(t *testing.T) {
+	var mu sync.Mutex
+	var errs []string
+	s, err := Listen("tcp", "127.0.0.1:0", &Options{
+		Secret: "secret",
+		Open: func(name string) (*logrot.Writer, error) {
+			t.Errorf("Open(%q) called", name)
+			return nil, os.ErrPermission
+		},
+		OnError: func(err error) {
+			mu.Lock()
+			errs = append(errs, err.Error())
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, o := range []ClientOptions{
+		{Name: "app", Secret: "wrong"},
+		{Name: "../app", Secret: "secret"},
+	} {
+		mu.Lock()
+		errs = nil
+		mu.Unlock()
+		c := NewClient("tcp", s.Addr().String(), &o)
+		c.Append([]byte("data\n"))
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+			mu.Lock()
+			n := len(errs)
+			mu.Unlock()
+			if n > 0 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		c.Close()
+		mu.Lock()
+		if len(errs) == 0 || !strings.Contains(errs[0], o.Name) {
+			t.Errorf("client %q: server errors %q", o.Name, errs)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestListenOptions(t *testing.T) {
+	open := func(string) (*logrot.Writer, error) { return nil, nil }
+	for _, opts := range []*Options{nil, {Secret: "s"}, {Open: open}} {
+		if _, err := Listen("tcp", "127.0.0.1:0", opts); err == nil {
+			t.Errorf("Listen succeeded with %+v", opts)
+		}
+	}
+}
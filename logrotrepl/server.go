@@ -0,0 +1,326 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrotrepl
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"xi2.org/x/logrot"
+)
+
+// defaultHelloTimeout is the default Options.HelloTimeout.
+const defaultHelloTimeout = 10 * time.Second
+
+// Options are the settings of a Server.
+type Options struct {
+	// Open returns the Writer to which what a Client named name
+	// sends is written. It is called once for each name, and the
+	// Writers are closed by Server.Close. So that the Writer rotates
+	// only when the Client's does, it should be opened with maxSize
+	// math.MaxInt64, the same maxFiles and Delimiter, and no option
+	// which changes the data, such as TimestampFormat.
+	Open func(name string) (*logrot.Writer, error)
+
+	// Secret, if not empty, must be sent by each Client, as its
+	// ClientOptions.Secret, or its connection is refused.
+	Secret string
+
+	// Authorize, if non-nil, is called with each connection and the
+	// name its Client sent, after any Secret has been checked, and
+	// the connection is refused if it returns an error, such as
+	// when the Client's TLS certificate does not allow the name.
+	// Either Secret or Authorize must be set.
+	Authorize func(c net.Conn, name string) error
+
+	// HelloTimeout is the time a Client is given to send its Name
+	// and Secret once connected. If zero, 10 seconds is used.
+	HelloTimeout time.Duration
+
+	// IdleTimeout, if positive, is the time after which a
+	// connection from which nothing has been received is closed. A
+	// Client reconnects when it next has something to send, but
+	// what it sends first may be lost without a gap being reported,
+	// so IdleTimeout should be longer than the Writer is ever quiet.
+	IdleTimeout time.Duration
+
+	// OnError, if non-nil, is called with each error accepting a
+	// connection or writing what a client sent, and with a
+	// *GapError when a Client reports data lost. It may be called
+	// from several goroutines at once.
+	OnError func(error)
+}
+
+// Server receives from Clients on a listener, as returned by Listen
+// and Serve.
+type Server struct {
+	ln   net.Listener
+	opts Options
+	wg   sync.WaitGroup // accepting and connection goroutines
+
+	mu      sync.Mutex // guards the fields below
+	conns   map[net.Conn]struct{}
+	writers map[string]*logrot.Writer
+	closed  bool
+}
+
+// Listen listens on address on the named network, as for net.Listen,
+// and serves the Clients which connect, as Serve does.
+func Listen(network, address string, opts *Options) (*Server, error) {
+	err := checkOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return Serve(ln, opts)
+}
+
+// Serve serves the Clients which connect to ln, which it closes when
+// the Server is closed, in a goroutine of its own.
+func Serve(ln net.Listener, opts *Options) (*Server, error) {
+	err := checkOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:      ln,
+		opts:    *opts,
+		conns:   make(map[net.Conn]struct{}),
+		writers: make(map[string]*logrot.Writer),
+	}
+	if s.opts.HelloTimeout <= 0 {
+		s.opts.HelloTimeout = defaultHelloTimeout
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// checkOptions returns an error unless opts sets Open and either
+// Secret or Authorize.
+func checkOptions(opts *Options) error {
+	if opts == nil || opts.Open == nil {
+		return errors.New("logrotrepl: Open must be set")
+	}
+	if opts.Secret == "" && opts.Authorize == nil {
+		return errors.New("logrotrepl: Secret or Authorize must be set")
+	}
+	return nil
+}
+
+// Addr returns the address s listens on.
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Close stops s accepting Clients, disconnects those connected, waits
+// for what they sent to be written and closes the Writers.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.ln.Close()
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	for _, w := range s.writers {
+		if e := w.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// accept accepts Clients until the listener is closed, serving each in
+// a goroutine of its own.
+func (s *Server) accept() {
+	defer s.wg.Done()
+	var delay time.Duration
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return
+			}
+			s.error(err)
+			var ne net.Error
+			if !errors.As(err, &ne) || !ne.Timeout() {
+				// most likely too many open files: wait for
+				// some to be closed
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay < time.Second {
+					delay *= 2
+				}
+				time.Sleep(delay)
+			}
+			continue
+		}
+		delay = 0
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = c.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serve(c)
+	}
+}
+
+// serve writes what the Client c sends until it disconnects.
+func (s *Server) serve(c net.Conn) {
+	defer func() {
+		_ = c.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+	r := bufio.NewReader(c)
+	err := c.SetReadDeadline(time.Now().Add(s.opts.HelloTimeout))
+	if err != nil {
+		s.error(err)
+		return
+	}
+	kind, p, err := readFrame(r, nil)
+	if err == nil && kind != frameHello {
+		err = fmt.Errorf("logrotrepl: %v sent no hello", c.RemoteAddr())
+	}
+	if err != nil {
+		if err != io.EOF && !s.isClosed() {
+			s.error(err)
+		}
+		return
+	}
+	name, err := s.authorize(c, p)
+	if err != nil {
+		s.error(err)
+		return
+	}
+	w, err := s.writer(name)
+	if err != nil {
+		s.error(err)
+		return
+	}
+	buf := make([]byte, 32<<10)
+	for {
+		var deadline time.Time
+		if s.opts.IdleTimeout > 0 {
+			deadline = time.Now().Add(s.opts.IdleTimeout)
+		}
+		err = c.SetReadDeadline(deadline)
+		if err == nil {
+			kind, p, err = readFrame(r, buf)
+		}
+		if err != nil {
+			if err != io.EOF && !s.isClosed() {
+				s.error(err)
+			}
+			return
+		}
+		switch kind {
+		case frameData:
+			_, err = w.Write(p)
+		case frameRotate:
+			err = w.Rotate()
+		case frameGap:
+			if len(p) == 8 {
+				s.error(&GapError{Name: name, Lost: int64(binary.BigEndian.Uint64(p))})
+			}
+		default:
+			err = fmt.Errorf("logrotrepl: unknown frame %q from %v", kind, c.RemoteAddr())
+		}
+		if err != nil {
+			s.error(err)
+			return
+		}
+	}
+}
+
+// authorize returns the name in hello, the payload of the hello frame
+// sent by c, or an error if c may not send to it.
+func (s *Server) authorize(c net.Conn, hello []byte) (string, error) {
+	name, secret := string(hello), ""
+	if i := bytes.IndexByte(hello, 0); i != -1 {
+		name, secret = string(hello[:i]), string(hello[i+1:])
+	}
+	err := checkName(name)
+	if err != nil {
+		return "", err
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(s.opts.Secret)) != 1 {
+		return "", fmt.Errorf("logrotrepl: %v sent the wrong secret for %q",
+			c.RemoteAddr(), name)
+	}
+	if s.opts.Authorize != nil {
+		err = s.opts.Authorize(c, name)
+	}
+	return name, err
+}
+
+// writer returns the Writer for the Client named name, opening it if
+// necessary.
+func (s *Server) writer(name string) (*logrot.Writer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w := s.writers[name]; w != nil {
+		return w, nil
+	}
+	w, err := s.opts.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	s.writers[name] = w
+	return w, nil
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// error passes err to OnError, if set.
+func (s *Server) error(err error) {
+	if s.opts.OnError != nil {
+		s.opts.OnError(err)
+	}
+}
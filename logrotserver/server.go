@@ -0,0 +1,331 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package logrotserver receives logs from other processes and writes
+// them to rotating files with package logrot, as a small log daemon
+// for hosts whose programs are not all written in Go.
+//
+// Listen accepts streams of newline-ended lines on a unix domain
+// socket, such as from
+//
+//	myapp 2>&1 | socat - UNIX-CONNECT:/run/logrot.sock
+//
+// writing each line whole, so that the lines of clients writing at
+// once are never mixed. The lines of every client go either to a
+// single logrot.Writer or, with a logrot.KeyedWriter, to a file for
+// each client named by the first line it sends.
+//
+// ListenSyslog receives syslog messages over UDP or TCP, in the formats
+// of RFC 3164 and RFC 5424, in place of a syslog daemon for simple
+// setups, writing them to a logrot.Writer or to files by facility or
+// by sending host.
+package logrotserver // import "xi2.org/x/logrot/logrotserver"
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"xi2.org/x/logrot"
+)
+
+// defaultMaxLine is used when Options.MaxLine is zero.
+const defaultMaxLine = 64 << 10
+
+// Options are the settings of a Server. Exactly one of Writer and
+// Keyed must be set.
+type Options struct {
+	// Writer, if non-nil, receives the lines of every client.
+	Writer *logrot.Writer
+
+	// Keyed, if non-nil, receives the lines of each client under
+	// the key given by the first line the client sends, such as
+	// "myapp" to write to <dir>/myapp.log. A client whose first line
+	// is not a valid key is disconnected when it sends another.
+	Keyed *logrot.KeyedWriter
+
+	// MaxLine is the longest line, with its newline, written whole.
+	// A longer line is split after every MaxLine bytes, a newline
+	// being added to each part. If zero, 64KiB is used.
+	MaxLine int
+
+	// Perm, if non-zero, is set as the permissions of the socket
+	// created by Listen, to control which users may connect.
+	Perm os.FileMode
+
+	// SyslogKey, for a Server returned by ListenSyslog with Keyed
+	// set, returns the key under which a message is written. If
+	// nil, FacilityKey is used, and HostnameKey is another choice.
+	SyslogKey func(m *Message) string
+
+	// OnError, if non-nil, is called with each error accepting a
+	// connection or writing what a client sent. It may be called
+	// from several goroutines at once.
+	OnError func(error)
+}
+
+// Server receives logs on a listener, as returned by Listen, Serve and
+// ListenSyslog.
+type Server struct {
+	ln   net.Listener   // nil if receiving datagrams
+	pc   net.PacketConn // nil if accepting connections
+	opts Options
+	wg   sync.WaitGroup // accepting and connection goroutines
+
+	mu     sync.Mutex // guards the fields below
+	conns  map[io.Closer]struct{}
+	closed bool
+}
+
+// Listen listens on the unix domain socket named socket and serves the
+// clients which connect to it, as Serve does. A socket file left by
+// an earlier process is removed, unless a server is still listening
+// on it.
+func Listen(socket string, opts *Options) (*Server, error) {
+	err := checkOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Lstat(socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		c, err := net.DialTimeout("unix", socket, time.Second)
+		if err == nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("logrotserver: %s is in use", socket)
+		}
+		err = os.Remove(socket)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Perm != 0 {
+		err = os.Chmod(socket, opts.Perm)
+		if err != nil {
+			_ = ln.Close()
+			return nil, err
+		}
+	}
+	return Serve(ln, opts)
+}
+
+// Serve serves the clients which connect to ln, which it closes when
+// the Server is closed, in a goroutine of its own.
+func Serve(ln net.Listener, opts *Options) (*Server, error) {
+	s, err := newServer(opts)
+	if err != nil {
+		return nil, err
+	}
+	s.ln = ln
+	s.wg.Add(1)
+	go s.accept(s.serve)
+	return s, nil
+}
+
+// newServer returns a Server with the settings opts, not yet serving.
+func newServer(opts *Options) (*Server, error) {
+	err := checkOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		opts:  *opts,
+		conns: make(map[io.Closer]struct{}),
+	}
+	if s.opts.MaxLine <= 0 {
+		s.opts.MaxLine = defaultMaxLine
+	}
+	if s.opts.SyslogKey == nil {
+		s.opts.SyslogKey = FacilityKey
+	}
+	return s, nil
+}
+
+// checkOptions returns an error unless opts sets exactly one of Writer
+// and Keyed.
+func checkOptions(opts *Options) error {
+	if opts == nil || (opts.Writer == nil) == (opts.Keyed == nil) {
+		return errors.New("logrotserver: exactly one of Writer and Keyed must be set")
+	}
+	return nil
+}
+
+// Addr returns the address s listens on.
+func (s *Server) Addr() net.Addr {
+	if s.pc != nil {
+		return s.pc.LocalAddr()
+	}
+	return s.ln.Addr()
+}
+
+// Close stops s accepting clients, disconnects those connected and
+// waits for what they sent to be written. It does not close the
+// Writer or KeyedWriter.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	var err error
+	if s.pc != nil {
+		err = s.pc.Close()
+	} else {
+		err = s.ln.Close()
+	}
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// track adds c to the connections closed by Close, reporting false if
+// s is already closed.
+func (s *Server) track(c io.Closer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+// untrack removes c from the connections closed by Close.
+func (s *Server) untrack(c io.Closer) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+// accept accepts clients until the listener is closed, serving each
+// with handle in a goroutine of its own.
+func (s *Server) accept(handle func(net.Conn)) {
+	defer s.wg.Done()
+	var delay time.Duration
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return
+			}
+			s.error(err)
+			var ne net.Error
+			if !errors.As(err, &ne) || !ne.Timeout() {
+				// most likely too many open files: wait for
+				// some to be closed
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay < time.Second {
+					delay *= 2
+				}
+				time.Sleep(delay)
+			}
+			continue
+		}
+		delay = 0
+		if !s.track(c) {
+			_ = c.Close()
+			return
+		}
+		go handle(c)
+	}
+}
+
+// serve writes the lines sent by the client c until it disconnects.
+func (s *Server) serve(c net.Conn) {
+	defer s.untrack(c)
+	defer c.Close()
+	r := bufio.NewReaderSize(c, s.opts.MaxLine)
+	write := func(p []byte) error {
+		_, err := s.opts.Writer.Write(p)
+		return err
+	}
+	if s.opts.Keyed != nil {
+		line, err := readLine(r)
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			if err != io.EOF {
+				s.error(err)
+			}
+			return
+		}
+		key := string(bytes.TrimRight(line, "\r\n"))
+		write = func(p []byte) error {
+			_, err := s.opts.Keyed.WriteKeyed(key, p)
+			return err
+		}
+	}
+	for {
+		line, err := readLine(r)
+		if len(line) > 0 {
+			if e := write(line); e != nil {
+				s.error(e)
+				return
+			}
+		}
+		if err != nil {
+			if err != io.EOF && !s.isClosed() {
+				s.error(err)
+			}
+			return
+		}
+	}
+}
+
+// readLine returns the next line of r with its newline. A line longer
+// than the buffer of r, or ending r without a newline, is returned in
+// parts with a newline added to each.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		err = nil
+	} else if err == nil || len(line) == 0 {
+		return line, err
+	}
+	return append(append([]byte(nil), line...), '\n'), err
+}
+
+// isClosed reports whether s has been closed.
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// error passes err to OnError, if set.
+func (s *Server) error(err error) {
+	if s.opts.OnError != nil {
+		s.opts.OnError(fmt.Errorf("logrotserver: %w", err))
+	}
+}
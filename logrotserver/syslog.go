@@ -0,0 +1,388 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrotserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDatagram is the largest syslog message received over UDP.
+const maxDatagram = 64 << 10
+
+// Message is a syslog message received by a Server returned by
+// ListenSyslog.
+type Message struct {
+	Facility int       // 0 to 23, such as 1 for user
+	Severity int       // 0 (emergency) to 7 (debug)
+	Time     time.Time // when sent, or received if the message has none
+	Hostname string    // the host named, or the sender's address
+	AppName  string    // the TAG of RFC 3164 or APP-NAME of RFC 5424
+	ProcID   string    // the process ID, if any
+	MsgID    string    // the MSGID of RFC 5424, if any
+	Data     string    // the STRUCTURED-DATA of RFC 5424, if any
+	Text     string    // the message itself
+}
+
+// facilityNames are the names of the facilities, by number.
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console",
+	"solaris-cron", "local0", "local1", "local2", "local3", "local4",
+	"local5", "local6", "local7",
+}
+
+// FacilityKey returns the name of the facility of m, such as "mail" or
+// "local0", so that each facility has a file of its own.
+func FacilityKey(m *Message) string {
+	if m.Facility >= 0 && m.Facility < len(facilityNames) {
+		return facilityNames[m.Facility]
+	}
+	return "facility" + strconv.Itoa(m.Facility)
+}
+
+// HostnameKey returns the host which sent m, with any characters which
+// cannot be in a file name replaced by "_", so that each host has a
+// file of its own.
+func HostnameKey(m *Message) string {
+	h := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, m.Hostname)
+	if h == "" || h[0] == '.' {
+		h = "_" + h
+	}
+	return h
+}
+
+// ListenSyslog receives syslog messages on the address addr of network,
+// one of "udp", "udp4", "udp6", "unixgram", "tcp", "tcp4", "tcp6" and
+// "unix", as net.Listen and net.ListenPacket take them, writing each
+// as a line such as
+//
+//	2006-01-02T15:04:05Z web-1 sshd[123]: Accepted publickey for git
+//
+// to Options.Writer, or to Options.Keyed under the key returned by
+// Options.SyslogKey. Over a stream each message is either preceded by
+// its length and a space, as RFC 6587 describes, or ended by a newline.
+// Messages are parsed as RFC 5424 describes if they have its version
+// number, and otherwise as RFC 3164 does, as leniently as syslog
+// daemons do. Control characters in a message, such as a newline,
+// are written as '#' and three octal digits, as rsyslog writes them,
+// so that one message cannot appear as several lines.
+func ListenSyslog(network, addr string, opts *Options) (*Server, error) {
+	s, err := newServer(opts)
+	if err != nil {
+		return nil, err
+	}
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		s.pc, err = net.ListenPacket(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		s.wg.Add(1)
+		go s.receive()
+	case "tcp", "tcp4", "tcp6", "unix":
+		s.ln, err = net.Listen(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		s.wg.Add(1)
+		go s.accept(s.serveSyslog)
+	default:
+		return nil, fmt.Errorf("logrotserver: unsupported network %q", network)
+	}
+	return s, nil
+}
+
+// receive writes the syslog messages received as datagrams until s is
+// closed.
+func (s *Server) receive() {
+	defer s.wg.Done()
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := s.pc.ReadFrom(buf)
+		if n > 0 {
+			s.writeSyslog(buf[:n], addr)
+		}
+		if err != nil {
+			if s.isClosed() {
+				return
+			}
+			s.error(err)
+		}
+	}
+}
+
+// serveSyslog writes the syslog messages sent by the client c until it
+// disconnects.
+func (s *Server) serveSyslog(c net.Conn) {
+	defer s.untrack(c)
+	defer c.Close()
+	r := bufio.NewReaderSize(c, s.opts.MaxLine)
+	for {
+		msg, err := readFrame(r, s.opts.MaxLine)
+		if len(msg) > 0 {
+			s.writeSyslog(msg, c.RemoteAddr())
+		}
+		if err != nil {
+			if err != io.EOF && !s.isClosed() {
+				s.error(err)
+			}
+			return
+		}
+	}
+}
+
+// readFrame returns the next message of r, framed by its length or by
+// a newline. A message longer than max bytes is cut short.
+func readFrame(r *bufio.Reader, max int) ([]byte, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if b[0] < '1' || b[0] > '9' {
+		line, err := r.ReadSlice('\n')
+		msg := append([]byte(nil), line...)
+		for err == bufio.ErrBufferFull {
+			// skip the rest of a long message
+			_, err = r.ReadSlice('\n')
+		}
+		return msg, err
+	}
+	n := 0
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if c == ' ' {
+			break
+		}
+		if c < '0' || c > '9' || n > maxDatagram {
+			return nil, errors.New("invalid message length")
+		}
+		n = n*10 + int(c-'0')
+	}
+	msg := make([]byte, n)
+	if n > max {
+		msg = msg[:max]
+	}
+	k, err := io.ReadFull(r, msg)
+	msg = msg[:k]
+	if err == nil && n > max {
+		_, err = r.Discard(n - max)
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return msg, err
+}
+
+// writeSyslog parses the syslog message msg sent from addr and writes
+// it.
+func (s *Server) writeSyslog(msg []byte, addr net.Addr) {
+	m := ParseMessage(msg, time.Now())
+	if m.Hostname == "" && addr != nil {
+		m.Hostname = addr.String()
+		if host, _, err := net.SplitHostPort(m.Hostname); err == nil {
+			m.Hostname = host
+		}
+	}
+	line := formatLine(m)
+	var err error
+	if s.opts.Keyed != nil {
+		_, err = s.opts.Keyed.WriteKeyed(s.opts.SyslogKey(m), line)
+	} else {
+		_, err = s.opts.Writer.Write(line)
+	}
+	if err != nil {
+		s.error(err)
+	}
+}
+
+// formatLine returns the line written for m, with the control
+// characters in its fields escaped.
+func formatLine(m *Message) []byte {
+	var b bytes.Buffer
+	b.WriteString(m.Time.Format(time.RFC3339))
+	if m.Hostname != "" {
+		b.WriteString(" " + escapeControl(m.Hostname))
+	}
+	if m.AppName != "" {
+		b.WriteString(" " + escapeControl(m.AppName))
+		if m.ProcID != "" {
+			b.WriteString("[" + escapeControl(m.ProcID) + "]")
+		}
+		b.WriteByte(':')
+	}
+	if m.Data != "" {
+		b.WriteString(" " + escapeControl(m.Data))
+	}
+	b.WriteString(" " + escapeControl(m.Text))
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+// escapeControl returns s with each ASCII control character replaced
+// by '#' and its code in three octal digits, such as "#012" for a
+// newline.
+func escapeControl(s string) string {
+	i := strings.IndexFunc(s, func(r rune) bool { return r < ' ' || r == 0x7f })
+	if i == -1 {
+		return s
+	}
+	var b strings.Builder
+	b.WriteString(s[:i])
+	for ; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c == 0x7f {
+			fmt.Fprintf(&b, "#%03o", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// ParseMessage parses the syslog message msg, in the format of RFC 5424
+// if it has its version number and otherwise of RFC 3164, taking now
+// as the time it was received. Any part which cannot be parsed is
+// left in Text, so that no message is lost, and a message without a
+// priority is given facility user and severity notice, as RFC 3164
+// says. Hostname is empty if msg names no host.
+func ParseMessage(msg []byte, now time.Time) *Message {
+	s := strings.TrimRight(string(msg), "\r\n\x00")
+	m := &Message{Facility: 1, Severity: 5, Time: now}
+	if len(s) > 2 && s[0] == '<' {
+		if i := strings.IndexByte(s, '>'); i > 1 && i <= 4 {
+			pri, err := strconv.Atoi(s[1:i])
+			if err == nil && pri >= 0 && pri < 8*len(facilityNames) {
+				m.Facility, m.Severity = pri/8, pri%8
+				s = s[i+1:]
+			}
+		}
+	}
+	if strings.HasPrefix(s, "1 ") {
+		parse5424(m, s[2:])
+	} else {
+		parse3164(m, s)
+	}
+	return m
+}
+
+// parse5424 parses s, the part of an RFC 5424 message after its
+// version, into m.
+func parse5424(m *Message, s string) {
+	field := func() string {
+		f := s
+		if i := strings.IndexByte(s, ' '); i != -1 {
+			f, s = s[:i], s[i+1:]
+		} else {
+			s = ""
+		}
+		if f == "-" {
+			return ""
+		}
+		return f
+	}
+	if ts := field(); ts != "" {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			m.Time = t
+		}
+	}
+	m.Hostname = field()
+	m.AppName = field()
+	m.ProcID = field()
+	m.MsgID = field()
+	if strings.HasPrefix(s, "-") {
+		s = strings.TrimPrefix(s[1:], " ")
+	} else if strings.HasPrefix(s, "[") {
+		// elements run until a "]" not escaped and not followed
+		// by another element
+		i, quoted := 0, false
+	loop:
+		for ; i < len(s); i++ {
+			switch {
+			case s[i] == '\\' && quoted:
+				i++
+			case s[i] == '"':
+				quoted = !quoted
+			case s[i] == ']' && !quoted &&
+				(i+1 == len(s) || s[i+1] != '['):
+				i++
+				break loop
+			}
+		}
+		m.Data, s = s[:i], strings.TrimPrefix(s[i:], " ")
+	}
+	m.Text = strings.TrimPrefix(s, "\ufeff")
+}
+
+// parse3164 parses s, an RFC 3164 message less its priority, into m.
+func parse3164(m *Message, s string) {
+	const stamp = "Jan _2 15:04:05"
+	if len(s) > len(stamp) && s[len(stamp)] == ' ' {
+		if t, err := time.ParseInLocation(stamp, s[:len(stamp)], m.Time.Location()); err == nil {
+			// the year is not sent, so take the one which puts
+			// the time nearest to its receipt
+			now := m.Time
+			t = t.AddDate(now.Year(), 0, 0)
+			if t.Sub(now) > 24*time.Hour {
+				t = t.AddDate(-1, 0, 0)
+			}
+			m.Time = t
+			s = s[len(stamp)+1:]
+			if i := strings.IndexByte(s, ' '); i > 0 && !strings.HasSuffix(s[:i], ":") {
+				m.Hostname, s = s[:i], s[i+1:]
+			}
+		}
+	}
+	// the TAG is up to 32 characters ended by "[", ":" or a space
+	for i := 0; i < len(s) && i <= 32; i++ {
+		c := s[i]
+		if c == '[' || c == ':' || c == ' ' {
+			if i == 0 || c == ' ' {
+				break
+			}
+			m.AppName, s = s[:i], s[i:]
+			if c == '[' {
+				if j := strings.IndexByte(s, ']'); j != -1 {
+					m.ProcID, s = s[1:j], s[j+1:]
+				}
+			}
+			s = strings.TrimPrefix(s, ":")
+			s = strings.TrimPrefix(s, " ")
+			break
+		}
+	}
+	m.Text = s
+}
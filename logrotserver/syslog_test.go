@@ -0,0 +1,49 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrotserver
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestFormatLineNewline(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, msg := range []string{
+		"<13>Jan  2 03:04:05 web-1 sshd[1]: hello\nJan  2 03:04:05 web-1 sshd[1]: forged",
+		"<13>1 2024-01-02T03:04:05Z web-1 sshd 1 - - hello\r\n2024-01-02T03:04:05Z web-1 sshd[1]: forged",
+		"<13>1 2024-01-02T03:04:05Z web\n-1 ss\rhd 1\x00 - [a x=\"\n\"] hello",
+	} {
+		line := formatLine(ParseMessage([]byte(msg), now))
+		if n := bytes.Count(line, []byte("\n")); n != 1 || line[len(line)-1] != '\n' {
+			t.Errorf("%q gave %q, with %d newlines", msg, line, n)
+		}
+		if bytes.ContainsAny(line[:len(line)-1], "\r\x00") {
+			t.Errorf("%q gave %q", msg, line)
+		}
+	}
+	m := &Message{Time: now, Hostname: "h", Text: "a\nb\tc\x7f"}
+	if got, want := string(formatLine(m)), "2024-01-02T03:04:05Z h a#012b#011c#177\n"; got != want {
+		t.Errorf("formatLine = %q, want %q", got, want)
+	}
+}
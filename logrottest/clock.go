@@ -0,0 +1,117 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrottest
+
+import (
+	"sync"
+	"time"
+
+	"xi2.org/x/logrot"
+)
+
+// Clock is a logrot.Clock whose time only moves when Advance or Set
+// is called, for use as Options.Clock. It is safe for concurrent use.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*timer
+}
+
+// timer is a timer started by Clock.AfterFunc.
+type timer struct {
+	c    *Clock
+	when time.Time
+	f    func()
+}
+
+var _ logrot.Clock = (*Clock)(nil)
+
+// NewClock returns a Clock set to start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc arranges for f to be called in its own goroutine once
+// the clock has been advanced by d.
+func (c *Clock) AfterFunc(d time.Duration, f func()) logrot.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &timer{c: c, when: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, starting the functions of the
+// timers which fall due.
+func (c *Clock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set sets the clock to t, starting the functions of the timers which
+// fall due, each in its own goroutine. The clock does not go
+// backwards: if t is before the clock's time, Set does nothing.
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	if t.Before(c.now) {
+		c.mu.Unlock()
+		return
+	}
+	c.now = t
+	var due []*timer
+	keep := c.timers[:0]
+	for _, t := range c.timers {
+		if t.when.After(c.now) {
+			keep = append(keep, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	for i := len(keep); i < len(c.timers); i++ {
+		c.timers[i] = nil
+	}
+	c.timers = keep
+	c.mu.Unlock()
+	for _, t := range due {
+		go t.f()
+	}
+}
+
+// Stop prevents the timer from firing, reporting whether it did so.
+func (t *timer) Stop() bool {
+	c := t.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, u := range c.timers {
+		if u == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,243 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package logrottest provides helpers for testing code that writes
+// its logs through logrot.
+//
+// A typical test looks like this:
+//
+//	func TestServer(t *testing.T) {
+//	    w := logrottest.New(t, 1000, 3, nil)
+//	    s := NewServer(log.New(w, "", 0))
+//	    s.HandleSomething()
+//	    w.AssertFileCount(2)
+//	    w.AssertContains(0, "something handled\n")
+//	}
+package logrottest // import "xi2.org/x/logrot/logrottest"
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"xi2.org/x/logrot"
+)
+
+// Writer is a logrot.Writer whose log file lives in a temporary
+// directory owned by a test.
+type Writer struct {
+	*logrot.Writer
+	Path    string // path of the live log file
+	maxSize int64
+	opts    logrot.Options
+	tb      testing.TB
+}
+
+// New opens a logrot.Writer on a file named "log" inside
+// tb.TempDir(), passing maxSize, maxFiles and opts on to
+// logrot.OpenWithOptions. The Writer is closed when the test and all
+// its subtests complete. If the Writer cannot be opened, New calls
+// tb.Fatal.
+func New(tb testing.TB, maxSize int64, maxFiles int, opts *logrot.Options) *Writer {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "log")
+	w, err := logrot.OpenWithOptions(path, 0600, maxSize, maxFiles, opts)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		if err := w.Close(); err != nil {
+			tb.Error(err)
+		}
+	})
+	wc := &Writer{Writer: w, Path: path, maxSize: maxSize, tb: tb}
+	if opts != nil {
+		wc.opts = *opts
+	}
+	return wc
+}
+
+// Files returns the paths of the files in the rotation set, the live
+// file first followed by <path>.1.gz, <path>.2.gz and so on, or the
+// archives as logrot.Writer.Archives names them when ArchiveDir or
+// Encrypter is set.
+func (w *Writer) Files() []string {
+	w.tb.Helper()
+	archives, err := w.Writer.Archives()
+	if err != nil {
+		w.tb.Fatal(err)
+	}
+	files := []string{w.Path}
+	for _, a := range archives {
+		files = append(files, a.Name)
+	}
+	return files
+}
+
+// Contents returns the contents of each file in the rotation set, in
+// the order returned by Files, decompressing the archives whose names
+// end in ".gz". Other archives, such as encrypted ones, are returned
+// as they are.
+func (w *Writer) Contents() []string {
+	w.tb.Helper()
+	var contents []string
+	for i, name := range w.Files() {
+		var data []byte
+		var err error
+		if i == 0 || !strings.HasSuffix(name, ".gz") {
+			data, err = os.ReadFile(name)
+		} else {
+			data, err = readGzip(name)
+		}
+		if err != nil {
+			w.tb.Fatal(err)
+		}
+		contents = append(contents, string(data))
+	}
+	return contents
+}
+
+// All returns the concatenation of all logged data in the order it
+// was written, i.e. the oldest archive first and the live file last.
+func (w *Writer) All() string {
+	w.tb.Helper()
+	contents := w.Contents()
+	for i, j := 0, len(contents)-1; i < j; i, j = i+1, j-1 {
+		contents[i], contents[j] = contents[j], contents[i]
+	}
+	return strings.Join(contents, "")
+}
+
+// AssertFileCount reports an error if the rotation set does not
+// consist of exactly n files, counting the live file.
+func (w *Writer) AssertFileCount(n int) {
+	w.tb.Helper()
+	if files := w.Files(); len(files) != n {
+		w.tb.Errorf("logrottest: got %d files %q, want %d", len(files), files, n)
+	}
+}
+
+// AssertContents reports an error if the contents of the rotation set,
+// in the order returned by Contents, differ from want.
+func (w *Writer) AssertContents(want ...string) {
+	w.tb.Helper()
+	got := w.Contents()
+	if len(got) != len(want) {
+		w.tb.Errorf("logrottest: got %d files, want %d", len(got), len(want))
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			w.tb.Errorf("logrottest: file %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+// AssertContains reports an error if the i'th file of the rotation
+// set, in the order returned by Files, does not contain substr.
+func (w *Writer) AssertContains(i int, substr string) {
+	w.tb.Helper()
+	contents := w.Contents()
+	if i >= len(contents) {
+		w.tb.Errorf("logrottest: no file %d, only %d files", i, len(contents))
+		return
+	}
+	if !strings.Contains(contents[i], substr) {
+		w.tb.Errorf("logrottest: file %d: %q does not contain %q", i, contents[i], substr)
+	}
+}
+
+// AssertMaxSize reports an error if any file of the rotation set,
+// decompressed, is larger than logrot lets it grow. That is maxSize
+// bytes, counting any Header but not the Footer of an archive, unless
+// the first record after the Header is larger on its own, when the
+// file must hold just that record. In raw mode it is maxSize exactly.
+func (w *Writer) AssertMaxSize() {
+	w.tb.Helper()
+	delim := w.delim()
+	for i, c := range w.Contents() {
+		size := int64(len(c))
+		if i > 0 && w.opts.Footer != "" && !w.opts.Raw {
+			size -= int64(len(lastRecord(c, delim)))
+		}
+		limit := w.maxSize
+		if !w.opts.Raw {
+			var header int64
+			if w.opts.Header != "" {
+				header = int64(len(firstRecord(c, delim)))
+			}
+			if first := header + int64(len(firstRecord(c[header:], delim))); first > limit {
+				limit = first
+			}
+		}
+		if size > limit {
+			w.tb.Errorf("logrottest: file %d: size %d exceeds %d", i, size, limit)
+		}
+	}
+}
+
+// delim returns the delimiter which ends each record.
+func (w *Writer) delim() string {
+	switch {
+	case len(w.opts.Delimiter) > 0:
+		return string(w.opts.Delimiter)
+	case w.opts.CRLF:
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// firstRecord returns the first record of s, with its delimiter, or
+// all of s if it has no delimiter.
+func firstRecord(s, delim string) string {
+	if i := strings.Index(s, delim); i != -1 {
+		return s[:i+len(delim)]
+	}
+	return s
+}
+
+// lastRecord returns the last record of s, which ends with a
+// delimiter.
+func lastRecord(s, delim string) string {
+	t := strings.TrimSuffix(s, delim)
+	return s[strings.LastIndex(t, delim)+len(delim):]
+}
+
+func readGzip(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("logrottest: %s: %v", name, err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("logrottest: %s: %v", name, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,74 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrottest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"xi2.org/x/logrot"
+)
+
+// recorder is a testing.TB which records errors instead of failing.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertMaxSize(t *testing.T) {
+	w := New(t, 40, 4, &logrot.Options{
+		Header: "# started $start",
+		Footer: "# rotated at $end",
+	})
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(w, "line %d\n", i)
+	}
+	r := &recorder{TB: t}
+	w.tb = r
+	w.AssertMaxSize()
+	if len(r.errors) != 0 {
+		t.Fatalf("AssertMaxSize on a valid set: %q", r.errors)
+	}
+	f, err := os.OpenFile(w.Path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString(strings.Repeat("x", 30) + "\n")
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.AssertMaxSize()
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "file 0:") {
+		t.Fatalf("AssertMaxSize on an oversize file: %q", r.errors)
+	}
+}
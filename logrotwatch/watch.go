@@ -0,0 +1,122 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package logrotwatch notices at once when another program, such as
+// logrotate, renames or removes the log file of a logrot.Writer, by
+// watching its directory with fsnotify, so that the Writer reopens
+// the file, and with logrot.Options.AdoptRotated archives the renamed
+// file, without waiting for a write past ReopenInterval.
+package logrotwatch // import "xi2.org/x/logrot/logrotwatch"
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+
+	"xi2.org/x/logrot"
+)
+
+// Watcher watches the log files of Writers, as returned by Watch.
+type Watcher struct {
+	fw      *fsnotify.Watcher
+	writers map[string][]*logrot.Writer // by cleaned log file path
+	onError func(error)
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Watch watches the directory of the log file of each of writers and
+// calls the Writer's CheckRotated method whenever its log file is
+// renamed, removed or created. An error watching or from CheckRotated
+// is passed to onError, if it is not nil.
+func Watch(onError func(error), writers ...*logrot.Writer) (*Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		fw:      fw,
+		writers: make(map[string][]*logrot.Writer),
+		onError: onError,
+		done:    make(chan struct{}),
+	}
+	dirs := make(map[string]bool)
+	for _, wc := range writers {
+		path := filepath.Clean(wc.Path())
+		w.writers[path] = append(w.writers[path], wc)
+		dir := filepath.Dir(path)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		err = fw.Add(dir)
+		if err != nil {
+			_ = fw.Close()
+			return nil, err
+		}
+	}
+	go w.run()
+	return w, nil
+}
+
+// run handles the events of w.fw until it is closed.
+func (w *Watcher) run() {
+	defer close(w.done)
+	for {
+		select {
+		case ev, ok := <-w.fw.Events:
+			if !ok {
+				return
+			}
+			if !ev.Has(fsnotify.Rename) && !ev.Has(fsnotify.Remove) &&
+				!ev.Has(fsnotify.Create) {
+				continue
+			}
+			for _, wc := range w.writers[filepath.Clean(ev.Name)] {
+				if err := wc.CheckRotated(); err != nil {
+					w.error(err)
+				}
+			}
+		case err, ok := <-w.fw.Errors:
+			if !ok {
+				return
+			}
+			w.error(err)
+		}
+	}
+}
+
+// error passes err to w.onError, if set.
+func (w *Watcher) error(err error) {
+	if w.onError != nil {
+		w.onError(err)
+	}
+}
+
+// Close stops w, waiting for any check in progress to finish.
+func (w *Watcher) Close() error {
+	var err error
+	w.closeOnce.Do(func() { err = w.fw.Close() })
+	<-w.done
+	return err
+}
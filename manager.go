@@ -0,0 +1,297 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// Manager owns several Writers, such as those of access.log, error.log
+// and audit.log, and keeps the space taken by all their log files and
+// archives within a combined budget, instead of each Writer being
+// blind to its siblings. After each rotation of any of them, and
+// every ManagerOptions.Interval if set, a single goroutine shared by
+// the Writers deletes archives, oldest first across all of them,
+// until the total is within the budget. The log files are never
+// deleted, nor the most recent Options.PurgeKeep archives of each
+// Writer, so the budget may be exceeded if they alone exceed it.
+type Manager struct {
+	budget  int64
+	sweeper *sweeper
+
+	mu      sync.Mutex // guards writers
+	writers []*Writer  // may include Writers closed since, see open
+}
+
+// ManagerOptions are the settings of a Manager.
+type ManagerOptions struct {
+	// Interval, if positive, is how often the budget is checked
+	// besides after each rotation, so that archives written by
+	// other means are also accounted for.
+	Interval time.Duration
+
+	// OnError, if non-nil, is called with each error checking the
+	// budget or deleting an archive, from the Manager's goroutine.
+	OnError func(error)
+
+	// Clock, if non-nil, is used in place of the system clock for
+	// Interval.
+	Clock Clock
+}
+
+// NewManager returns a Manager keeping its Writers within budget
+// bytes.
+func NewManager(budget int64) (*Manager, error) {
+	return NewManagerWithOptions(budget, nil)
+}
+
+// NewManagerWithOptions is like NewManager but takes additional
+// settings in opts.
+func NewManagerWithOptions(budget int64, opts *ManagerOptions) (*Manager, error) {
+	if budget < 1 {
+		return nil, errors.New("logrot: budget < 1")
+	}
+	var o ManagerOptions
+	if opts != nil {
+		o = *opts
+	}
+	m := &Manager{budget: budget}
+	m.sweeper = newSweeper(m.enforce, o.Interval, o.Clock, o.OnError)
+	return m, nil
+}
+
+// Open opens a Writer as Open does and adds it to m.
+func (m *Manager) Open(path string, perm os.FileMode, maxSize int64, maxFiles int) (*Writer, error) {
+	return m.OpenWithOptions(path, perm, maxSize, maxFiles, nil)
+}
+
+// OpenWithOptions opens a Writer as OpenWithOptions does and adds it to
+// m. Any opts.OnRotate is still called.
+func (m *Manager) OpenWithOptions(path string, perm os.FileMode, maxSize int64, maxFiles int, opts *Options) (*Writer, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	onRotate := o.OnRotate
+	o.OnRotate = func(r Rotation) {
+		if onRotate != nil {
+			onRotate(r)
+		}
+		m.sweeper.trigger()
+	}
+	wc, err := OpenWithOptions(path, perm, maxSize, maxFiles, &o)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.writers = append(m.writers, wc)
+	m.mu.Unlock()
+	m.sweeper.trigger()
+	return wc, nil
+}
+
+// Usage returns the number of bytes taken by the log files, archives
+// and checksum files of the open Writers of m.
+func (m *Manager) Usage() (int64, error) {
+	sets, err := m.scan()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, s := range sets {
+		total += s.size
+	}
+	return total, nil
+}
+
+// Writers returns the open Writers of m, in the order they were
+// opened. A Writer closed by its own Close method is no longer
+// among them.
+func (m *Manager) Writers() []*Writer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.open()
+}
+
+// open drops the Writers which have been closed from m.writers and
+// returns a copy of the rest. m.mu must be held.
+func (m *Manager) open() []*Writer {
+	writers := m.writers[:0]
+	for _, wc := range m.writers {
+		wc.mu.Lock()
+		closed := wc.closed
+		wc.mu.Unlock()
+		if !closed {
+			writers = append(writers, wc)
+		}
+	}
+	for i := len(writers); i < len(m.writers); i++ {
+		m.writers[i] = nil
+	}
+	m.writers = writers
+	return append([]*Writer(nil), writers...)
+}
+
+// Close stops m and closes its open Writers, returning the first
+// error.
+func (m *Manager) Close() error {
+	m.sweeper.close()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var err error
+	for _, wc := range m.open() {
+		if e := wc.Close(); err == nil {
+			err = e
+		}
+	}
+	m.writers = nil
+	return err
+}
+
+// managedSet is the files of one Writer of a Manager.
+type managedSet struct {
+	wc       *Writer
+	size     int64       // bytes taken by all the files
+	archives []time.Time // modification times, by archive number less 1
+	keep     int         // PurgeKeep when scanned
+}
+
+// scan returns the files of the open Writers of m.
+func (m *Manager) scan() ([]*managedSet, error) {
+	m.mu.Lock()
+	writers := m.open()
+	m.mu.Unlock()
+	var sets []*managedSet
+	for _, wc := range writers {
+		s, err := wc.managedSet()
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, s)
+	}
+	return sets, nil
+}
+
+// managedSet returns the files of wc.
+func (wc *Writer) managedSet() (*managedSet, error) {
+	wc.rotMu.Lock()
+	defer wc.rotMu.Unlock()
+	// PurgeKeep may be changed by Update, which holds wc.rotMu
+	s := &managedSet{wc: wc, keep: wc.opts.PurgeKeep}
+	// a LazyOpen Writer has no log file until its first write
+	fi, err := wc.fs.Stat(wc.path)
+	switch {
+	case err == nil:
+		s.size = fi.Size()
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	n, err := wc.lastArchive()
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i <= n; i++ {
+		size, modTime, err := wc.archiveSize(i)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.size += size
+		s.archives = append(s.archives, modTime)
+	}
+	return s, nil
+}
+
+// archiveSize returns the bytes taken by archive n and its checksum
+// file, if any, and the time the archive was written.
+func (wc *Writer) archiveSize(n int) (int64, time.Time, error) {
+	fi, err := wc.fs.Stat(wc.archiveName(n))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	size := fi.Size()
+	if sfi, err := wc.fs.Stat(sidecarName(wc.archiveName(n))); err == nil {
+		size += sfi.Size()
+	}
+	return size, fi.ModTime(), nil
+}
+
+// enforce deletes the oldest archives of m's Writers until they are
+// within the budget or only the archives kept by PurgeKeep remain.
+func (m *Manager) enforce() error {
+	sets, err := m.scan()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, s := range sets {
+		total += s.size
+	}
+	for total > m.budget {
+		var oldest *managedSet
+		for _, s := range sets {
+			n := len(s.archives)
+			if n <= s.keep {
+				continue
+			}
+			if oldest == nil || s.archives[n-1].Before(oldest.archives[len(oldest.archives)-1]) {
+				oldest = s
+			}
+		}
+		if oldest == nil {
+			return nil
+		}
+		freed, err := oldest.wc.removeOldest()
+		if err != nil {
+			return err
+		}
+		oldest.archives = oldest.archives[:len(oldest.archives)-1]
+		total -= freed
+	}
+	return nil
+}
+
+// removeOldest deletes the oldest archive of wc, unless only the
+// archives kept by PurgeKeep remain, returning the bytes freed.
+func (wc *Writer) removeOldest() (int64, error) {
+	wc.rotMu.Lock()
+	defer wc.rotMu.Unlock()
+	n, err := wc.lastArchive()
+	if err != nil || n <= wc.opts.PurgeKeep {
+		return 0, err
+	}
+	size, _, err := wc.archiveSize(n)
+	if err != nil {
+		return 0, err
+	}
+	err = wc.removeArchive(wc.archiveName(n))
+	if err != nil {
+		return 0, err
+	}
+	wc.archives = n - 1
+	return size, nil
+}
@@ -0,0 +1,102 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManagerBudget(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	var writers []*Writer
+	for _, name := range []string{"access.log", "error.log"} {
+		wc, err := m.Open(filepath.Join(dir, name), 0644, 10, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writers = append(writers, wc)
+	}
+	for i := 0; i < 20; i++ {
+		for _, wc := range writers {
+			if _, err := wc.Write([]byte("0123456789\n")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// the sweep runs in the Manager's goroutine
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		usage, err := m.Usage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if usage <= 200 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("usage %d exceeds budget 200", usage)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the most recent archives are kept
+	for _, wc := range writers {
+		if _, err := os.Stat(wc.Path() + ".1.gz"); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestManagerClosedWriter(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := m.Open(filepath.Join(dir, "a.log"), 0644, 100, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := m.Open(filepath.Join(dir, "b.log"), 0644, 100, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Writers(); len(got) != 1 || got[0] != b {
+		t.Errorf("Writers() = %v, want only b", got)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Writers(); len(got) != 0 {
+		t.Errorf("Writers() after Close = %v", got)
+	}
+}
@@ -0,0 +1,256 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxManifestLine is how much of the first line of an archive's data
+// is read to find its time.
+const maxManifestLine = 64 << 10
+
+// Manifest is the index of the archives of a log file kept with
+// Options.Manifest.
+type Manifest struct {
+	// Archives are the entries of the archives, newest first.
+	Archives []ManifestEntry `json:"archives"`
+}
+
+// ManifestEntry describes one archive in a Manifest.
+type ManifestEntry struct {
+	// Archive is the name of the archive, such as <path>.1.gz.
+	Archive string `json:"archive"`
+
+	// Start and End are the offsets, in the data written to the log
+	// since the manifest was begun, of the first byte held by the
+	// archive and of the byte after its last, before compression.
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+
+	// First and Last are the times of the first and last lines of
+	// the archive, if Options.Timestamp was set and found them.
+	First *time.Time `json:"first,omitempty"`
+	Last  *time.Time `json:"last,omitempty"`
+
+	// From is when the rotation which made the archive before this
+	// one started, if there was one, and To when this one's
+	// started.
+	From *time.Time `json:"from,omitempty"`
+	To   time.Time  `json:"to"`
+
+	// SHA256 is the SHA-256 checksum of the archive file, in hex,
+	// and Size its size in bytes.
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+
+	// Codec is how the data was encoded, "gzip" or, if encrypted,
+	// "gzip+" followed by the Encrypter's extension less its dot.
+	Codec string `json:"codec"`
+
+	// Created is when the archive was written.
+	Created time.Time `json:"created"`
+}
+
+// manifestName returns the name of the manifest of the log file path
+// whose archives are kept in archiveDir, or beside it if archiveDir is
+// empty.
+func manifestName(path, archiveDir string) string {
+	return archiveBase(path, archiveDir) + ".manifest.json"
+}
+
+// ReadManifest reads the manifest kept by a Writer of the log file
+// path with Options.Manifest set, from opts.ArchiveDir, if set,
+// through opts.FS, if set. The other options are ignored. It returns
+// an empty Manifest if there is none.
+func ReadManifest(path string, opts *Options) (*Manifest, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	fsys := o.FS
+	if fsys == nil {
+		fsys = osFS{}
+	}
+	return readManifest(fsys, manifestName(path, o.ArchiveDir))
+}
+
+// readManifest reads the manifest name on fsys.
+func readManifest(fsys FS, name string) (*Manifest, error) {
+	m := &Manifest{}
+	data, err := readFile(fsys, name)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, m)
+	if err != nil {
+		return nil, &os.PathError{Op: "read", Path: name, Err: err}
+	}
+	return m, nil
+}
+
+// updateManifest adds to the manifest the new archive 1 holding the
+// size bytes of the staging file staged, or of a file no longer
+// readable if staged is nil, whose SHA-256 checksum is sum. The
+// earlier archives have each been renumbered up by one, and the
+// entries of those which no longer exist, or whose size has changed,
+// are dropped. It is called with the rotation lock held.
+func (wc *Writer) updateManifest(staged File, size int64, sum []byte) error {
+	name := manifestName(wc.path, wc.opts.ArchiveDir)
+	m, err := readManifest(wc.fs, name)
+	if err != nil {
+		// start again rather than never recording another archive
+		m = &Manifest{}
+	}
+	fi, err := wc.fs.Stat(wc.archiveName(1))
+	if err != nil {
+		return err
+	}
+	e := ManifestEntry{
+		Archive: wc.archiveName(1),
+		To:      wc.stagedAt,
+		SHA256:  hex.EncodeToString(sum),
+		Size:    fi.Size(),
+		Codec:   "gzip",
+		Created: wc.clock.Now(),
+	}
+	if e.To.IsZero() {
+		e.To = e.Created
+	}
+	if wc.opts.Encrypter != nil {
+		e.Codec += "+" + strings.TrimPrefix(wc.opts.Encrypter.Ext(), ".")
+	}
+	if len(m.Archives) > 0 {
+		prev := m.Archives[0]
+		e.Start = prev.End
+		e.From = &prev.To
+	}
+	e.End = e.Start + size
+	if staged != nil && wc.opts.Timestamp != nil && len(wc.delim) > 0 && size > 0 {
+		e.First, e.Last, err = wc.stagedTimes(staged, size)
+		if err != nil {
+			return err
+		}
+	}
+	archives := []ManifestEntry{e}
+	for _, old := range m.Archives {
+		n, ok := wc.archiveNumber(old.Archive)
+		if !ok {
+			continue
+		}
+		old.Archive = wc.archiveName(n + 1)
+		fi, err := wc.fs.Stat(old.Archive)
+		if err != nil || fi.Size() != old.Size {
+			continue
+		}
+		archives = append(archives, old)
+	}
+	m.Archives = archives
+	return wc.writeManifest(m)
+}
+
+// writeManifest replaces the manifest with m.
+func (wc *Writer) writeManifest(m *Manifest) error {
+	name := manifestName(wc.path, wc.opts.ArchiveDir)
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	err = writeFile(wc.fs, name+".tmp", data, wc.archivePerm())
+	if err == nil {
+		err = wc.setAttrs(name+".tmp", wc.archivePerm())
+	}
+	if err == nil {
+		err = wc.rename(name+".tmp", name)
+	}
+	if err != nil {
+		_ = wc.fs.Remove(name + ".tmp")
+	}
+	return err
+}
+
+// archiveNumber returns the number of the archive name, reporting
+// whether name is an archive of wc.
+func (wc *Writer) archiveNumber(name string) (int, bool) {
+	prefix := wc.archiveBase + "."
+	if !strings.HasPrefix(name, prefix) ||
+		!strings.HasSuffix(name, wc.archiveExt) ||
+		len(name) < len(prefix)+len(wc.archiveExt) {
+		return 0, false
+	}
+	s := name[len(prefix) : len(name)-len(wc.archiveExt)]
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || strconv.Itoa(n) != s {
+		return 0, false
+	}
+	return n, true
+}
+
+// stagedTimes returns the times of the first and last lines of the
+// size bytes of the staging file staged, or nil where Timestamp finds
+// none.
+func (wc *Writer) stagedTimes(staged File, size int64) (first, last *time.Time, err error) {
+	at := func(line []byte) *time.Time {
+		if t, ok := wc.opts.Timestamp(line); ok {
+			return &t
+		}
+		return nil
+	}
+	buf := make([]byte, size)
+	if size > maxManifestLine {
+		buf = buf[:maxManifestLine]
+	}
+	err = readAt(staged, buf, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if i := bytes.Index(buf, wc.delim); i != -1 {
+		buf = buf[:i]
+	}
+	first = at(buf)
+	end := size
+	if end >= int64(len(wc.delim)) {
+		tail := make([]byte, len(wc.delim))
+		err = readAt(staged, tail, end-int64(len(tail)))
+		if err != nil {
+			return nil, nil, err
+		}
+		if bytes.Equal(tail, wc.delim) {
+			end -= int64(len(tail))
+		}
+	}
+	line, err := readLine(staged, end, wc.delim)
+	if err != nil {
+		return nil, nil, err
+	}
+	return first, at(line), nil
+}
@@ -0,0 +1,438 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Errors of a memFS not defined by package os.
+var (
+	errNotDir         = errors.New("not a directory")
+	errIsDir          = errors.New("is a directory")
+	errNotEmpty       = errors.New("directory not empty")
+	errNegativeOffset = errors.New("negative offset")
+	errAppendWriteAt  = errors.New("WriteAt in append mode")
+)
+
+// memFS is an FS held in memory, used by NewMemory. Its root is the
+// directory ".".
+type memFS struct {
+	clock Clock
+	mu    sync.Mutex
+	nodes map[string]*memNode // by cleaned name
+}
+
+// memNode is a file or directory of a memFS. Several names share a
+// node after Link.
+type memNode struct {
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// memInfo is the os.FileInfo of a memNode. Its Sys value is the node,
+// so that sameFile recognises it.
+type memInfo struct {
+	name string
+	node *memNode
+	size int64
+	mode os.FileMode
+	mod  time.Time
+}
+
+func (fi *memInfo) Name() string       { return fi.name }
+func (fi *memInfo) Size() int64        { return fi.size }
+func (fi *memInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *memInfo) ModTime() time.Time { return fi.mod }
+func (fi *memInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *memInfo) Sys() interface{}   { return fi.node }
+
+// memFile is an open file of a memFS.
+type memFile struct {
+	fs         *memFS
+	name       string
+	node       *memNode
+	off        int64
+	appendMode bool
+	readOnly   bool
+}
+
+func newMemFS(clock Clock) *memFS {
+	return &memFS{
+		clock: clock,
+		nodes: map[string]*memNode{
+			".": {mode: os.ModeDir | 0755, modTime: clock.Now()},
+		},
+	}
+}
+
+// info returns the os.FileInfo of the node n named name. fs.mu must
+// be held.
+func (fs *memFS) info(name string, n *memNode) *memInfo {
+	return &memInfo{
+		name: filepath.Base(name),
+		node: n,
+		size: int64(len(n.data)),
+		mode: n.mode,
+		mod:  n.modTime,
+	}
+}
+
+// lookup returns the node named name, or an *os.PathError for op if
+// there is none. fs.mu must be held.
+func (fs *memFS) lookup(op, name string) (*memNode, error) {
+	n, ok := fs.nodes[filepath.Clean(name)]
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return n, nil
+}
+
+// parent checks that the directory which would hold name exists. fs.mu
+// must be held.
+func (fs *memFS) parent(op, name string) error {
+	n, err := fs.lookup(op, filepath.Dir(name))
+	if err != nil {
+		return err
+	}
+	if !n.mode.IsDir() {
+		return &os.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+	return nil
+}
+
+func (fs *memFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n, err := fs.lookup("open", name)
+	switch {
+	case err == nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case err != nil && flag&os.O_CREATE == 0:
+		return nil, err
+	case err != nil:
+		err = fs.parent("open", name)
+		if err != nil {
+			return nil, err
+		}
+		n = &memNode{mode: perm & os.ModePerm, modTime: fs.clock.Now()}
+		fs.nodes[filepath.Clean(name)] = n
+	}
+	readOnly := flag&(os.O_WRONLY|os.O_RDWR) == 0
+	if n.mode.IsDir() && !readOnly {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errIsDir}
+	}
+	if flag&os.O_TRUNC != 0 && !readOnly {
+		n.data = nil
+		n.modTime = fs.clock.Now()
+	}
+	return &memFile{
+		fs:         fs,
+		name:       name,
+		node:       n,
+		appendMode: flag&os.O_APPEND != 0,
+		readOnly:   readOnly,
+	}, nil
+}
+
+func (fs *memFS) Rename(oldpath, newpath string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n, err := fs.lookup("rename", oldpath)
+	if err == nil {
+		err = fs.parent("rename", newpath)
+	}
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath,
+			Err: err.(*os.PathError).Err}
+	}
+	if n.mode.IsDir() {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath,
+			Err: errIsDir}
+	}
+	delete(fs.nodes, filepath.Clean(oldpath))
+	fs.nodes[filepath.Clean(newpath)] = n
+	return nil
+}
+
+func (fs *memFS) Link(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n, err := fs.lookup("link", oldname)
+	if err == nil {
+		err = fs.parent("link", newname)
+	}
+	if err == nil {
+		_, e := fs.lookup("link", newname)
+		if e == nil {
+			err = &os.PathError{Err: os.ErrExist}
+		}
+	}
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname,
+			Err: err.(*os.PathError).Err}
+	}
+	fs.nodes[filepath.Clean(newname)] = n
+	return nil
+}
+
+func (fs *memFS) Remove(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n, err := fs.lookup("remove", name)
+	if err != nil {
+		return err
+	}
+	clean := filepath.Clean(name)
+	if n.mode.IsDir() {
+		for k := range fs.nodes {
+			if k != clean && filepath.Dir(k) == clean {
+				return &os.PathError{Op: "remove", Path: name,
+					Err: errNotEmpty}
+			}
+		}
+	}
+	delete(fs.nodes, clean)
+	return nil
+}
+
+func (fs *memFS) Stat(name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n, err := fs.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.info(name, n), nil
+}
+
+func (fs *memFS) Lstat(name string) (os.FileInfo, error) {
+	return fs.Stat(name)
+}
+
+func (fsys *memFS) ReadDir(name string) ([]os.DirEntry, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	n, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !n.mode.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	clean := filepath.Clean(name)
+	var entries []os.DirEntry
+	for k, n := range fsys.nodes {
+		if k != clean && filepath.Dir(k) == clean {
+			entries = append(entries, fs.FileInfoToDirEntry(fsys.info(k, n)))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (fs *memFS) MkdirAll(path string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var missing []string
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		n, ok := fs.nodes[dir]
+		if ok {
+			if !n.mode.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: dir, Err: errNotDir}
+			}
+			break
+		}
+		if dir == filepath.Dir(dir) {
+			// a root other than "."
+			return &os.PathError{Op: "mkdir", Path: dir, Err: os.ErrNotExist}
+		}
+		missing = append(missing, dir)
+	}
+	for _, dir := range missing {
+		fs.nodes[dir] = &memNode{
+			mode:    os.ModeDir | perm&os.ModePerm,
+			modTime: fs.clock.Now(),
+		}
+	}
+	return nil
+}
+
+func (fs *memFS) Chmod(name string, mode os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n, err := fs.lookup("chmod", name)
+	if err != nil {
+		return err
+	}
+	n.mode = n.mode&os.ModeType | mode&os.ModePerm
+	return nil
+}
+
+// Chown does nothing as a memFS has no owners.
+func (fs *memFS) Chown(name string, uid, gid int) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	_, err := fs.lookup("chown", name)
+	return err
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	n, err := f.readAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	n, err := f.readAt(p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// readAt copies the data at off to p. f.fs.mu must be held.
+func (f *memFile) readAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: errNegativeOffset}
+	}
+	if off >= int64(len(f.node.data)) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	return copy(p, f.node.data[off:]), nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.appendMode {
+		f.off = int64(len(f.node.data))
+	}
+	n, err := f.writeAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.appendMode {
+		return 0, &os.PathError{Op: "writeat", Path: f.name, Err: errAppendWriteAt}
+	}
+	return f.writeAt(p, off)
+}
+
+// writeAt copies p to the data at off, extending it if necessary.
+// f.fs.mu must be held.
+func (f *memFile) writeAt(p []byte, off int64) (int, error) {
+	if f.readOnly {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: os.ErrPermission}
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: errNegativeOffset}
+	}
+	f.resize(max(off+int64(len(p)), int64(len(f.node.data))))
+	copy(f.node.data[off:], p)
+	f.node.modTime = f.fs.clock.Now()
+	return len(p), nil
+}
+
+// resize sets the length of the file's data to size, zero filling
+// any extension. f.fs.mu must be held.
+func (f *memFile) resize(size int64) {
+	d := f.node.data
+	if size <= int64(cap(d)) {
+		old := int64(len(d))
+		d = d[:size]
+		if size > old {
+			clear(d[old:])
+		}
+	} else {
+		d = append(d, make([]byte, size-int64(len(d)))...)
+	}
+	f.node.data = d
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: errNegativeOffset}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.readOnly {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: os.ErrPermission}
+	}
+	if size < 0 {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: errNegativeOffset}
+	}
+	f.resize(size)
+	f.node.modTime = f.fs.clock.Now()
+	return nil
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return f.fs.info(f.name, f.node), nil
+}
+
+func (f *memFile) Sync() error {
+	return nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
@@ -0,0 +1,169 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+// memoryLog is the name of the log file of a Memory.
+const memoryLog = "log"
+
+// Memory is a Writer which keeps its log file and archives in memory
+// instead of on disk, so that tests can check what would be in each
+// file without touching the file system. Its log file is named "log"
+// and its archives "log.1.gz" and so on, in the directory ".". It
+// rotates exactly as a Writer opened on disk with the same settings.
+type Memory struct {
+	*Writer
+	fs *memFS
+}
+
+// NewMemory returns a Memory with the given maxSize and maxFiles, as
+// for Open.
+func NewMemory(maxSize int64, maxFiles int) (*Memory, error) {
+	return NewMemoryWithOptions(maxSize, maxFiles, nil)
+}
+
+// NewMemoryWithOptions is like NewMemory but takes additional settings
+// in opts, as for OpenWithOptions. Its FS is ignored. The directories
+// named by ArchiveDir and FallbackPath are created in memory.
+func NewMemoryWithOptions(maxSize int64, maxFiles int, opts *Options) (*Memory, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	clock := o.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	fs := newMemFS(clock)
+	o.FS = fs
+	for _, dir := range []string{o.ArchiveDir, filepath.Dir(o.FallbackPath)} {
+		if dir != "" {
+			err := fs.MkdirAll(dir, 0755)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	wc, err := OpenWithOptions(memoryLog, 0600, maxSize, maxFiles, &o)
+	if err != nil {
+		return nil, err
+	}
+	return &Memory{Writer: wc, fs: fs}, nil
+}
+
+// Log returns the contents of the log file.
+func (m *Memory) Log() []byte {
+	data, _ := m.ReadFile(memoryLog)
+	return data
+}
+
+// Archive returns the decompressed contents of archive n, where 1 is
+// the newest. It waits for any rotation in progress to complete, so
+// must not be called from OnRotate. It fails if Encrypter is set.
+func (m *Memory) Archive(n int) ([]byte, error) {
+	m.rotMu.Lock()
+	defer m.rotMu.Unlock()
+	return m.archive(n)
+}
+
+// archive is Archive with m.rotMu held.
+func (m *Memory) archive(n int) ([]byte, error) {
+	if m.opts.Encrypter != nil {
+		return nil, errors.New("logrot: archives are encrypted")
+	}
+	data, err := m.ReadFile(m.archiveName(n))
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(zr)
+}
+
+// NumArchives returns the number of archives. It waits for any
+// rotation in progress, as Archive does.
+func (m *Memory) NumArchives() int {
+	m.rotMu.Lock()
+	defer m.rotMu.Unlock()
+	return m.numArchives()
+}
+
+// numArchives is NumArchives with m.rotMu held.
+func (m *Memory) numArchives() int {
+	n := 0
+	for {
+		_, err := m.fs.Stat(m.archiveName(n + 1))
+		if err != nil {
+			return n
+		}
+		n++
+	}
+}
+
+// Files returns the contents of the log file followed by the
+// decompressed contents of each archive, newest first, so that
+// Files()[n] is the data in archive n. It waits for any rotation in
+// progress, as Archive does.
+func (m *Memory) Files() ([][]byte, error) {
+	m.rotMu.Lock()
+	defer m.rotMu.Unlock()
+	files := [][]byte{m.Log()}
+	for i := 1; i <= m.numArchives(); i++ {
+		data, err := m.archive(i)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, data)
+	}
+	return files, nil
+}
+
+// Names returns the names of all the files and directories held by
+// m, including checksum files, the staging file and any others, in
+// sorted order.
+func (m *Memory) Names() []string {
+	m.fs.mu.Lock()
+	defer m.fs.mu.Unlock()
+	var names []string
+	for name := range m.fs.nodes {
+		if name != "." {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadFile returns the contents of the file name held by m.
+func (m *Memory) ReadFile(name string) ([]byte, error) {
+	return readFile(m.fs, name)
+}
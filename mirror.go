@@ -0,0 +1,143 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// checkMirror returns an error if CompressMirror is set with an option
+// it cannot be used with.
+func checkMirror(opts *Options) error {
+	bad := ""
+	switch {
+	case opts.Shared:
+		bad = "Shared"
+	case opts.CompressLive:
+		bad = "CompressLive"
+	case opts.Encrypter != nil:
+		bad = "Encrypter"
+	default:
+		return nil
+	}
+	return errors.New("logrot: CompressMirror cannot be used with " + bad)
+}
+
+// mirrorName returns the name of the compressed mirror of the log
+// file.
+func (wc *Writer) mirrorName() string {
+	return wc.path + ".mirror.gz"
+}
+
+// openMirror replaces the compressed mirror, if any, with one holding
+// the lines now in the log file. On failure the mirror is dropped and
+// rotations compress the log file as usual.
+func (wc *Writer) openMirror() {
+	wc.discardMirror()
+	f, err := wc.fs.OpenFile(wc.mirrorName(),
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, wc.archivePerm())
+	if err != nil {
+		wc.mirrorFailed(err)
+		return
+	}
+	err = wc.setAttrs(wc.mirrorName(), wc.archivePerm())
+	if err != nil {
+		_ = f.Close()
+		wc.mirrorFailed(err)
+		return
+	}
+	wc.mirror = f
+	if wc.mirrorGz == nil {
+		wc.mirrorGz = gzip.NewWriter(f)
+	} else {
+		wc.mirrorGz.Reset(f)
+	}
+	wc.mirrored = 0
+	wc.updateMirror()
+}
+
+// updateMirror compresses the lines written to the log file since it
+// was last called into the mirror, if there is one.
+func (wc *Writer) updateMirror() {
+	end := wc.lastNewline + 1
+	if end > wc.size {
+		// the write of the last newline failed
+		end = wc.size
+	}
+	if wc.mirror == nil || end <= wc.mirrored {
+		return
+	}
+	_, err := copyBuffer(wc.mirrorGz,
+		io.NewSectionReader(wc.file, wc.mirrored, end-wc.mirrored))
+	if err != nil {
+		wc.mirrorFailed(err)
+		return
+	}
+	wc.mirrored = end
+}
+
+// archiveMirror completes the mirror, adding any footer, and moves it
+// to <path>.1.gz in place of compressing the log file. The rotation
+// lock must be held.
+func (wc *Writer) archiveMirror() error {
+	footer := wc.footer(wc.archiveName(1))
+	var err error
+	if len(footer) > 0 {
+		_, err = wc.mirrorGz.Write(footer)
+	}
+	if e := wc.mirrorGz.Close(); err == nil {
+		err = e
+	}
+	if err == nil && wc.opts.SyncOnRotate {
+		err = wc.mirror.Sync()
+	}
+	if e := wc.mirror.Close(); err == nil {
+		err = e
+	}
+	wc.mirror = nil
+	if err != nil {
+		_ = wc.fs.Remove(wc.mirrorName())
+		return err
+	}
+	return wc.archiveGz(wc.mirrorName(), wc.mirrored+int64(len(footer)))
+}
+
+// discardMirror closes and removes the mirror, if there is one.
+func (wc *Writer) discardMirror() {
+	if wc.mirror == nil {
+		return
+	}
+	_ = wc.mirror.Close()
+	_ = wc.fs.Remove(wc.mirrorName())
+	wc.mirror = nil
+}
+
+// mirrorFailed reports err, which happened while updating the
+// mirror, and drops it.
+func (wc *Writer) mirrorFailed(err error) {
+	wc.diag(slog.LevelWarn, "logrot: compressed mirror failed", "error", err)
+	wc.discardMirror()
+}
@@ -0,0 +1,65 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import "os"
+
+// moveFile renames src to dst. If they are on different file systems
+// it instead copies src to dst.tmp, syncs it, renames it to dst and
+// removes src, so dst is never seen partially written.
+func (wc *Writer) moveFile(src, dst string, perm os.FileMode) error {
+	err := wc.rename(src, dst)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+	err = copyFile(wc.fs, src, dst+".tmp", perm)
+	if err == nil {
+		err = wc.rename(dst+".tmp", dst)
+	}
+	if err != nil {
+		_ = wc.fs.Remove(dst + ".tmp")
+		return err
+	}
+	return wc.fs.Remove(src)
+}
+
+// copyFile copies src to a new file dst on fsys, syncing it before
+// it is closed.
+func copyFile(fsys FS, src, dst string, perm os.FileMode) error {
+	r, err := open(fsys, src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := fsys.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = copyBuffer(w, r)
+	if err == nil {
+		err = w.Sync()
+	}
+	if e := w.Close(); err == nil {
+		err = e
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"os"
+	"syscall"
+)
+
+var procReOpenFile = modkernel32.NewProc("ReOpenFile")
+
+// Access rights from <winnt.h> not defined by package syscall.
+const (
+	fileWriteEA         = 0x00000010 // FILE_WRITE_EA
+	standardRightsWrite = 0x00020000 // STANDARD_RIGHTS_WRITE
+)
+
+// openFile is like os.OpenFile, for the flags used by openLog, but
+// the file is opened with FILE_SHARE_DELETE so that it can be renamed
+// or deleted while open, by RenameRotate or by another program, as on
+// Unix. In append mode the file is opened without FILE_WRITE_DATA so
+// that every write goes to the end of the file.
+func openFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	namep, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	access := uint32(syscall.GENERIC_READ)
+	if flag&os.O_APPEND != 0 {
+		access |= syscall.FILE_APPEND_DATA | syscall.FILE_WRITE_ATTRIBUTES |
+			fileWriteEA | standardRightsWrite | syscall.SYNCHRONIZE
+	} else {
+		access |= syscall.GENERIC_WRITE
+	}
+	share := uint32(syscall.FILE_SHARE_READ | syscall.FILE_SHARE_WRITE |
+		syscall.FILE_SHARE_DELETE)
+	createmode := uint32(syscall.OPEN_EXISTING)
+	if flag&os.O_CREATE != 0 {
+		createmode = syscall.OPEN_ALWAYS
+	}
+	attrs := uint32(syscall.FILE_ATTRIBUTE_NORMAL)
+	if perm&0200 == 0 {
+		attrs = syscall.FILE_ATTRIBUTE_READONLY
+	}
+	h, err := syscall.CreateFile(namep, access, share, nil, createmode,
+		attrs, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return os.NewFile(uintptr(h), name), nil
+}
+
+// truncateFile changes the size of f. A file opened by openFile in
+// append mode lacks the access needed, so if necessary a second handle
+// to the same file is opened with ReOpenFile to do it.
+func truncateFile(file File, size int64) error {
+	err := file.Truncate(size)
+	f, ok := file.(*os.File)
+	if err == nil || !os.IsPermission(err) || !ok {
+		return err
+	}
+	share := uint32(syscall.FILE_SHARE_READ | syscall.FILE_SHARE_WRITE |
+		syscall.FILE_SHARE_DELETE)
+	r, _, e := procReOpenFile.Call(f.Fd(), syscall.GENERIC_WRITE,
+		uintptr(share), 0)
+	if syscall.Handle(r) == syscall.InvalidHandle {
+		return &os.PathError{Op: "truncate", Path: f.Name(), Err: e}
+	}
+	w := os.NewFile(r, f.Name())
+	err = w.Truncate(size)
+	if e := w.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// syncDir does nothing as Windows does not support syncing a
+// directory.
+func syncDir(fsys FS, dir string) error {
+	return nil
+}
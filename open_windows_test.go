@@ -0,0 +1,167 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readGzip returns the uncompressed contents of the archive name.
+func readGzip(t *testing.T, name string) string {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestOpenFileShareDelete(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "log")
+	f, err := openFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("line\n")); err != nil {
+		t.Fatal(err)
+	}
+	// without FILE_SHARE_DELETE both fail with a sharing violation
+	moved := filepath.Join(dir, "log.moved")
+	if err := os.Rename(name, moved); err != nil {
+		t.Fatalf("rename while open: %v", err)
+	}
+	if err := os.Remove(moved); err != nil {
+		t.Fatalf("remove while open: %v", err)
+	}
+}
+
+func TestRotateWhileOpen(t *testing.T) {
+	for _, rename := range []bool{false, true} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "log")
+		wc, err := OpenWithOptions(path, 0644, 1000, 3,
+			&Options{RenameRotate: rename})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := []string{"0123456789\n", "abcdefghij\n", "ABCDEFGHIJ\n"}
+		for i, l := range lines {
+			if _, err := wc.Write([]byte(l)); err != nil {
+				t.Fatalf("RenameRotate %v: %v", rename, err)
+			}
+			if i < len(lines)-1 {
+				// the log file is open, and with RenameRotate is
+				// renamed aside rather than copied
+				if err := wc.Rotate(); err != nil {
+					t.Fatalf("RenameRotate %v: %v", rename, err)
+				}
+			}
+		}
+		if err := wc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := readGzip(t, path+".2.gz"); got != lines[0] {
+			t.Errorf("RenameRotate %v: archive 2 holds %q", rename, got)
+		}
+		if got := readGzip(t, path+".1.gz"); got != lines[1] {
+			t.Errorf("RenameRotate %v: archive 1 holds %q", rename, got)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != lines[2] {
+			t.Errorf("RenameRotate %v: log file holds %q", rename, data)
+		}
+	}
+}
+
+func TestArchiveNameSeparators(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "app.log")
+	archives := filepath.Join(dir, "old")
+	wc, err := OpenWithOptions(path, 0644, 20, 3,
+		&Options{MkdirAll: true, ArchiveDir: archives})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wc.Close()
+	want := filepath.Join(archives, "app.log.1.gz")
+	if got := wc.archiveName(1); got != want {
+		t.Errorf("archiveName(1) = %q, want %q", got, want)
+	}
+	if strings.Contains(wc.archiveName(2), "/") {
+		t.Errorf("archiveName(2) = %q contains a slash", wc.archiveName(2))
+	}
+	if _, err := wc.Write([]byte("0123456789\nabcdefghijk\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readGzip(t, want); got != "0123456789\n" {
+		t.Errorf("%s holds %q", want, got)
+	}
+}
+
+func TestTruncateAppend(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "log")
+	f, err := openFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	// the handle lacks FILE_WRITE_DATA, so this needs ReOpenFile
+	if err := f.Truncate(0); !os.IsPermission(err) {
+		t.Fatalf("Truncate of append handle = %v, want permission error", err)
+	}
+	if err := truncateFile(f, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("second\n")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte("second\n")) {
+		t.Errorf("log file holds %q", data)
+	}
+}
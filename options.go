@@ -0,0 +1,631 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Options holds optional settings for OpenWithOptions. The zero value
+// gives the behaviour described in the comment for Open.
+type Options struct {
+	// Append selects opening the log file with O_APPEND and writing
+	// with plain writes instead of writing at the recorded file
+	// size. Writes are cheaper and data appended to the file by
+	// another process is not overwritten, although it is not
+	// counted towards maxSize until the next rotation. A rotation
+	// rereads the size of the file and finds its last newline again
+	// before archiving it, so that a line written by another
+	// process is not split, and the contents beyond the last
+	// newline, including any appended while the data was copied,
+	// are read into memory before being written back to the emptied
+	// file. Several processes rotating one log file must also set
+	// LockFile, or their rotations clash and fail. Even then, data
+	// another process appends in the moment the file is emptied is
+	// lost, and a line can be split or archived twice: only Shared
+	// coordinates writes between processes.
+	Append bool
+
+	// LazyOpen selects deferring opening, and if necessary
+	// creating, the log file until the first Write, so that a log
+	// which usually stays empty, such as an optional debug log, does
+	// not create a file at all. OpenWithOptions still checks the
+	// options and that path is not other than a regular file, but
+	// any other error in opening the log file, or in recovering from
+	// a rotation left incomplete by an earlier process, is returned
+	// by that Write.
+	LazyOpen bool
+
+	// IdleClose, if greater than zero, selects closing the log file
+	// once nothing has been written to it for IdleClose, and opening
+	// it again on the next Write, so that a process with many rarely
+	// written logs does not hold a file descriptor for each. Any
+	// unsynced data is synced first. The log file is reopened as for
+	// ReopenInterval, so it is recreated if it has been removed.
+	IdleClose time.Duration
+
+	// AsyncQueue, if greater than zero, selects asynchronous mode.
+	// Write copies p onto a queue of AsyncQueue entries and returns
+	// without waiting for the data to reach the file. A background
+	// goroutine takes data from the queue and writes it in batches.
+	// An error from a background write is returned by the next call
+	// to Write.
+	AsyncQueue int
+
+	// AsyncOverflow selects what Write does in asynchronous mode when
+	// the queue is full. With DropNewest or DropOldest, Write never
+	// blocks, for use on latency-critical paths.
+	AsyncOverflow Overflow
+
+	// HighWater, if greater than zero, is the number of writes
+	// waiting in the asynchronous queue at which OnHighWater is
+	// called with true, so that the application can shed load, for
+	// example by logging less, before writes are dropped or block.
+	// It is called with false once the queue has drained to half of
+	// HighWater. Calls are never concurrent, and are made from Write
+	// or the background goroutine, so OnHighWater must not write to
+	// the Writer.
+	HighWater   int
+	OnHighWater func(high bool)
+
+	// RateLimit, if greater than zero, limits the rate at which data
+	// is written to RateLimit bytes a second, or lines a second if
+	// RateLines is set, so that a storm of logging cannot fill the
+	// disk. Up to RateBurst, or a second's worth if RateBurst is
+	// zero, may be written at once. Each call to Write is let through
+	// whole or not at all, and counts as at least one line.
+	// RateOverflow selects what Write does when the limit is
+	// exceeded. The data dropped is reported by a line such as
+	// "logrot: 12 lines (960 bytes) dropped by the rate limit",
+	// written between lines at most once a second, and on Close.
+	RateLimit    float64
+	RateLines    bool
+	RateBurst    float64
+	RateOverflow Overflow
+
+	// DailyQuota, if greater than zero, is the number of bytes that
+	// may be passed to Write each day, from midnight in the time zone
+	// of the clock, whatever maxSize is, so that one bad day cannot
+	// use up the whole history. Once it is used up, lines are dropped
+	// until midnight, except those for which QuotaKeep, if not nil,
+	// returns true, such as errors with IsError. QuotaKeep is passed
+	// each line less its delimiter. A line saying that the quota is
+	// used up is written when it happens, and one reporting the data
+	// dropped is written with the next day's first write, or on
+	// Close. The end of a line begun by an earlier call to Write is
+	// counted as a line of its own, and the lines logrot writes are
+	// put on lines of their own.
+	DailyQuota int64
+	QuotaKeep  func(line []byte) bool
+
+	// MinFreeSpace, if greater than zero, is the free space in bytes
+	// on the file system holding the log file below which it is
+	// taken to be nearly full. Write checks the free space at most
+	// every five seconds, and while it is low rotates the log file
+	// early, if it holds a complete line, and removes the oldest
+	// archives, keeping PurgeKeep of them, until it is not, so that
+	// logging does not fill the disk. If LowSpaceKeep is not nil,
+	// only the lines for which it returns true, such as errors with
+	// IsError, are written while the free space is low, and a line
+	// reporting the data dropped is written once it is not, or on
+	// Close. LowSpaceKeep is passed each line less its delimiter. It
+	// is ignored if FS is set, and OpenWithOptions fails on
+	// platforms where the free space cannot be found.
+	MinFreeSpace int64
+	LowSpaceKeep func(line []byte) bool
+
+	// BackgroundCompress selects compressing archives in a
+	// background goroutine. Normally the Write that causes a
+	// rotation returns only once the new archive has been compressed,
+	// although other goroutines may write meanwhile. With
+	// BackgroundCompress set, that Write returns as soon as the log
+	// file has been truncated. A rotation that occurs while the
+	// previous one is still being compressed waits for it to finish.
+	// Errors from the goroutine are returned by the next rotation or
+	// by Close.
+	BackgroundCompress bool
+
+	// RenameRotate selects a faster rotation when the log file ends
+	// in a newline, as it normally does when each Write ends in one.
+	// Rather than being copied, the log file is renamed to
+	// <path>.rotating and replaced with a new empty file, and
+	// <path>.rotating is then compressed to <path>.1.gz as in any
+	// other rotation. Programs following the log file by file
+	// descriptor must reopen it after a rotation.
+	RenameRotate bool
+
+	// CompressLive selects writing the log file itself in gzip
+	// format, so that a rotation needs only to complete the file
+	// and rename it to <path>.1.gz, rather than compress its whole
+	// contents, which for a large maxSize can take long. maxSize
+	// then counts the data before compression. The data is flushed
+	// to the file after each Write, or if LiveFlush is positive at
+	// most LiveFlush after it is written, so that the file can be
+	// followed, and a Reader opened with CompressLive set reads it.
+	// Part of a line not yet ended is kept in memory until it is,
+	// or until Close, and is lost if the process crashes. An
+	// existing log file is archived as it is on opening. Header and
+	// Footer are ignored, as are VerifyArchive, BackgroundCompress
+	// and RenameRotate, and OpenWithOptions fails if Shared,
+	// Append, LockFile, Encrypter, Preallocate, FallbackPath,
+	// IdleClose, ReopenInterval, CopyTruncate, RecordStart or
+	// JSONLines is set.
+	CompressLive bool
+	LiveFlush    time.Duration
+
+	// CompressMirror selects keeping, alongside the plain log file,
+	// a compressed copy of its lines at <path>.mirror.gz, updated as
+	// they are written, so that a rotation needs only to complete
+	// the copy and rename it to <path>.1.gz, at the cost of
+	// compressing continuously. The copy is rebuilt from the log
+	// file when it is opened and removed by Close. If it cannot be
+	// written, rotations compress the log file as usual until the
+	// next one succeeds. OpenWithOptions fails if Shared,
+	// CompressLive or Encrypter is set.
+	CompressMirror bool
+
+	// Preallocate selects reserving disk space for maxSize bytes of
+	// log file when it is opened and after each rotation, reducing
+	// fragmentation and making a lack of space show up as an error
+	// from Open or from the Write that rotates, rather than part way
+	// through a later write. The file size is unaffected. It is only
+	// implemented on Linux and is ignored by file systems that do not
+	// support it.
+	Preallocate bool
+
+	// ReopenInterval, if greater than zero, makes Write check, at
+	// most once per ReopenInterval, whether path still refers to the
+	// open log file. If the file has been deleted or renamed by
+	// another program, path is reopened, creating it if necessary,
+	// so that writes do not disappear into the orphaned file.
+	ReopenInterval time.Duration
+
+	// CopyTruncate makes Write check, before each write, whether the
+	// log file has been truncated by another program, such as
+	// logrotate with its copytruncate directive, and if so carry on
+	// from the new end of the file, so that the two can manage the
+	// same file. Data written between the copy and the truncation is
+	// lost, as with any use of copytruncate.
+	CopyTruncate bool
+
+	// AdoptRotated selects taking the log file, when ReopenInterval
+	// or CheckRotated finds that another program has renamed it
+	// within its directory, as the newest archive: it is compressed
+	// to <path>.1.gz, the archives being renumbered, and removed, as
+	// in a rotation, before path is reopened. This lets hosts where
+	// other tools also rotate the file keep a single set of archives.
+	// It has no effect if maxFiles is 1.
+	AdoptRotated bool
+
+	// ArchiveDir, if non-empty, is the directory in which archives
+	// are kept, named <base>.<n>.gz where <base> is the last element
+	// of path. It may be on a different file system from path: each
+	// archive is compressed next to the log file and then moved into
+	// ArchiveDir, by copying if it cannot be renamed, so ArchiveDir
+	// only ever holds complete archives.
+	ArchiveDir string
+
+	// MkdirAll selects creating the directory of the log file, and
+	// ArchiveDir if set, with any missing parents, when the log file
+	// is opened, so that a path such as /var/log/myapp/app.log works
+	// on a fresh host. The directories are created with permissions
+	// DirPerm, or 0755 if it is zero, before the umask.
+	MkdirAll bool
+	DirPerm  os.FileMode
+
+	// FallbackPath, if non-empty, is a file to which Write switches
+	// if the log file becomes unwritable, because of a permission
+	// change or a read-only file system, rather than failing. A line
+	// noting the switch is written to FallbackPath. Write tries to
+	// return to the log file at most once per FallbackRetry and, when
+	// it succeeds, writes a line to the log file recording how much
+	// data went to FallbackPath and when. FallbackPath is not
+	// rotated.
+	FallbackPath string
+
+	// FallbackRetry is the interval between attempts to return to the
+	// log file while writing to FallbackPath. If zero, 10 seconds is
+	// used.
+	FallbackRetry time.Duration
+
+	// ShadowPath, if non-empty, is a second log file, typically on
+	// another volume, to which everything written to the log file
+	// is also written, and which is rotated whenever the log file
+	// is, keeping maxFiles files of its own beside it, so that the
+	// failure of one volume loses no data. The shadow is compressed
+	// in the background, and a failure to write, rotate or open it
+	// is reported by the Logger, an Event and Stats.ShadowErrors but
+	// does not affect the log file: the shadow is dropped and opened
+	// again at the next rotation. Writes to it are synchronous, so
+	// a volume which hangs rather than fails delays Write. It
+	// cannot be used with Shared.
+	ShadowPath string
+
+	// Replica, if non-nil, is passed a copy of everything written to
+	// the log file and each rotation, such as by a client of package
+	// logrotrepl keeping the same files on another host.
+	Replica Replica
+
+	// LockFile selects taking an exclusive advisory lock on
+	// <path>.lock for the duration of each rotation, from copying
+	// the log file until its archive is complete. It allows several
+	// processes, each with their own Writer, to share a set of
+	// archives without corrupting the numbering. The size of the
+	// log file is reread under the lock, so that a rotation by
+	// another process is seen, but writes are not made under it:
+	// LockFile alone does not make several Writers writing one log
+	// file safe, for which Shared is needed. Open fails if locks
+	// are not supported on the platform.
+	LockFile bool
+
+	// Shared selects a mode for several processes, such as forked
+	// workers, appending to the same log file through their own
+	// Writers. It implies Append and LockFile. Each Write holds the
+	// lock on <path>.lock while it writes, first bringing the
+	// recorded size of the log file up to date with data written by
+	// the other processes, so whichever process crosses maxSize
+	// performs the rotation. The rotation, including compression,
+	// completes before the lock is released. BackgroundCompress is
+	// ignored.
+	Shared bool
+
+	// SyncOnRotate selects calling fsync during each rotation: on
+	// <path>.rotating before the log file is truncated, on the log
+	// file afterwards, and on the new archive once it is written. A
+	// crash just after a rotation then cannot lose the archived data
+	// or leave a truncated archive.
+	SyncOnRotate bool
+
+	// SyncDir selects calling fsync on the directories holding the
+	// log file and archives during each rotation, after
+	// <path>.rotating is created and after the archives are renamed
+	// and the new archive is created, so that a crash cannot lose
+	// the directory entries. It is ignored on Windows.
+	SyncDir bool
+
+	// Durable selects both SyncOnRotate and SyncDir.
+	Durable bool
+
+	// SyncInterval, if greater than zero, bounds the time for which
+	// written data may remain unsynced: after a Write, the log file
+	// is fsynced within SyncInterval.
+	SyncInterval time.Duration
+
+	// SyncEveryBytes, if greater than zero, makes Write fsync the log
+	// file once SyncEveryBytes bytes have been written since the last
+	// sync.
+	SyncEveryBytes int64
+
+	// VerifyArchive selects reading back each new archive before it
+	// is given its final name, checking that it decompresses to data
+	// of the same length and CRC-32 as the data archived. If it does
+	// not, the rotation fails and the data is kept in
+	// <path>.rotating, to be archived again by the next call to Open.
+	VerifyArchive bool
+
+	// Checksums selects writing the SHA-256 checksum of each new
+	// archive, in hex, to a file of the same name with ".sha256"
+	// added, which is renamed and removed along with the archive.
+	// OpenWithOptions reads every archive with a checksum file to
+	// check it, renaming any which does not match with a ".corrupt"
+	// suffix.
+	Checksums bool
+
+	// Manifest selects keeping a JSON index of the archives, as read
+	// by ReadManifest, in a file named as the archives less
+	// ".<n>.gz" with ".manifest.json" added. It is rewritten after
+	// each rotation, recording for the new archive the range of the
+	// log's data it holds, the times of its first and last lines if
+	// Timestamp is set, its SHA-256 checksum, codec and when it was
+	// written. Entries of archives since deleted or replaced are
+	// dropped.
+	Manifest bool
+
+	// PurgeOnFull selects deleting archives, oldest first, when
+	// writing to the log file or rotating it fails because the file
+	// system is full, retrying after each deletion. Otherwise the
+	// error is returned and, as with any error from Write, the
+	// Writer fails from then on.
+	PurgeOnFull bool
+
+	// PurgeKeep is the number of most recent archives which
+	// PurgeOnFull never deletes.
+	PurgeKeep int
+
+	// Delimiter, if non-empty, is the byte sequence which ends each
+	// record, such as "\x00" or "\r\n", in place of the newline.
+	// Log files are then only split just after a Delimiter, and
+	// where the comment for Open refers to newlines, Delimiter
+	// applies instead.
+	Delimiter []byte
+
+	// Raw selects raw mode, for binary or already framed data, in
+	// which there are no records to keep whole: the log file is
+	// rotated exactly when the next byte written would make it
+	// exceed maxSize. Delimiter and CRLF are ignored.
+	Raw bool
+
+	// MaxLineBytes, if greater than zero, limits the length of a
+	// record, not counting its delimiter. Since log files are only
+	// split at newlines, a runaway line would otherwise make the log
+	// file grow without limit. A longer record is ended after
+	// MaxLineBytes bytes by writing LineMarker and the delimiter,
+	// and the rest of it is written as a new record. It is ignored
+	// in raw mode and if RecordStart or JSONLines is set.
+	MaxLineBytes int
+
+	// LineMarker is written at the end of each record split because
+	// of MaxLineBytes, such as " [continued]".
+	LineMarker []byte
+
+	// CRLF selects "\r\n" as the Delimiter, for logs with Windows
+	// line endings, so that a file is never split between the '\r'
+	// and the '\n'. It is ignored if Delimiter is set.
+	CRLF bool
+
+	// RecordStart, if non-nil, groups lines into records, such as a
+	// log message followed by a stack trace, which are never split
+	// between files. It is passed the start of a line, without its
+	// delimiter, and reports whether the line begins a new record.
+	// Files are then only split before such a line. A regular
+	// expression's Match method may be used. RecordStart is ignored
+	// in raw mode.
+	RecordStart func(line []byte) bool
+
+	// Timestamp, if non-nil, returns the time of a line, without
+	// its newline, reporting whether it has one. It is used only by
+	// Reader.SeekToTime, to find where in a file to start, by
+	// GrepWithOptions, to check lines against a TimeRange, and to
+	// record the times of the first and last lines of each archive
+	// in the Manifest.
+	Timestamp func(line []byte) (time.Time, bool)
+
+	// Redact, if non-nil, filters each record before it is written,
+	// so that data such as card numbers or tokens can be masked
+	// before it reaches the disk. It is passed each record in p,
+	// less its delimiter, and its result is written in place of the
+	// record. It must not modify or retain the record, nor add a
+	// delimiter. Each call to Write is taken to begin at the start of
+	// a record, so a record written by several calls is filtered in
+	// parts. In raw mode p is filtered whole. RedactRegexp makes a
+	// Redact function from a regular expression.
+	Redact func(record []byte) []byte
+
+	// TimestampFormat, if not empty, has each line prefixed with the
+	// time it is written, in this layout, such as time.RFC3339Nano,
+	// and a space, for programs whose output has no times of its
+	// own. A line written by several calls to Write is stamped once,
+	// by the call which starts it, so Write need not be given whole
+	// lines. Lines are stamped after Redact is applied. It is ignored
+	// in raw and JSON Lines modes and if RecordStart is set, as the
+	// stamps would hide where records start.
+	TimestampFormat string
+
+	// SuppressRepeats selects collapsing a run of identical lines
+	// into the first of them followed by a line such as "last
+	// message repeated 5 times", as syslog does, before the data is
+	// counted towards maxSize. The count is written when a different
+	// line is written, or on Close. Only lines written whole by a
+	// single call to Write are compared. Lines are compared before
+	// TimestampFormat is applied. It is ignored in the same modes as
+	// TimestampFormat.
+	SuppressRepeats bool
+
+	// Header, if not empty, is written as a line at the top of each
+	// new log file, when it is created and after every rotation, so
+	// that each archive describes where it came from. It is a
+	// template in which $host or ${host} is replaced by the host
+	// name, $pid by the process ID, $start by the time the file was
+	// started in RFC 3339 format, $prev by the name of the archive
+	// holding the data before it, or nothing if there is none, and
+	// $path by the log file's path. Other variables are replaced by
+	// nothing. The header counts towards maxSize. It is ignored in
+	// raw mode, and in JSON Lines mode it should be a JSON object.
+	//
+	//	Header: "# $host pid $pid started $start after $prev",
+	Header string
+
+	// Footer, if not empty, is added as a line at the end of the
+	// data of each archive, so that an archive can be seen to be
+	// complete rather than cut short. It is a template like Header,
+	// in which $end is replaced by the time of the rotation in RFC
+	// 3339 format, $archive by the name of the archive and $next by
+	// the path of the log file, in which the data goes on. It is
+	// ignored in raw mode, and in JSON Lines mode it should be a
+	// JSON object.
+	//
+	//	Footer: "# rotated at $end, continued in $next",
+	Footer string
+
+	// JSONLines selects JSON Lines mode, for logs in which each line
+	// holds a JSON object. The log file is only split just after a
+	// line which is a complete JSON object, so that each archive can
+	// be parsed on its own. It is ignored in raw mode.
+	JSONLines bool
+
+	// MalformedJSON selects what Write does in JSON Lines mode with
+	// a line which is not a JSON object. Each line is checked in the
+	// call to Write which ends it, taking p to begin at the start of
+	// a line, as it does when each call writes whole lines.
+	MalformedJSON Malformed
+
+	// ArchivePerm, if non-zero, is the permissions of new archives,
+	// such as 0400, in place of the permissions of the log file.
+	ArchivePerm os.FileMode
+
+	// ExactPerm selects setting the permissions of the log file, the
+	// staging file and each archive with chmod, so that they are
+	// exactly as requested rather than masked by the umask. The log
+	// file's permissions are set even if it already exists.
+	ExactPerm bool
+
+	// Chown selects setting the owner and group of the log file, the
+	// staging file and each archive to Owner and Group, either of
+	// which may be -1 to leave it unchanged. It normally requires
+	// the process to run as root and is ignored on Windows and
+	// Plan 9.
+	Chown bool
+	Owner int
+	Group int
+
+	// Encrypter, if non-nil, encrypts each new archive as it is
+	// written, so that the rotated data is only stored encrypted.
+	// The archive names gain the Encrypter's extension, as in
+	// <path>.1.gz.age, and archives without it are ignored.
+	// VerifyArchive is ignored and, as the archives cannot be read,
+	// recovery from an interrupted rotation decides whether archive
+	// 1 holds the staged data from the files' modification times.
+	Encrypter Encrypter
+
+	// Archiver, if non-nil, is passed each new archive once it has
+	// been written, including any archive left unfinished by an
+	// earlier process and completed by OpenWithOptions. It is passed
+	// a hidden hard link to the archive, or a copy if links are not
+	// supported, so later rotations may rename or delete the archive
+	// while it is sent. Close waits for the archives being sent.
+	Archiver Archiver
+
+	// ArchiveTimeout is the longest Close waits for the archives
+	// being sent to Archiver, and for any retry in progress, before
+	// cancelling the context passed to Archive and waiting for it to
+	// return. An archive whose sending is cancelled is kept in the
+	// pending directory to be sent when the Writer is next opened if
+	// RetryArchives is set, and otherwise stays only among the local
+	// archives. Zero means one minute, and a negative value cancels
+	// at once.
+	ArchiveTimeout time.Duration
+
+	// ArchiveConcurrency is the maximum number of archives passed to
+	// Archiver at once. Zero means 1.
+	ArchiveConcurrency int
+
+	// RemoveArchived selects removing local archives once Archiver
+	// has sent them without error, except for the newest KeepLocal.
+	// Archives are removed oldest first, at the next rotation or
+	// Close, and an archive is kept while an older one has not been
+	// sent. maxFiles still limits the number of archives kept.
+	RemoveArchived bool
+	KeepLocal      int
+
+	// RetryArchives selects keeping each archive which Archiver fails
+	// to send in the directory <path>.pending, or its equivalent in
+	// ArchiveDir, and retrying it in the background with a delay
+	// which starts at one second and doubles with each failure up to
+	// RetryMaxDelay, which defaults to ten minutes. The directory
+	// survives restarts: archives left in it are retried once the
+	// Writer is opened.
+	RetryArchives bool
+	RetryMaxDelay time.Duration
+
+	// OnArchiveError, if non-nil, is called with each error sending
+	// an archive, from the goroutine which sent it. Errors do not
+	// affect writing or rotation.
+	OnArchiveError func(error)
+
+	// Clock, if non-nil, is used in place of the system clock for
+	// all timing, including rotation times, archive time ranges,
+	// ReopenInterval, FallbackRetry, SyncInterval, IdleClose and the
+	// delays of RetryArchives. Setting it to DefaultScheduler, or
+	// another Scheduler, shares one timer among many Writers.
+	Clock Clock
+
+	// FS, if non-nil, is used in place of the operating system's
+	// file system for the log file, archives and every other file
+	// the Writer uses. The paths passed to an Archiver are then
+	// paths on FS.
+	FS FS
+
+	// Fault, if non-nil, is called before each operation of the
+	// kinds listed with FaultOp, with the name of the file
+	// concerned. If it returns an error the operation is not done
+	// and fails with that error, so that tests can check the
+	// handling of partial failures such as a rename failing while
+	// the archives are shifted. The error of a failed rename or
+	// write is wrapped as os would, so injecting syscall.EXDEV or
+	// syscall.ENOSPC has the effect of the real error.
+	Fault func(op FaultOp, name string) error
+
+	// OnRotate, if non-nil, is called after every rotation attempt
+	// with a description of the rotation. It is called from within
+	// Write, possibly with the Writer's lock held, so it must not
+	// call methods of the Writer. Calls are never concurrent. When
+	// BackgroundCompress is set the rotation it describes is the part
+	// performed during Write.
+	OnRotate func(Rotation)
+
+	// OnRotateContext, if non-nil, is called as OnRotate is, after it
+	// if both are set, with the context passed to the WriteContext or
+	// WriteBatchContext call which made the rotation, so that the
+	// rotation can be traced as part of that call. Other rotations,
+	// including those in asynchronous mode, are passed
+	// context.Background().
+	OnRotateContext func(ctx context.Context, r Rotation)
+
+	// Logger, if non-nil, receives diagnostics of what the Writer
+	// does, such as rotations, deleted archives and switches to and
+	// from FallbackPath, and of errors, which are never written to
+	// the log file itself. It must not write to the Writer.
+	Logger *slog.Logger
+
+	// HistorySize is the number of the most recent rotations
+	// returned by Writer.History. If zero, 16 are kept, and if
+	// negative, none.
+	HistorySize int
+
+	// EventBuffer is the number of Events the channel returned by
+	// Writer.Events holds before further events are discarded. If
+	// zero or less, 64 is used.
+	EventBuffer int
+}
+
+// Overflow is a policy for a full queue in asynchronous mode.
+type Overflow int
+
+const (
+	// Block makes Write wait for space in the queue, or until the
+	// rate limit lets p through.
+	Block Overflow = iota
+	// DropNewest makes Write discard p, counting it in
+	// Stats.Dropped, or Stats.RateDropped for the rate limit, and
+	// return len(p) and a nil error.
+	DropNewest
+	// DropOldest makes Write discard the oldest data in the queue,
+	// as many times as needed, counting each in Stats.Dropped, so
+	// that the queue is a ring holding the most recent writes and
+	// Write never blocks. For the rate limit it is DropNewest, as
+	// data let through is already written.
+	DropOldest
+)
+
+// Rotation describes a single rotation performed by a Writer.
+type Rotation struct {
+	Start    time.Time     // time the rotation started
+	Duration time.Duration // time taken by the rotation
+	Bytes    int64         // bytes moved out of the log file
+	Archive  string        // archive written, or "" if maxFiles is 1
+	Err      error         // non-nil if the rotation failed
+
+	ctx context.Context // context of the call which rotated, or nil
+}
@@ -0,0 +1,174 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package otellogrot instruments logrot writers with OpenTelemetry.
+//
+// Each rotation is recorded as a span named "logrot.rotate" and each
+// write updates the metrics logrot.write.bytes, logrot.write.duration
+// and logrot.rotations. When writes are made with WriteContext or
+// WriteBatchContext, the rotation span is a child of the span in the
+// supplied context, so a request that was stalled by a rotation shows
+// the pause in its trace. Rotations made by Rotate, by Close or, in
+// asynchronous mode, by the background goroutine have no parent.
+package otellogrot // import "xi2.org/x/logrot/otellogrot"
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"xi2.org/x/logrot"
+)
+
+const instrumentationName = "xi2.org/x/logrot/otellogrot"
+
+// Config holds the providers used by Open. A nil field selects the
+// corresponding global provider.
+type Config struct {
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+}
+
+// Writer is an instrumented logrot.Writer.
+type Writer struct {
+	*logrot.Writer
+	tracer    trace.Tracer
+	attrs     attribute.Set
+	bytes     metric.Int64Counter
+	duration  metric.Float64Histogram
+	rotations metric.Int64Counter
+}
+
+// Open is like logrot.OpenWithOptions but returns a Writer reporting
+// to the providers in cfg. A nil cfg is equivalent to a zero Config.
+// Any OnRotate or OnRotateContext function in opts is still called.
+func Open(path string, perm os.FileMode, maxSize int64, maxFiles int, opts *logrot.Options, cfg *Config) (*Writer, error) {
+	var c Config
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.TracerProvider == nil {
+		c.TracerProvider = otel.GetTracerProvider()
+	}
+	if c.MeterProvider == nil {
+		c.MeterProvider = otel.GetMeterProvider()
+	}
+	meter := c.MeterProvider.Meter(instrumentationName)
+	w := &Writer{
+		tracer: c.TracerProvider.Tracer(instrumentationName),
+		attrs:  attribute.NewSet(attribute.String("logrot.path", path)),
+	}
+	var err error
+	w.bytes, err = meter.Int64Counter("logrot.write.bytes",
+		metric.WithUnit("By"),
+		metric.WithDescription("Bytes written to the log file."))
+	if err != nil {
+		return nil, err
+	}
+	w.duration, err = meter.Float64Histogram("logrot.write.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of calls to Write, including rotations."))
+	if err != nil {
+		return nil, err
+	}
+	w.rotations, err = meter.Int64Counter("logrot.rotations",
+		metric.WithDescription("Rotations performed."))
+	if err != nil {
+		return nil, err
+	}
+	var o logrot.Options
+	if opts != nil {
+		o = *opts
+	}
+	onRotate := o.OnRotateContext
+	o.OnRotateContext = func(ctx context.Context, r logrot.Rotation) {
+		w.rotated(ctx, r)
+		if onRotate != nil {
+			onRotate(ctx, r)
+		}
+	}
+	w.Writer, err = logrot.OpenWithOptions(path, perm, maxSize, maxFiles, &o)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// rotated records r, made by the call with context ctx, as a span and
+// updates the rotation counter.
+func (w *Writer) rotated(ctx context.Context, r logrot.Rotation) {
+	_, span := w.tracer.Start(ctx, "logrot.rotate",
+		trace.WithTimestamp(r.Start),
+		trace.WithAttributes(w.attrs.ToSlice()...),
+		trace.WithAttributes(
+			attribute.Int64("logrot.rotate.bytes", r.Bytes),
+			attribute.String("logrot.rotate.archive", r.Archive)))
+	if r.Err != nil {
+		span.RecordError(r.Err)
+		span.SetStatus(codes.Error, r.Err.Error())
+	}
+	span.End(trace.WithTimestamp(r.Start.Add(r.Duration)))
+	w.rotations.Add(ctx, 1, metric.WithAttributeSet(w.attrs))
+}
+
+// Write is equivalent to WriteContext(context.Background(), p).
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.WriteContext(context.Background(), p)
+}
+
+// WriteContext writes p to the log file. If the write causes a
+// rotation, the rotation span is started as a child of any span in
+// ctx.
+func (w *Writer) WriteContext(ctx context.Context, p []byte) (int, error) {
+	start := time.Now()
+	n, err := w.Writer.WriteContext(ctx, p)
+	w.recordWrite(ctx, start, n)
+	return n, err
+}
+
+// WriteBatch is equivalent to WriteBatchContext(context.Background(),
+// lines).
+func (w *Writer) WriteBatch(lines [][]byte) (int, error) {
+	return w.WriteBatchContext(context.Background(), lines)
+}
+
+// WriteBatchContext writes lines to the log file as
+// logrot.Writer.WriteBatchContext does, recording it as WriteContext
+// does.
+func (w *Writer) WriteBatchContext(ctx context.Context, lines [][]byte) (int, error) {
+	start := time.Now()
+	n, err := w.Writer.WriteBatchContext(ctx, lines)
+	w.recordWrite(ctx, start, n)
+	return n, err
+}
+
+// recordWrite updates the write metrics for n bytes written by a call
+// begun at start.
+func (w *Writer) recordWrite(ctx context.Context, start time.Time, n int) {
+	w.duration.Record(ctx, time.Since(start).Seconds(),
+		metric.WithAttributeSet(w.attrs))
+	w.bytes.Add(ctx, int64(n), metric.WithAttributeSet(w.attrs))
+}
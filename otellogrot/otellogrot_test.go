@@ -0,0 +1,92 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package otellogrot
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric/noop"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestConcurrentParents checks that concurrent calls to WriteContext
+// each get the rotation spans they cause as children of their own
+// span. With maxSize 1, once the log file holds a line every write
+// rotates it away before writing its own, so each call makes exactly
+// one rotation.
+func TestConcurrentParents(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	w, err := Open(filepath.Join(t.TempDir(), "log"), 0644, 1, 2, nil,
+		&Config{TracerProvider: tp, MeterProvider: noop.NewMeterProvider()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	const writers, writes = 8, 20
+	parents := make(map[trace.SpanID]int) // rotations by each parent
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+		parents[span.SpanContext().SpanID()] = 0
+		line := []byte(strings.Repeat("x", i+1) + "\n")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer span.End()
+			for j := 0; j < writes; j++ {
+				if _, err := w.WriteContext(ctx, line); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range sr.Ended() {
+		if s.Name() != "logrot.rotate" {
+			continue
+		}
+		id := s.Parent().SpanID()
+		if _, ok := parents[id]; !ok {
+			t.Errorf("rotation with parent %v, not a writer's span", id)
+			continue
+		}
+		parents[id]++
+	}
+	for id, n := range parents {
+		if n != writes {
+			t.Errorf("writer with span %v has %d rotations, want %d", id, n, writes)
+		}
+	}
+}
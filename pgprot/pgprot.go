@@ -0,0 +1,91 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package pgprot encrypts the archives made by logrot writers to
+// OpenPGP public keys, for log escrow based on PGP. Archives are
+// named <path>.<n>.gz.gpg and can be read with
+//
+//	gpg -d app.log.1.gz.gpg | gunzip
+//
+// The encryption is streamed, so archives of any size are encrypted
+// without being held in memory. For example:
+//
+//	e, err := pgprot.NewFromFile("/etc/app/escrow.asc")
+//	if err != nil {
+//		panic(err)
+//	}
+//	w, err := logrot.OpenWithOptions("app.log", 0600, 10<<20, 5,
+//		&logrot.Options{Encrypter: e})
+package pgprot // import "xi2.org/x/logrot/pgprot"
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"xi2.org/x/logrot"
+)
+
+// Encrypter encrypts archives to a set of OpenPGP keys.
+type Encrypter struct {
+	to []*openpgp.Entity
+}
+
+var _ logrot.Encrypter = (*Encrypter)(nil)
+
+// New returns an Encrypter encrypting to the keys given.
+func New(keys openpgp.EntityList) (*Encrypter, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("pgprot: no keys")
+	}
+	return &Encrypter{to: keys}, nil
+}
+
+// NewFromFile returns an Encrypter encrypting to the public keys in
+// the file name, which may be ASCII armored or binary.
+func NewFromFile(name string) (*Encrypter, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var keys openpgp.EntityList
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		keys, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	} else {
+		keys, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return New(keys)
+}
+
+// Encrypt implements logrot.Encrypter.
+func (e *Encrypter) Encrypt(w io.Writer) (io.WriteCloser, error) {
+	return openpgp.Encrypt(w, e.to, nil, &openpgp.FileHints{IsBinary: true}, nil)
+}
+
+// Ext returns ".gpg".
+func (e *Encrypter) Ext() string {
+	return ".gpg"
+}
@@ -0,0 +1,70 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// copyBufSize is the size of the buffers in copyBufs.
+const copyBufSize = 32 << 10
+
+// maxPooledQueueBuf is the largest buffer that is returned to
+// queueBufs for reuse.
+const maxPooledQueueBuf = 64 << 10
+
+var (
+	// gzipWriters holds *gzip.Writer values for reuse by compress.
+	gzipWriters = sync.Pool{
+		New: func() interface{} { return gzip.NewWriter(nil) },
+	}
+	// copyBufs holds *[]byte values of length copyBufSize used when
+	// copying and scanning files.
+	copyBufs = sync.Pool{
+		New: func() interface{} {
+			b := make([]byte, copyBufSize)
+			return &b
+		},
+	}
+	// queueBufs holds *[]byte values used to hold copies of the data
+	// passed to Write in asynchronous mode and by WriteBatch.
+	queueBufs = sync.Pool{
+		New: func() interface{} { return new([]byte) },
+	}
+)
+
+// copyBuffer is like io.Copy but uses a buffer from copyBufs.
+func copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	bp := copyBufs.Get().(*[]byte)
+	defer copyBufs.Put(bp)
+	return io.CopyBuffer(dst, src, *bp)
+}
+
+// putQueueBuf returns bp to queueBufs unless it has grown too large.
+func putQueueBuf(bp *[]byte) {
+	if cap(*bp) <= maxPooledQueueBuf {
+		*bp = (*bp)[:0]
+		queueBufs.Put(bp)
+	}
+}
@@ -0,0 +1,47 @@
+//go:build linux
+
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize is FALLOC_FL_KEEP_SIZE from <linux/falloc.h>.
+const fallocKeepSize = 0x1
+
+// preallocate reserves space for maxSize bytes of log file without
+// changing its size.
+func (wc *Writer) preallocate() error {
+	f, ok := wc.file.(*os.File)
+	if !ok || wc.size >= wc.maxSize {
+		return nil
+	}
+	err := syscall.Fallocate(int(f.Fd()), fallocKeepSize,
+		wc.size, wc.maxSize-wc.size)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import "log/slog"
+
+// purge deletes the oldest archive if PurgeOnFull is set, err is from
+// the file system being full and more than PurgeKeep archives
+// remain. It reports whether an archive was deleted, in which case
+// the operation that failed with err may be retried. The rotation
+// lock must be held.
+func (wc *Writer) purge(err error) bool {
+	if !wc.opts.PurgeOnFull || !isNoSpace(err) {
+		return false
+	}
+	n, e := wc.lastArchive()
+	if e != nil || n <= wc.opts.PurgeKeep {
+		return false
+	}
+	wc.diag(slog.LevelWarn, "logrot: file system full, deleting oldest archive",
+		"error", err)
+	if wc.removeArchive(wc.archiveName(n)) != nil {
+		return false
+	}
+	wc.archives = n - 1
+	return true
+}
+
+// purgeForWrite is like purge but takes the rotation lock itself, for
+// use when writing to the log file.
+func (wc *Writer) purgeForWrite(err error) bool {
+	if !wc.opts.PurgeOnFull || !isNoSpace(err) {
+		return false
+	}
+	defer wc.unlockRotation()
+	if e := wc.lockRotation(); e != nil {
+		// keep the error for the next rotation
+		wc.bgErr = e
+		return false
+	}
+	return wc.purge(err)
+}
@@ -0,0 +1,130 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// quotaState is the day's use of Options.DailyQuota.
+type quotaState struct {
+	mu      sync.Mutex
+	day     time.Time // midnight starting the day counted
+	used    int64     // bytes written on day
+	reached bool      // the quota has been used up
+	lines   int64     // lines dropped since last reported
+	bytes   int64     // bytes dropped since last reported
+}
+
+// applyQuota returns p less the lines which exceed Options.DailyQuota
+// and are not kept by Options.QuotaKeep. When the quota is first used
+// up a line saying so is put before them, and when the day is over a
+// line reporting what was dropped is put before the next day's data.
+// If p continues a line begun by an earlier write, that line is ended
+// before either is put in. wc.mu must be held.
+func (wc *Writer) applyQuota(p []byte) []byte {
+	q := wc.quota
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := wc.clock.Now()
+	y, m, d := now.Date()
+	mid := wc.midLine
+	var out []byte
+	if day := time.Date(y, m, d, 0, 0, 0, 0, now.Location()); !day.Equal(q.day) {
+		if report := q.report(wc); report != nil {
+			if mid {
+				out = wc.lineBreak()
+				mid = false
+			}
+			out = append(out, report...)
+		}
+		q.day = day
+		q.used = 0
+		q.reached = false
+	}
+	if !q.reached && q.used+int64(len(p)) <= wc.opts.DailyQuota {
+		q.used += int64(len(p))
+		if out == nil {
+			return p
+		}
+		return append(out, p...)
+	}
+	for len(p) > 0 {
+		line := p
+		if i := bytes.Index(p, wc.delim); i != -1 && len(wc.delim) > 0 {
+			line = p[:i+len(wc.delim)]
+		}
+		p = p[len(line):]
+		if !q.reached && q.used+int64(len(line)) <= wc.opts.DailyQuota {
+			q.used += int64(len(line))
+			out = append(out, line...)
+			mid = false
+			continue
+		}
+		if !q.reached {
+			q.reached = true
+			if mid {
+				out = append(out, wc.lineBreak()...)
+				mid = false
+			}
+			out = append(out, wc.record(
+				"logrot: daily quota of %d bytes used up, dropping lines until midnight",
+				wc.opts.DailyQuota)...)
+		}
+		if wc.opts.QuotaKeep != nil &&
+			wc.opts.QuotaKeep(bytes.TrimSuffix(line, wc.delim)) {
+			q.used += int64(len(line))
+			out = append(out, line...)
+			mid = false
+			continue
+		}
+		if mid {
+			// end the line whose rest is dropped
+			out = append(out, wc.lineBreak()...)
+			mid = false
+		}
+		q.lines++
+		q.bytes += int64(len(line))
+	}
+	return out
+}
+
+// report returns the line reporting the data dropped since the last
+// report, or nil if there is none. q.mu must be held.
+func (q *quotaState) report(wc *Writer) []byte {
+	if q.lines == 0 {
+		return nil
+	}
+	report := wc.record("logrot: %d lines (%d bytes) dropped by the daily quota",
+		q.lines, q.bytes)
+	q.lines, q.bytes = 0, 0
+	return report
+}
+
+// quotaReport is report for Close.
+func (wc *Writer) quotaReport() []byte {
+	wc.quota.mu.Lock()
+	defer wc.quota.mu.Unlock()
+	return wc.quota.report(wc)
+}
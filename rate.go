@@ -0,0 +1,139 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateReportInterval is the least time between the lines reporting
+// data dropped by the rate limit.
+const rateReportInterval = time.Second
+
+// rateLimiter is the token bucket of Options.RateLimit.
+type rateLimiter struct {
+	rate   float64 // tokens added a second
+	burst  float64 // capacity of the bucket
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time // when tokens was last topped up
+
+	// lines and bytes dropped since last reported, guarded by mu
+	lines    int64
+	bytes    int64
+	reported time.Time
+}
+
+// newRateLimiter returns the rateLimiter for opts, starting full at
+// time now, or nil if there is no limit.
+func newRateLimiter(opts *Options, now time.Time) *rateLimiter {
+	if opts.RateLimit <= 0 {
+		return nil
+	}
+	burst := opts.RateBurst
+	if burst <= 0 {
+		burst = opts.RateLimit
+	}
+	return &rateLimiter{
+		rate:     opts.RateLimit,
+		burst:    burst,
+		tokens:   burst,
+		last:     now,
+		reported: now,
+	}
+}
+
+// reserve takes cost tokens from the bucket at time now if it holds
+// enough, or all it can hold if cost is more, returning zero, or
+// otherwise returns how long to wait until it does. The bucket may be
+// left in debt by a cost greater than it can hold.
+func (l *rateLimiter) reserve(now time.Time, cost float64) time.Duration {
+	if now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+	}
+	need := cost
+	if need > l.burst {
+		need = l.burst
+	}
+	if l.tokens >= need {
+		l.tokens -= cost
+		return 0
+	}
+	return time.Duration((need-l.tokens)/l.rate*float64(time.Second)) + 1
+}
+
+// limitRate applies Options.RateLimit to p, waiting until it may be
+// written, or dropping it with DropNewest, and reports whether it
+// may be written. A call counts as at least one line.
+func (wc *Writer) limitRate(p []byte) bool {
+	l := wc.rate
+	lines := int64(1)
+	if len(wc.delim) > 0 {
+		if n := bytes.Count(p, wc.delim); n > 1 {
+			lines = int64(n)
+		}
+	}
+	cost := float64(len(p))
+	if wc.opts.RateLines {
+		cost = float64(lines)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for {
+		d := l.reserve(wc.clock.Now(), cost)
+		if d == 0 {
+			return true
+		}
+		if wc.opts.RateOverflow != Block {
+			l.lines += lines
+			l.bytes += int64(len(p))
+			atomic.AddInt64(&wc.rateDropped, 1)
+			return false
+		}
+		wc.sleep(d, nil)
+	}
+}
+
+// dropReport returns the line reporting the data dropped by the rate
+// limit since the last report, or nil if there is none or, unless
+// force is set, the last report was too recent.
+func (wc *Writer) dropReport(force bool) []byte {
+	l := wc.rate
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := wc.clock.Now()
+	if l.lines == 0 || !force && now.Sub(l.reported) < rateReportInterval {
+		return nil
+	}
+	report := wc.record("logrot: %d lines (%d bytes) dropped by the rate limit",
+		l.lines, l.bytes)
+	l.lines, l.bytes = 0, 0
+	l.reported = now
+	return report
+}
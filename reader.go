@@ -0,0 +1,284 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// OpenReader returns a reader of the whole history of the log file at
+// path: the decompressed contents of <path>.<N>.gz down to
+// <path>.1.gz, followed by the contents of the log file. The files are
+// all opened by OpenReader, so rotations while the reader is in use do
+// not disturb the archives read, but as a rotation empties the log file
+// in place, the data read from it may then stop short. Close closes the
+// files. It fails if there is neither a log file nor an archive.
+func OpenReader(path string) (*Reader, error) {
+	return OpenReaderWithOptions(path, nil)
+}
+
+// OpenReaderWithOptions is like OpenReader but reads the archives in
+// opts.ArchiveDir, if set, through opts.FS, if set, and has
+// SeekToTime use opts.Timestamp, if set. If opts.Manifest is set,
+// SeekToTime takes an archive to have been complete at the time of its
+// last line recorded in the manifest, rather than when it was written,
+// so that it skips the archive holding no line at or after the time
+// sought without reading it. If opts.CompressLive is set, the log
+// file is decompressed. The other options are ignored, except that it
+// fails if opts.Encrypter is set, as the archives cannot be
+// decrypted.
+func OpenReaderWithOptions(path string, opts *Options) (*Reader, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Encrypter != nil {
+		return nil, errors.New("logrot: archives are encrypted")
+	}
+	fsys := o.FS
+	if fsys == nil {
+		fsys = osFS{}
+	}
+	base := archiveBase(path, o.ArchiveDir)
+	n := 0
+	for {
+		_, err := fsys.Lstat(fmt.Sprintf("%s.%d.gz", base, n+1))
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		n++
+	}
+	entries := make(map[string]ManifestEntry)
+	if o.Manifest {
+		m, err := readManifest(fsys, manifestName(path, o.ArchiveDir))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range m.Archives {
+			entries[e.Archive] = e
+		}
+	}
+	r := &Reader{timestamp: o.Timestamp}
+	for ; n > 0; n-- {
+		name := fmt.Sprintf("%s.%d.gz", base, n)
+		f, err := open(fsys, name)
+		if os.IsNotExist(err) {
+			// removed by a rotation since counted
+			continue
+		}
+		if err != nil {
+			_ = r.Close()
+			return nil, err
+		}
+		r.files = append(r.files, f)
+		fi, err := f.Stat()
+		if err != nil {
+			_ = r.Close()
+			return nil, err
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			_ = r.Close()
+			return nil, fmt.Errorf("logrot: %s: %v", name, err)
+		}
+		modTime := fi.ModTime()
+		if e, ok := entries[name]; ok && e.Last != nil && e.Size == fi.Size() {
+			modTime = *e.Last
+		}
+		r.parts = append(r.parts,
+			readerPart{r: zr, name: name, modTime: modTime})
+	}
+	f, err := open(fsys, path)
+	if err != nil && (!os.IsNotExist(err) || len(r.files) == 0) {
+		// only a missing log file with archives is expected
+		_ = r.Close()
+		return nil, err
+	}
+	if err == nil {
+		r.files = append(r.files, f)
+		// the log file is never skipped by SeekToTime
+		var lr io.Reader = f
+		if o.CompressLive {
+			lr = &liveReader{f: f}
+		}
+		r.parts = append(r.parts, readerPart{r: lr, name: path})
+	}
+	return r, nil
+}
+
+// archiveBase returns the name of the archives of the log file path,
+// less ".<n>.gz", when they are kept in archiveDir, or beside it if
+// archiveDir is empty.
+func archiveBase(path, archiveDir string) string {
+	if archiveDir == "" {
+		return path
+	}
+	return filepath.Join(archiveDir, filepath.Base(path))
+}
+
+// Reader reads the history of a log file, as returned by OpenReader.
+type Reader struct {
+	files     []File
+	parts     []readerPart // still to be read
+	timestamp func(line []byte) (time.Time, bool)
+}
+
+// readerPart is the data of one file read by a Reader.
+type readerPart struct {
+	r       io.Reader
+	name    string
+	modTime time.Time // when an archive was complete, zero for the log file
+}
+
+// Read reads the data of each file in turn.
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.parts) > 0 {
+		n, err := r.parts[0].r.Read(p)
+		if err == io.EOF {
+			r.parts = r.parts[1:]
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+	return 0, io.EOF
+}
+
+// SeekToTime skips the data not yet read which was written before t,
+// so that an investigation of an incident need not decompress the
+// whole history. An archive was complete when it was written, so the
+// archives written before t are skipped without being read, and
+// reading goes on from the start of the next file. If
+// Options.Timestamp was set, the lines of that file and any after it
+// are then read and skipped until one has a time no earlier than t,
+// from which reading goes on. Lines for which Timestamp finds no time,
+// such as the continuation of a record, are skipped with the line
+// before them.
+func (r *Reader) SeekToTime(t time.Time) error {
+	for len(r.parts) > 0 && !r.parts[0].modTime.IsZero() &&
+		r.parts[0].modTime.Before(t) {
+		r.parts = r.parts[1:]
+	}
+	if r.timestamp == nil {
+		return nil
+	}
+	for len(r.parts) > 0 {
+		br := bufio.NewReader(r.parts[0].r)
+		for {
+			line, err := br.ReadBytes('\n')
+			if len(line) > 0 {
+				ts, ok := r.timestamp(bytes.TrimSuffix(line, []byte("\n")))
+				if ok && !ts.Before(t) {
+					r.parts[0].r = io.MultiReader(bytes.NewReader(line), br)
+					return nil
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		r.parts = r.parts[1:]
+	}
+	return nil
+}
+
+// LimitLog limits the data read from the log file, as opposed to the
+// archives, to its first n bytes, so that a Reader used with a
+// Follower which started at offset n reads nothing twice.
+func (r *Reader) LimitLog(n int64) {
+	if i := len(r.parts) - 1; i >= 0 && r.parts[i].modTime.IsZero() {
+		r.parts[i].r = io.LimitReader(r.parts[i].r, n)
+	}
+}
+
+// Tail returns the last n lines of the data not yet read, leaving
+// nothing more to read. The lines are taken from the files newest
+// first, so that only as many archives are decompressed as hold
+// them. A final line without a newline counts as a line.
+func (r *Reader) Tail(n int) ([]byte, error) {
+	var out [][]byte
+	for i := len(r.parts) - 1; i >= 0 && len(out) < n; i-- {
+		lines, err := lastLines(r.parts[i].r, n-len(out))
+		if err != nil {
+			return nil, err
+		}
+		out = append(lines, out...)
+	}
+	r.parts = nil
+	return bytes.Join(out, nil), nil
+}
+
+// lastLines returns the last n or fewer lines read from r.
+func lastLines(r io.Reader, n int) ([][]byte, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	ring := make([][]byte, n)
+	total := 0
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			ring[total%n] = line
+			total++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if total <= n {
+		return ring[:total], nil
+	}
+	i := total % n
+	return append(ring[i:], ring[:i]...), nil
+}
+
+// Close closes the files.
+func (r *Reader) Close() error {
+	var err error
+	for _, f := range r.files {
+		if e := f.Close(); err == nil {
+			err = e
+		}
+	}
+	r.files = nil
+	r.parts = nil
+	return err
+}
@@ -0,0 +1,248 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// repairArchives undoes the damage an interrupted rotation may have
+// left behind, so that later rotations do not build on a broken chain
+// of archives. It removes leftover temporary files, renumbers the
+// archives to close any gaps and checks that archive 1 is a complete
+// gzip file. A damaged archive 1 is removed if its contents are still
+// in the staging file and is otherwise renamed with a ".corrupt"
+// suffix. If archive 1 holds exactly the contents of the staging file
+// then the rotation had finished but for removing the staging file,
+// which is done now. The rotation lock must be held.
+func (wc *Writer) repairArchives() error {
+	first := wc.archiveName(1)
+	for _, tmp := range []string{wc.path + ".1.gz.tmp", first + ".tmp"} {
+		err := wc.fs.Remove(tmp)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	err := wc.renumberArchives()
+	if err != nil {
+		return err
+	}
+	staged := true
+	if _, err := wc.fs.Lstat(wc.stagingName()); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		staged = false
+	}
+	var state int
+	if wc.opts.Encrypter != nil {
+		state, err = checkEncrypted(wc.fs, first, wc.stagingName(), staged)
+	} else {
+		state, err = checkArchive(wc.fs, first, wc.stagingName(), staged)
+	}
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return err
+	case state == archiveCorrupt && staged:
+		err = wc.removeArchive(first)
+	case state == archiveCorrupt:
+		err = wc.quarantine(first)
+	case state == archiveStaged:
+		return wc.fs.Remove(wc.stagingName())
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return wc.renumberArchives()
+}
+
+// renumberArchives renames the archives, keeping their order, so
+// that they are numbered from 1 with no gaps.
+func (wc *Writer) renumberArchives() error {
+	entries, err := wc.fs.ReadDir(filepath.Dir(wc.archiveBase))
+	if err != nil {
+		return err
+	}
+	prefix := filepath.Base(wc.archiveBase) + "."
+	var nums []int
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) ||
+			!strings.HasSuffix(name, wc.archiveExt) {
+			continue
+		}
+		s := name[len(prefix) : len(name)-len(wc.archiveExt)]
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || strconv.Itoa(n) != s {
+			continue
+		}
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	// renaming in ascending order never overwrites an archive
+	for i, n := range nums {
+		if n == i+1 {
+			continue
+		}
+		err := wc.renameArchive(wc.archiveName(n), wc.archiveName(i+1))
+		if err != nil {
+			return err
+		}
+	}
+	wc.archives = len(nums)
+	return nil
+}
+
+// Results of checkArchive.
+const (
+	archiveOK = iota
+	archiveCorrupt
+	archiveStaged
+)
+
+// checkArchive reports whether the gzip file name on fsys is
+// archiveCorrupt, or, if staged is true and it holds exactly the
+// contents of the file staging, archiveStaged. Otherwise it reports
+// archiveOK.
+func checkArchive(fsys FS, name, staging string, staged bool) (int, error) {
+	f, err := open(fsys, name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		if err == io.EOF || isCorrupt(err) {
+			return archiveCorrupt, nil
+		}
+		return 0, err
+	}
+	var same bool
+	if staged {
+		s, err := open(fsys, staging)
+		if err != nil {
+			return 0, err
+		}
+		defer s.Close()
+		same, err = sameContents(zr, s)
+		if err != nil {
+			if isCorrupt(err) {
+				return archiveCorrupt, nil
+			}
+			return 0, err
+		}
+	}
+	// read to the end so that the checksum is verified
+	_, err = copyBuffer(io.Discard, zr)
+	if err != nil {
+		if isCorrupt(err) {
+			return archiveCorrupt, nil
+		}
+		return 0, err
+	}
+	if same {
+		return archiveStaged, nil
+	}
+	return archiveOK, nil
+}
+
+// checkEncrypted is checkArchive for encrypted archives, which cannot
+// be read. An archive modified after the staging file is taken to
+// hold its contents, as the staging file is complete before
+// compression starts. With coarse timestamps the two may appear
+// simultaneous, in which case the staging file is archived again
+// rather than risk losing it.
+func checkEncrypted(fsys FS, name, staging string, staged bool) (int, error) {
+	fi, err := fsys.Stat(name)
+	if err != nil || !staged {
+		return archiveOK, err
+	}
+	sfi, err := fsys.Stat(staging)
+	if err != nil {
+		return 0, err
+	}
+	if fi.ModTime().After(sfi.ModTime()) {
+		return archiveStaged, nil
+	}
+	return archiveOK, nil
+}
+
+// isCorrupt reports whether err, returned while reading a gzip
+// stream, means that the stream is damaged or truncated.
+func isCorrupt(err error) bool {
+	switch err {
+	case io.ErrUnexpectedEOF, gzip.ErrChecksum, gzip.ErrHeader:
+		return true
+	}
+	_, ok := err.(flate.CorruptInputError)
+	return ok
+}
+
+// sameContents reports whether a and b yield the same bytes.
+func sameContents(a, b io.Reader) (bool, error) {
+	bpa := copyBufs.Get().(*[]byte)
+	defer copyBufs.Put(bpa)
+	bpb := copyBufs.Get().(*[]byte)
+	defer copyBufs.Put(bpb)
+	for {
+		na, erra := fill(a, *bpa)
+		if erra != nil && erra != io.EOF {
+			return false, erra
+		}
+		nb, errb := fill(b, *bpb)
+		if errb != nil && errb != io.EOF {
+			return false, errb
+		}
+		if na != nb || !bytes.Equal((*bpa)[:na], (*bpb)[:nb]) {
+			return false, nil
+		}
+		if erra == io.EOF || errb == io.EOF {
+			return erra == errb, nil
+		}
+	}
+}
+
+// fill reads from r until buf is full or an error occurs. Unlike
+// io.ReadFull it returns the error from r unchanged.
+func fill(r io.Reader, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,60 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// RedactRegexp returns a function for Options.Redact which replaces
+// each match of re with repl, in which $1 and so on refer to
+// submatches as for regexp.Regexp.Expand.
+//
+//	card := regexp.MustCompile(`\b(?:\d[ -]?){12,15}(\d{4})\b`)
+//	opts := &logrot.Options{
+//		Redact: logrot.RedactRegexp(card, "****-${1}"),
+//	}
+func RedactRegexp(re *regexp.Regexp, repl string) func(record []byte) []byte {
+	r := []byte(repl)
+	return func(record []byte) []byte {
+		return re.ReplaceAll(record, r)
+	}
+}
+
+// redact returns p with Options.Redact applied to each record.
+func (wc *Writer) redact(p []byte) []byte {
+	if len(wc.delim) == 0 {
+		return wc.opts.Redact(p)
+	}
+	out := make([]byte, 0, len(p))
+	for len(p) > 0 {
+		i := bytes.Index(p, wc.delim)
+		if i == -1 {
+			return append(out, wc.opts.Redact(p)...)
+		}
+		out = append(out, wc.opts.Redact(p[:i])...)
+		out = append(out, wc.delim...)
+		p = p[i+len(wc.delim):]
+	}
+	return out
+}
@@ -0,0 +1,113 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"log/slog"
+	"os"
+)
+
+// checkReopen reopens the log file if path no longer refers to it. It
+// does nothing if it was last called less than ReopenInterval ago.
+func (wc *Writer) checkReopen() error {
+	now := wc.clock.Now()
+	if now.Sub(wc.lastCheck) < wc.opts.ReopenInterval {
+		return nil
+	}
+	wc.lastCheck = now
+	return wc.checkMoved()
+}
+
+// checkMoved reopens the log file if path no longer refers to it,
+// first adopting it as an archive if AdoptRotated is set.
+func (wc *Writer) checkMoved() error {
+	fi, err := wc.fs.Stat(wc.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		cur, err := wc.file.Stat()
+		if err != nil {
+			return err
+		}
+		if sameFile(fi, cur) {
+			return nil
+		}
+	}
+	if wc.opts.AdoptRotated {
+		err = wc.adoptRotated()
+		if err != nil {
+			return err
+		}
+	}
+	return wc.reopen()
+}
+
+// reopen replaces the open log file, if any, with the file at path,
+// creating it if necessary.
+func (wc *Writer) reopen() error {
+	err := wc.makeDirs()
+	if err != nil {
+		return err
+	}
+	size, err := statLog(wc.fs, wc.path)
+	if err != nil {
+		return err
+	}
+	file, err := openLog(wc.fs, wc.path, wc.perm, wc.opts.Append)
+	if err != nil {
+		return err
+	}
+	err = wc.setAttrs(wc.path, wc.perm)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	lastNewline, err := wc.findLastSplit(file, size)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	if wc.file != nil {
+		_ = wc.file.Close()
+	}
+	wc.file = file
+	wc.size = size
+	wc.lastNewline = lastNewline
+	wc.headerEnd = 0
+	wc.midLine = lastNewline != size-1
+	// the archives may have been changed too
+	wc.archives = -1
+	wc.diag(slog.LevelInfo, "logrot: reopened log file")
+	wc.emit(Reopened, wc.path, Rotation{}, nil)
+	err = wc.writeHeader()
+	if err != nil {
+		return err
+	}
+	if wc.opts.CompressMirror && wc.maxFiles > 1 {
+		wc.openMirror()
+	}
+	if wc.opts.Preallocate {
+		return wc.preallocate()
+	}
+	return nil
+}
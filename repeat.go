@@ -0,0 +1,74 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import "bytes"
+
+// suppressRepeats returns p less the lines which repeat the line
+// before them, counting them in wc.repeats, and with a line reporting
+// the count put before the first line which differs. Only lines whole
+// in p are compared, so a line begun by an earlier call, or not
+// finished in p, is neither suppressed nor kept for comparison.
+func (wc *Writer) suppressRepeats(p []byte) []byte {
+	out := make([]byte, 0, len(p))
+	mid := wc.midLine
+	for len(p) > 0 {
+		i := bytes.Index(p, wc.delim)
+		if i == -1 {
+			out = wc.appendRepeats(out)
+			wc.lastLine = wc.lastLine[:0]
+			return append(out, p...)
+		}
+		line := p[:i]
+		p = p[i+len(wc.delim):]
+		if !mid && wc.repeats >= 0 && bytes.Equal(line, wc.lastLine) {
+			wc.repeats++
+			continue
+		}
+		out = wc.appendRepeats(out)
+		out = append(out, line...)
+		out = append(out, wc.delim...)
+		wc.repeats = -1
+		if !mid {
+			wc.lastLine = append(wc.lastLine[:0], line...)
+			wc.repeats = 0
+		}
+		mid = false
+	}
+	return out
+}
+
+// appendRepeats appends to out the report of the lines suppressed by
+// suppressRepeats since the last one kept, if any. A single repeat is
+// written as it is.
+func (wc *Writer) appendRepeats(out []byte) []byte {
+	switch {
+	case wc.repeats == 1:
+		out = append(out, wc.lastLine...)
+		out = append(out, wc.delim...)
+	case wc.repeats > 1:
+		out = append(out, wc.record("last message repeated %d times",
+			wc.repeats)...)
+	}
+	wc.repeats = -1
+	return out
+}
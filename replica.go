@@ -0,0 +1,61 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+// Replica receives a copy of the data written to a log file and of
+// its rotations, as set by Options.Replica, so that the same files
+// can be kept elsewhere. Its methods are called in the order of the
+// writes and rotations with the Writer's lock held, so they must
+// return quickly and must not call the Writer. The Writer does not
+// close its Replica.
+type Replica interface {
+	// Append is passed data just written to the log file. It must
+	// not retain p.
+	Append(p []byte)
+
+	// Rotated is called after each successful rotation, with r
+	// not yet completed with its Duration.
+	Rotated(r Rotation)
+}
+
+// replicate passes p, just written to the log file, to the shadow and
+// the Replica.
+func (wc *Writer) replicate(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	wc.writeShadow(p)
+	if wc.opts.Replica != nil {
+		wc.opts.Replica.Append(p)
+	}
+}
+
+// replicateRotation passes r, a rotation just performed, to the shadow
+// and the Replica.
+func (wc *Writer) replicateRotation(r Rotation) {
+	if wc.opts.ShadowPath != "" {
+		wc.rotateShadow()
+	}
+	if wc.opts.Replica != nil {
+		wc.opts.Replica.Rotated(r)
+	}
+}
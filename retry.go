@@ -0,0 +1,259 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// retryMinDelay is the delay before the first retry.
+	retryMinDelay = time.Second
+	// defaultRetryMaxDelay is used when Options.RetryMaxDelay is
+	// zero.
+	defaultRetryMaxDelay = 10 * time.Minute
+)
+
+// pendingDir returns the directory holding archives waiting to be
+// retried.
+func (wc *Writer) pendingDir() string {
+	return wc.archiveBase + ".pending"
+}
+
+// queueArchive moves local, a private link to an archive which could
+// not be sent, to the pending directory with its metadata and wakes
+// the retry loop.
+func (wc *Writer) queueArchive(local string, meta ArchiveMeta) error {
+	dir := wc.pendingDir()
+	err := wc.fs.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	// the metadata goes first so that an archive is never queued
+	// without it
+	name := filepath.Join(dir, meta.Name)
+	err = writeFile(wc.fs, name+".json.tmp", data, 0600)
+	if err == nil {
+		err = wc.rename(name+".json.tmp", name+".json")
+	}
+	if err == nil {
+		err = wc.rename(local, name)
+	}
+	if err != nil {
+		_ = wc.fs.Remove(name + ".json.tmp")
+		_ = wc.fs.Remove(name + ".json")
+		return err
+	}
+	wc.wakeRetry()
+	return nil
+}
+
+// retryState schedules the retries of the archives in the pending
+// directory on the Writer's Clock, so that no goroutine waits between
+// them.
+type retryState struct {
+	stop chan struct{} // closed by stopRetry
+	run  sync.Mutex    // held while retrying
+
+	mu      sync.Mutex // guards the fields below
+	timer   Timer      // the next retry, or nil
+	delay   time.Duration
+	running bool
+	woken   bool // wakeRetry was called while running
+	closed  bool
+}
+
+// wakeRetry schedules a retry of the pending archives after the
+// current delay, unless one is already due.
+func (wc *Writer) wakeRetry() {
+	r := wc.retry
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.closed || r.timer != nil:
+	case r.running:
+		r.woken = true
+	default:
+		r.timer = wc.clock.AfterFunc(r.delay, wc.startRetry)
+	}
+}
+
+// startRetry runs when a retry is due. The archives are sent in a
+// goroutine of their own, which waits for any retry still running.
+func (wc *Writer) startRetry() {
+	r := wc.retry
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timer = nil
+	if r.closed {
+		return
+	}
+	r.running = true
+	go func() {
+		r.run.Lock()
+		defer r.run.Unlock()
+		ok := false
+		if !isClosed(r.stop) {
+			ok = wc.retryPending()
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.running = false
+		if r.closed {
+			return
+		}
+		if ok {
+			// wait to be woken again, with exponential backoff
+			// while archives fail
+			r.delay = retryMinDelay
+			if !r.woken {
+				return
+			}
+			r.woken = false
+		} else {
+			maxDelay := wc.opts.RetryMaxDelay
+			if maxDelay == 0 {
+				maxDelay = defaultRetryMaxDelay
+			}
+			r.delay *= 2
+			if r.delay > maxDelay {
+				r.delay = maxDelay
+			}
+		}
+		r.timer = wc.clock.AfterFunc(r.delay, wc.startRetry)
+	}()
+}
+
+// isClosed reports whether the channel c is closed.
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// stopRetry cancels any scheduled retry and waits for any in progress
+// to stop.
+func (wc *Writer) stopRetry() {
+	r := wc.retry
+	r.mu.Lock()
+	r.closed = true
+	close(r.stop)
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	r.mu.Unlock()
+	r.run.Lock()
+	r.run.Unlock()
+}
+
+// retryPending sends the archives in the pending directory, oldest
+// first, and reports whether they were all sent. It stops at the first
+// failure.
+func (wc *Writer) retryPending() bool {
+	dir := wc.pendingDir()
+	entries, err := wc.fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true
+		}
+		wc.archiveError(dir, err)
+		return false
+	}
+	var names []string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+		}
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		select {
+		case <-wc.retry.stop:
+			return false
+		default:
+		}
+		name := filepath.Join(dir, n)
+		err := wc.retryArchive(name)
+		if err != nil {
+			wc.archiveError(name, err)
+			return false
+		}
+	}
+	return true
+}
+
+// retryArchive sends the pending archive name, removing it and its
+// metadata if it is sent.
+func (wc *Writer) retryArchive(name string) error {
+	data, err := readFile(wc.fs, name+".json")
+	if err != nil {
+		return err
+	}
+	var meta ArchiveMeta
+	err = json.Unmarshal(data, &meta)
+	if err != nil {
+		return err
+	}
+	fi, err := wc.fs.Stat(name)
+	if os.IsNotExist(err) {
+		// left by a crash while queueing
+		return wc.fs.Remove(name + ".json")
+	}
+	if err != nil {
+		return err
+	}
+	wc.archiveSem <- struct{}{}
+	err = wc.opts.Archiver.Archive(wc.archiveCtx, name, meta)
+	<-wc.archiveSem
+	if err != nil {
+		return err
+	}
+	if wc.opts.RemoveArchived {
+		wc.sentMu.Lock()
+		if i := wc.findSent(fi); i != -1 {
+			wc.sent[i].done = true
+		} else {
+			// queued by an earlier process
+			wc.sent = append(wc.sent, &sentArchive{fi: fi, done: true})
+		}
+		wc.sentMu.Unlock()
+	}
+	err = wc.fs.Remove(name)
+	if e := wc.fs.Remove(name + ".json"); err == nil {
+		err = e
+	}
+	return err
+}
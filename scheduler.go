@@ -0,0 +1,167 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// DefaultScheduler is a Scheduler which Writers and Managers in a
+// process may share, by setting it as their Clock, rounding times up
+// to a tenth of a second.
+var DefaultScheduler = NewScheduler(nil, 100*time.Millisecond)
+
+// Scheduler is a Clock which runs all the timed work of the Writers,
+// Managers and KeyedWriters using it from a single timer, so that a
+// process with dozens of them does not have a timer for each. The
+// periodic syncs of SyncInterval, the retries of RetryArchives and the
+// budget sweeps of a Manager or KeyedWriter are all timed by their
+// Clock.
+//
+// The functions passed to AfterFunc are started in order of when
+// they are due, each in its own goroutine as with time.AfterFunc, so
+// that one which blocks, such as on the lock of a Writer being
+// closed, does not hold up the others.
+type Scheduler struct {
+	clock      Clock
+	resolution time.Duration
+
+	mu      sync.Mutex
+	entries scheduleHeap
+	timer   Timer     // of clock, for the earliest entry, or nil
+	next    time.Time // when timer fires
+	gen     int       // counts timers, so that stale ones are ignored
+}
+
+// NewScheduler returns a Scheduler timed by clock, or the system clock
+// if clock is nil. If resolution is positive, the times at which
+// functions are due are rounded up to a multiple of it, so that those
+// due at about the same time run together from one wakeup.
+func NewScheduler(clock Clock, resolution time.Duration) *Scheduler {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &Scheduler{clock: clock, resolution: resolution}
+}
+
+// Now returns the time of the Scheduler's clock.
+func (s *Scheduler) Now() time.Time {
+	return s.clock.Now()
+}
+
+// AfterFunc calls f in its own goroutine once d has elapsed.
+func (s *Scheduler) AfterFunc(d time.Duration, f func()) Timer {
+	when := s.clock.Now().Add(d)
+	if s.resolution > 0 {
+		if r := when.Sub(when.Truncate(s.resolution)); r > 0 {
+			when = when.Add(s.resolution - r)
+		}
+	}
+	e := &scheduleEntry{s: s, when: when, f: f}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	heap.Push(&s.entries, e)
+	s.arm()
+	return e
+}
+
+// arm sets the timer for the earliest entry. s.mu must be held.
+func (s *Scheduler) arm() {
+	if len(s.entries) == 0 {
+		return
+	}
+	when := s.entries[0].when
+	if s.timer != nil {
+		if !when.Before(s.next) {
+			return
+		}
+		s.timer.Stop()
+	}
+	s.gen++
+	gen := s.gen
+	s.next = when
+	s.timer = s.clock.AfterFunc(when.Sub(s.clock.Now()), func() { s.fire(gen) })
+}
+
+// fire starts the functions which are due, unless the timer of
+// generation gen has been replaced.
+func (s *Scheduler) fire(gen int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if gen != s.gen {
+		return
+	}
+	s.timer = nil
+	for len(s.entries) > 0 && !s.entries[0].when.After(s.clock.Now()) {
+		e := heap.Pop(&s.entries).(*scheduleEntry)
+		go e.f()
+	}
+	s.arm()
+}
+
+// scheduleEntry is a function waiting to run on a Scheduler.
+type scheduleEntry struct {
+	s     *Scheduler
+	when  time.Time
+	f     func()
+	index int // in s.entries, or -1 once removed
+}
+
+// Stop prevents e from running, reporting whether it did so.
+func (e *scheduleEntry) Stop() bool {
+	e.s.mu.Lock()
+	defer e.s.mu.Unlock()
+	if e.index < 0 {
+		return false
+	}
+	heap.Remove(&e.s.entries, e.index)
+	return true
+}
+
+// scheduleHeap orders the entries of a Scheduler by when they are due.
+type scheduleHeap []*scheduleEntry
+
+func (h scheduleHeap) Len() int           { return len(h) }
+func (h scheduleHeap) Less(i, j int) bool { return h[i].when.Before(h[j].when) }
+
+func (h scheduleHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *scheduleHeap) Push(x interface{}) {
+	e := x.(*scheduleEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *scheduleHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,89 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// hungArchiver is an Archiver whose uploads never finish until
+// cancelled.
+type hungArchiver struct {
+	started chan struct{}
+}
+
+func (a *hungArchiver) Archive(ctx context.Context, localPath string, meta ArchiveMeta) error {
+	select {
+	case a.started <- struct{}{}:
+	default:
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// TestSchedulerCloseArchiving checks that Close gives up on a hung
+// Archiver after ArchiveTimeout when the Writer's Clock is a Scheduler
+// whose timer for a periodic sync is waiting for the Writer's lock.
+func TestSchedulerCloseArchiving(t *testing.T) {
+	var slow atomic.Bool
+	a := &hungArchiver{started: make(chan struct{}, 1)}
+	wc, err := OpenWithOptions(filepath.Join(t.TempDir(), "log"), 0644, 10, 3,
+		&Options{
+			Clock:          NewScheduler(nil, 0),
+			SyncInterval:   50 * time.Millisecond,
+			Archiver:       a,
+			ArchiveTimeout: 200 * time.Millisecond,
+			Fault: func(op FaultOp, name string) error {
+				if op == FaultWrite && slow.Load() {
+					time.Sleep(300 * time.Millisecond)
+				}
+				return nil
+			},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rotate so that an archive is being sent, and arm the sync timer
+	if _, err := wc.Write([]byte("0123456789\nab")); err != nil {
+		t.Fatal(err)
+	}
+	<-a.started
+	// hold the lock through a slow write, so that Close waits for it
+	// before the sync timer fires and waits for it too
+	slow.Store(true)
+	go func() { _, _ = wc.Write([]byte("c\n")) }()
+	time.Sleep(10 * time.Millisecond)
+	done := make(chan error, 1)
+	go func() { done <- wc.Close() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked")
+	}
+}
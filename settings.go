@@ -0,0 +1,99 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"errors"
+	"os"
+)
+
+// Settings are the settings of a Writer which can be changed while it
+// is in use, with Update. The fields other than MaxSize and MaxFiles,
+// the maxSize and maxFiles arguments of Open, are those of Options.
+type Settings struct {
+	MaxSize  int64
+	MaxFiles int
+
+	BackgroundCompress bool
+	VerifyArchive      bool
+	Checksums          bool
+	ArchivePerm        os.FileMode
+
+	PurgeOnFull bool
+	PurgeKeep   int
+	KeepLocal   int
+}
+
+// Settings returns the current settings of wc.
+func (wc *Writer) Settings() Settings {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	return Settings{
+		MaxSize:            wc.maxSize,
+		MaxFiles:           wc.maxFiles,
+		BackgroundCompress: wc.opts.BackgroundCompress,
+		VerifyArchive:      wc.opts.VerifyArchive,
+		Checksums:          wc.opts.Checksums,
+		ArchivePerm:        wc.opts.ArchivePerm,
+		PurgeOnFull:        wc.opts.PurgeOnFull,
+		PurgeKeep:          wc.opts.PurgeKeep,
+		KeepLocal:          wc.opts.KeepLocal,
+	}
+}
+
+// Update changes the settings of wc to s, so that rotation can be
+// retuned without reopening the log file. The settings are changed
+// together, between writes and while no rotation is in progress, so
+// each rotation uses either the old settings or the new. They take
+// effect from the next write or rotation: a smaller MaxFiles removes
+// the archives beyond it at the next rotation. As with Open, Shared
+// mode forbids BackgroundCompress and an Encrypter VerifyArchive; they
+// are ignored.
+func (wc *Writer) Update(s Settings) error {
+	if s.MaxSize < 1 {
+		return errors.New("logrot: maxSize < 1")
+	}
+	if s.MaxFiles < 1 {
+		return errors.New("logrot: maxFiles < 1")
+	}
+	if wc.opts.Shared {
+		s.BackgroundCompress = false
+	}
+	if wc.opts.Encrypter != nil {
+		s.VerifyArchive = false
+	}
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	// wait for any compression in progress
+	wc.rotMu.Lock()
+	defer wc.rotMu.Unlock()
+	wc.maxSize = s.MaxSize
+	wc.maxFiles = s.MaxFiles
+	wc.opts.BackgroundCompress = s.BackgroundCompress
+	wc.opts.VerifyArchive = s.VerifyArchive
+	wc.opts.Checksums = s.Checksums
+	wc.opts.ArchivePerm = s.ArchivePerm
+	wc.opts.PurgeOnFull = s.PurgeOnFull
+	wc.opts.PurgeKeep = s.PurgeKeep
+	wc.opts.KeepLocal = s.KeepLocal
+	return nil
+}
@@ -0,0 +1,137 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+)
+
+// checkShadow returns an error if ShadowPath cannot be used for the
+// log file path with opts.
+func checkShadow(path string, opts *Options) error {
+	switch {
+	case opts.ShadowPath == path:
+		return errors.New("logrot: ShadowPath is the log file")
+	case opts.Shared:
+		return errors.New("logrot: ShadowPath cannot be used with Shared")
+	}
+	return nil
+}
+
+// shadowOptions returns the options of the shadow Writer, which is
+// given data already transformed by wc and rotates only when wc
+// does.
+func (wc *Writer) shadowOptions() *Options {
+	o := wc.opts
+	o.ShadowPath = ""
+	o.ArchiveDir = ""
+	o.FallbackPath = ""
+	o.LazyOpen = false
+	o.IdleClose = 0
+	o.ReopenInterval = 0
+	o.AsyncQueue = 0
+	o.OnHighWater = nil
+	o.RateLimit = 0
+	o.DailyQuota = 0
+	o.MinFreeSpace = 0
+	o.MaxLineBytes = 0
+	o.TimestampFormat = ""
+	o.SuppressRepeats = false
+	o.Preallocate = false
+	o.Archiver = nil
+	o.RemoveArchived = false
+	o.RetryArchives = false
+	o.OnArchiveError = nil
+	o.OnRotate = nil
+	o.OnRotateContext = nil
+	if !o.CompressLive {
+		// a slow volume must not delay the rotation of the log file
+		o.BackgroundCompress = true
+	}
+	return &o
+}
+
+// openShadow opens the shadow Writer. On failure there is none until
+// the next rotation tries again.
+func (wc *Writer) openShadow() {
+	sh, err := OpenWithOptions(wc.opts.ShadowPath, wc.perm,
+		math.MaxInt64, wc.maxFiles, wc.shadowOptions())
+	if err != nil {
+		wc.shadowFailed(err)
+		return
+	}
+	wc.shadow = sh
+}
+
+// writeShadow writes p, just written to the log file, to the shadow.
+func (wc *Writer) writeShadow(p []byte) {
+	if wc.shadow == nil {
+		return
+	}
+	_, err := wc.shadow.lockedWrite(context.Background(), p)
+	if err != nil {
+		wc.shadowFailed(err)
+	}
+}
+
+// rotateShadow rotates the shadow as the log file has just been
+// rotated, first opening it if it failed earlier.
+func (wc *Writer) rotateShadow() {
+	if wc.shadow == nil {
+		wc.openShadow()
+		if wc.shadow == nil {
+			return
+		}
+	}
+	err := wc.shadow.Rotate()
+	if err != nil {
+		wc.shadowFailed(err)
+	}
+}
+
+// closeShadow closes the shadow, if there is one.
+func (wc *Writer) closeShadow() {
+	if wc.shadow == nil {
+		return
+	}
+	err := wc.shadow.Close()
+	wc.shadow = nil
+	if err != nil {
+		wc.shadowFailed(err)
+	}
+}
+
+// shadowFailed reports err, which happened to the shadow, and drops
+// it. The log file is unaffected.
+func (wc *Writer) shadowFailed(err error) {
+	wc.stats.ShadowErrors++
+	wc.diag(slog.LevelWarn, "logrot: shadow failed",
+		"shadow", wc.opts.ShadowPath, "error", err)
+	wc.emit(ShadowError, wc.opts.ShadowPath, Rotation{}, err)
+	if sh := wc.shadow; sh != nil {
+		wc.shadow = nil
+		_ = sh.Close()
+	}
+}
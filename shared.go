@@ -0,0 +1,61 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import "os"
+
+// lockShared takes the lock on <path>.lock for a write in shared mode
+// and brings the recorded state of the log file up to date with any
+// changes made by other processes.
+func (wc *Writer) lockShared() error {
+	err := lockFile(wc.lockFile)
+	if err != nil {
+		return err
+	}
+	err = wc.syncShared()
+	if err != nil {
+		_ = unlockFile(wc.lockFile)
+	}
+	return err
+}
+
+// syncShared rereads the size and last newline position of the log
+// file, reopening path if another process has replaced it.
+func (wc *Writer) syncShared() error {
+	fi, err := wc.fs.Stat(wc.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	cur, e := wc.file.Stat()
+	if e != nil {
+		return e
+	}
+	if err != nil || !sameFile(fi, cur) {
+		return wc.reopen()
+	}
+	if cur.Size() != wc.size {
+		wc.size = cur.Size()
+		wc.lastNewline, err = wc.findLastSplit(wc.file, wc.size)
+		wc.headerEnd = 0
+	}
+	return err
+}
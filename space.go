@@ -0,0 +1,166 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// freeSpaceInterval is the least time between checks of the free
+// space for MinFreeSpace.
+const freeSpaceInterval = 5 * time.Second
+
+var errFreeSpaceUnsupported = errors.New(
+	"logrot: MinFreeSpace is not supported on this platform")
+
+// spaceState tracks the free space for MinFreeSpace.
+type spaceState struct {
+	checked time.Time // time of last checkSpace, guarded by wc.mu
+
+	mu    sync.Mutex
+	low   bool  // the free space was below MinFreeSpace
+	lines int64 // lines dropped since last reported
+	bytes int64 // bytes dropped since last reported
+}
+
+// checkSpace checks the free space on the file system holding the log
+// file, doing nothing if it was last called less than
+// freeSpaceInterval ago. While the free space is below MinFreeSpace
+// the log file is rotated, if it holds a complete line, and the
+// oldest archives are removed until it is not. A failure to find the
+// free space is taken to mean that it is not low.
+func (wc *Writer) checkSpace() error {
+	s := wc.space
+	now := wc.clock.Now()
+	if !s.checked.IsZero() && now.Sub(s.checked) < freeSpaceInterval {
+		return nil
+	}
+	s.checked = now
+	free, err := freeSpace(filepath.Dir(wc.path))
+	low := err == nil && free < wc.opts.MinFreeSpace
+	s.mu.Lock()
+	s.low = low
+	s.mu.Unlock()
+	if !low {
+		return nil
+	}
+	if wc.lastNewline >= wc.headerEnd {
+		err = wc.rotate()
+		if err != nil {
+			return err
+		}
+	}
+	return wc.purgeForSpace()
+}
+
+// purgeForSpace removes the oldest archives while the free space is
+// below MinFreeSpace and more than PurgeKeep remain.
+func (wc *Writer) purgeForSpace() error {
+	defer wc.unlockRotation()
+	err := wc.lockRotation()
+	if err != nil {
+		return err
+	}
+	for {
+		free, err := freeSpace(filepath.Dir(wc.path))
+		if err != nil || free >= wc.opts.MinFreeSpace {
+			return nil
+		}
+		n, err := wc.lastArchive()
+		if err != nil || n <= wc.opts.PurgeKeep {
+			return err
+		}
+		err = wc.removeArchive(wc.archiveName(n))
+		if err != nil {
+			return err
+		}
+		wc.archives = n - 1
+	}
+}
+
+// keepForSpace returns p less the lines which LowSpaceKeep does not
+// keep while the free space is low, and with a line reporting those
+// dropped put before the first data written once it is not. If p
+// continues a line begun by an earlier write, that line is ended
+// before the report is put in or its rest dropped. wc.mu must be
+// held.
+func (wc *Writer) keepForSpace(p []byte) []byte {
+	s := wc.space
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.low {
+		if report := s.report(wc); report != nil {
+			var out []byte
+			if wc.midLine {
+				out = wc.lineBreak()
+			}
+			out = append(out, report...)
+			return append(out, p...)
+		}
+		return p
+	}
+	mid := wc.midLine
+	var out []byte
+	for len(p) > 0 {
+		line := p
+		if i := bytes.Index(p, wc.delim); i != -1 && len(wc.delim) > 0 {
+			line = p[:i+len(wc.delim)]
+		}
+		p = p[len(line):]
+		if wc.opts.LowSpaceKeep(bytes.TrimSuffix(line, wc.delim)) {
+			out = append(out, line...)
+			mid = false
+			continue
+		}
+		if mid {
+			// end the line whose rest is dropped
+			out = append(out, wc.lineBreak()...)
+			mid = false
+		}
+		s.lines++
+		s.bytes += int64(len(line))
+	}
+	return out
+}
+
+// report returns the line reporting the data dropped since the last
+// report, or nil if there is none. s.mu must be held.
+func (s *spaceState) report(wc *Writer) []byte {
+	if s.lines == 0 {
+		return nil
+	}
+	report := wc.record("logrot: %d lines (%d bytes) dropped while free space was low",
+		s.lines, s.bytes)
+	s.lines, s.bytes = 0, 0
+	return report
+}
+
+// spaceReport is report for Close.
+func (wc *Writer) spaceReport() []byte {
+	wc.space.mu.Lock()
+	defer wc.space.mu.Unlock()
+	return wc.space.report(wc)
+}
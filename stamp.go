@@ -0,0 +1,50 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import "bytes"
+
+// stamp returns p with the current time, in the layout
+// Options.TimestampFormat, and a space put before each line which
+// starts in it. wc.midLine records whether the data written so far
+// ends part way through a line, so that a line written by several
+// calls is stamped only once.
+func (wc *Writer) stamp(p []byte) []byte {
+	prefix := wc.clock.Now().AppendFormat(nil, wc.opts.TimestampFormat)
+	prefix = append(prefix, ' ')
+	n := bytes.Count(p, wc.delim) + 1
+	out := make([]byte, 0, len(p)+n*len(prefix))
+	for len(p) > 0 {
+		if !wc.midLine {
+			out = append(out, prefix...)
+		}
+		i := bytes.Index(p, wc.delim)
+		if i == -1 {
+			wc.midLine = true
+			return append(out, p...)
+		}
+		out = append(out, p[:i+len(wc.delim)]...)
+		p = p[i+len(wc.delim):]
+		wc.midLine = false
+	}
+	return out
+}
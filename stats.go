@@ -0,0 +1,52 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import "sync/atomic"
+
+// Stats holds counters describing the activity of a Writer since it
+// was opened.
+type Stats struct {
+	Writes        int64 // calls to Write, or batches in asynchronous mode
+	BytesWritten  int64 // bytes written to the log file
+	Rotations     int64 // rotations performed
+	Errors        int64 // calls to Write that returned an error
+	Size          int64 // current size of the log file
+	Queued        int   // writes waiting in the asynchronous queue
+	Dropped       int64 // writes discarded because the queue was full
+	RateDropped   int64 // writes discarded by the rate limit
+	EventsDropped int64 // events discarded because the Events channel was full
+	ShadowErrors  int64 // failures of the shadow, see Options.ShadowPath
+}
+
+// Stats returns a snapshot of the counters for wc.
+func (wc *Writer) Stats() Stats {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	s := wc.stats
+	s.Size = wc.size
+	s.Queued = len(wc.queue)
+	s.Dropped = atomic.LoadInt64(&wc.dropped)
+	s.RateDropped = atomic.LoadInt64(&wc.rateDropped)
+	s.EventsDropped = atomic.LoadInt64(&wc.events.dropped)
+	return s
+}
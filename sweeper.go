@@ -0,0 +1,119 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"sync"
+	"time"
+)
+
+// sweeper runs sweep when triggered and every interval, if positive,
+// until closed, passing errors to onError. The sweeps are scheduled on
+// clock, so that no goroutine waits between them, and never overlap.
+type sweeper struct {
+	sweep    func() error
+	interval time.Duration
+	clock    Clock
+	onError  func(error)
+	run      sync.Mutex // held while sweeping
+
+	mu      sync.Mutex // guards the fields below
+	pending Timer      // triggered sweep, or nil
+	tick    Timer      // next sweep after interval, or nil
+	closed  bool
+}
+
+// newSweeper returns a started sweeper.
+func newSweeper(sweep func() error, interval time.Duration, clock Clock, onError func(error)) *sweeper {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	s := &sweeper{
+		sweep:    sweep,
+		interval: interval,
+		clock:    clock,
+		onError:  onError,
+	}
+	if interval > 0 {
+		s.tick = clock.AfterFunc(interval, s.ticked)
+	}
+	return s
+}
+
+// trigger schedules a sweep now, unless one is already scheduled. It
+// does not block, so it may be called from OnRotate with the rotation
+// lock held.
+func (s *sweeper) trigger() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed && s.pending == nil {
+		s.pending = s.clock.AfterFunc(0, s.triggered)
+	}
+}
+
+// triggered runs a sweep scheduled by trigger.
+func (s *sweeper) triggered() {
+	s.mu.Lock()
+	s.pending = nil
+	s.mu.Unlock()
+	go s.runSweep()
+}
+
+// ticked runs a sweep scheduled by interval and schedules the next.
+func (s *sweeper) ticked() {
+	s.mu.Lock()
+	if !s.closed {
+		s.tick = s.clock.AfterFunc(s.interval, s.ticked)
+	}
+	s.mu.Unlock()
+	go s.runSweep()
+}
+
+// runSweep sweeps unless s is closed. Sweeps never overlap.
+func (s *sweeper) runSweep() {
+	s.run.Lock()
+	defer s.run.Unlock()
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return
+	}
+	err := s.sweep()
+	if err != nil && s.onError != nil {
+		s.onError(err)
+	}
+}
+
+// close stops s, waiting for any sweep in progress.
+func (s *sweeper) close() {
+	s.mu.Lock()
+	s.closed = true
+	for _, t := range []Timer{s.pending, s.tick} {
+		if t != nil {
+			t.Stop()
+		}
+	}
+	s.mu.Unlock()
+	s.run.Lock()
+	s.run.Unlock()
+}
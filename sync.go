@@ -0,0 +1,82 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import "errors"
+
+// Sync commits the current contents of the log file to stable
+// storage. In asynchronous mode data still in the queue is not
+// included.
+func (wc *Writer) Sync() error {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	if wc.closed {
+		return errors.New("logrot: Writer is closed")
+	}
+	if wc.file == nil {
+		// nothing has been written
+		return nil
+	}
+	return wc.sync()
+}
+
+func (wc *Writer) sync() error {
+	wc.unsynced = 0
+	if wc.gz != nil && wc.unflushed {
+		err := wc.flushLive()
+		if err != nil {
+			return err
+		}
+	}
+	return wc.file.Sync()
+}
+
+// syncPolicy applies SyncEveryBytes and SyncInterval after a write
+// of n bytes.
+func (wc *Writer) syncPolicy(n int) error {
+	wc.unsynced += int64(n)
+	if wc.unsynced == 0 {
+		return nil
+	}
+	if wc.opts.SyncEveryBytes > 0 && wc.unsynced >= wc.opts.SyncEveryBytes {
+		return wc.sync()
+	}
+	if wc.opts.SyncInterval > 0 && wc.syncTimer == nil {
+		wc.syncTimer = wc.clock.AfterFunc(wc.opts.SyncInterval, wc.timedSync)
+	}
+	return nil
+}
+
+// timedSync runs when SyncInterval has elapsed since unsynced data
+// was written. An error is returned by the next Write.
+func (wc *Writer) timedSync() {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	wc.syncTimer = nil
+	if wc.closed || wc.unsynced == 0 {
+		return
+	}
+	if err := wc.sync(); err != nil && wc.writeErr == nil {
+		wc.writeErr = err
+		wc.stats.Errors++
+	}
+}
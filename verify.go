@@ -0,0 +1,66 @@
+/*
+   Copyright 2015 The Logrot Authors. See the AUTHORS file at the
+   top-level directory of this distribution and at
+   <https://xi2.org/x/logrot/m/AUTHORS>.
+
+   This file is part of Logrot.
+
+   Logrot is free software: you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   Lotrot is distributed in the hope that it will be useful, but
+   WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+   General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with Logrot.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logrot
+
+import (
+	"compress/gzip"
+	"fmt"
+	"hash/crc32"
+)
+
+// checksum is an io.Writer which records the length and CRC-32 of the
+// data written to it.
+type checksum struct {
+	n   int64
+	crc uint32
+}
+
+func (c *checksum) Write(p []byte) (int, error) {
+	c.crc = crc32.Update(c.crc, crc32.IEEETable, p)
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// verifyArchive decompresses the gzip file name on fsys and checks that its
+// contents have the length and CRC-32 recorded in want.
+func verifyArchive(fsys FS, name string, want checksum) error {
+	f, err := open(fsys, name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	var got checksum
+	_, err = copyBuffer(&got, zr)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf(
+			"logrot: %s holds %d bytes with CRC-32 %08x, want %d bytes with CRC-32 %08x",
+			name, got.n, got.crc, want.n, want.crc)
+	}
+	return nil
+}